@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"gopkg.in/yaml.v2"
+)
+
+// The fleet benchmarks run Execute against in-process SSH servers, one per
+// host, and report throughput, peak heap and peak goroutines for each
+// concurrency limit. The heap includes the servers; the goroutines of the
+// idle servers are subtracted. The default latency is a round trip within a
+// region, so that concurrency pays off as it does against real hosts.
+var (
+	fleetHosts   = flag.Int("fleet.hosts", 200, "number of in-process SSH hosts")
+	fleetChecks  = flag.Int("fleet.checks", 5, "command checks per host")
+	fleetLatency = flag.Duration("fleet.latency", 20*time.Millisecond, "latency added to every server write")
+)
+
+var fleetConcurrency = []int{1, 8, 32, 128, 512}
+
+// fleetHandler answers the checks with output of a typical size
+func fleetHandler(command string) (string, int) {
+	return "PermitRootLogin no\nPasswordAuthentication no\nX11Forwarding no\n", 0
+}
+
+// startFleet starts the servers and returns the Execute input of each host
+func startFleet(b *testing.B, hosts int, checks int, latency time.Duration) []*ExecuteInput {
+	b.Helper()
+	inputs := make([]*ExecuteInput, hosts)
+	for i := range inputs {
+		config := newTestServer(b, fleetHandler, Faults{Latency: latency}).SSHConfig()
+		config.Timeout = "30s"
+		for j := 0; j < checks; j++ {
+			config.Checks = append(config.Checks, Check{
+				Id:      fmt.Sprintf("check-%d", j),
+				Command: "grep -E '^(PermitRootLogin|PasswordAuthentication|X11Forwarding)' /etc/ssh/sshd_config",
+			})
+		}
+		out, err := yaml.Marshal(config)
+		if err != nil {
+			b.Fatal(err)
+		}
+		inputs[i] = &ExecuteInput{Configuration: map[string]string{"yaml": string(out)}}
+	}
+	return inputs
+}
+
+// peakSampler records the peak heap and goroutine counts until stopped
+type peakSampler struct {
+	stop       chan struct{}
+	done       sync.WaitGroup
+	heap       uint64
+	goroutines int
+}
+
+func startSampler(interval time.Duration) *peakSampler {
+	s := &peakSampler{stop: make(chan struct{})}
+	s.done.Add(1)
+	go func() {
+		defer s.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			s.heap = max(s.heap, stats.HeapInuse)
+			s.goroutines = max(s.goroutines, runtime.NumGoroutine())
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+func (s *peakSampler) Stop() {
+	close(s.stop)
+	s.done.Wait()
+}
+
+// executeFleet runs Execute once for every host with the given number of
+// workers and returns how many runs failed
+func executeFleet(provider *SSHCommandProvider, inputs []*ExecuteInput, workers int) int {
+	jobs := make(chan *ExecuteInput)
+	var mu sync.Mutex
+	failed := 0
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for input := range jobs {
+				result, err := provider.Execute(input)
+				if err != nil || result.Status != ExecutionStatus_SUCCESS {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, input := range inputs {
+		jobs <- input
+	}
+	close(jobs)
+	wg.Wait()
+	return failed
+}
+
+func TestExecuteFleetCountsFailures(t *testing.T) {
+	inputs := []*ExecuteInput{}
+	for _, password := range []string{"secret", "wrong", "secret"} {
+		config := newTestServer(t, fleetHandler).SSHConfig()
+		config.Password = password
+		config.Command = "true"
+		out, err := yaml.Marshal(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, &ExecuteInput{Configuration: map[string]string{"yaml": string(out)}})
+	}
+	if failed := executeFleet(&SSHCommandProvider{}, inputs, 2); failed != 1 {
+		t.Errorf("expected the host rejecting the login to be counted as failed, got %d failures", failed)
+	}
+}
+
+// BenchmarkFleetExecute measures a full pass over the fleet per iteration.
+// Connections are pooled between iterations as between scheduled runs.
+func BenchmarkFleetExecute(b *testing.B) {
+	benchmarkFleet(b, false)
+}
+
+// BenchmarkFleetColdExecute measures a pass where every host is dialed
+// anew, as on the first run or with an idle timeout shorter than the
+// schedule interval
+func BenchmarkFleetColdExecute(b *testing.B) {
+	benchmarkFleet(b, true)
+}
+
+func benchmarkFleet(b *testing.B, cold bool) {
+	inputs := startFleet(b, *fleetHosts, *fleetChecks, *fleetLatency)
+	// The servers' accept loops run throughout and are not the client's
+	baseline := runtime.NumGoroutine()
+	for _, concurrency := range fleetConcurrency {
+		b.Run(fmt.Sprintf("hosts=%d/concurrency=%d", len(inputs), concurrency), func(b *testing.B) {
+			defer func(previous *ConnectionPool) { defaultPool = previous }(defaultPool)
+			options := PoolOptions{MaxConcurrent: concurrency}
+			defaultPool = NewConnectionPool(options)
+
+			provider := &SSHCommandProvider{}
+			runtime.GC()
+			sampler := startSampler(10 * time.Millisecond)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if cold {
+					b.StopTimer()
+					defaultPool.Close()
+					defaultPool = NewConnectionPool(options)
+					b.StartTimer()
+				}
+				if failed := executeFleet(provider, inputs, concurrency); failed > 0 {
+					b.Fatalf("%d of %d hosts failed", failed, len(inputs))
+				}
+			}
+			b.StopTimer()
+			sampler.Stop()
+			defaultPool.Close()
+
+			elapsed := b.Elapsed().Seconds()
+			b.ReportMetric(float64(b.N*len(inputs))/elapsed, "hosts/s")
+			b.ReportMetric(float64(b.N*len(inputs)**fleetChecks)/elapsed, "checks/s")
+			b.ReportMetric(float64(sampler.heap)/(1<<20), "peak-heap-MB")
+			b.ReportMetric(float64(max(0, sampler.goroutines-baseline)), "peak-client-goroutines")
+		})
+	}
+}
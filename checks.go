@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// Check is a single assertion run against the SSH target. A command check
+// passes when its command returns a zero exit code. Other check types are
+// selected with Type and configured through their own section.
+type Check struct {
+	Id          string `json:"id,omitempty" yaml:"id,omitempty"`
+	Title       string `json:"title,omitempty" yaml:"title,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Type        string `json:"type,omitempty" yaml:"type,omitempty"`
+	Command     string `json:"command,omitempty" yaml:"command,omitempty"`
+	Remarks     string `json:"remarks,omitempty" yaml:"remarks,omitempty"`
+
+	// Ownership overrides the owner of the check's Findings
+	Ownership *Ownership `json:"ownership,omitempty" yaml:"ownership,omitempty"`
+
+	// Severity is critical, high, medium or low and sets the issue
+	// priority of Findings that do not carry their own severity
+	Severity string `json:"severity,omitempty" yaml:"severity,omitempty"`
+
+	ServerVersion   *ServerVersionCheck   `json:"server_version,omitempty" yaml:"server_version,omitempty"`
+	PAM             *PAMCheck             `json:"pam,omitempty" yaml:"pam,omitempty"`
+	ScheduledTasks  *ScheduledTasksCheck  `json:"scheduled_tasks,omitempty" yaml:"scheduled_tasks,omitempty"`
+	PrivilegedFiles *PrivilegedFilesCheck `json:"privileged_files,omitempty" yaml:"privileged_files,omitempty"`
+	KernelModules   *KernelModulesCheck   `json:"kernel_modules,omitempty" yaml:"kernel_modules,omitempty"`
+	DiskEncryption  *DiskEncryptionCheck  `json:"disk_encryption,omitempty" yaml:"disk_encryption,omitempty"`
+	PendingUpdates  *PendingUpdatesCheck  `json:"pending_updates,omitempty" yaml:"pending_updates,omitempty"`
+	Secrets         *SecretsCheck         `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+	GoldenFile      *GoldenFileCheck      `json:"golden_file,omitempty" yaml:"golden_file,omitempty"`
+	ConfigFile      *ConfigFileCheck      `json:"config_file,omitempty" yaml:"config_file,omitempty"`
+	FileFreshness   *FileFreshnessCheck   `json:"file_freshness,omitempty" yaml:"file_freshness,omitempty"`
+	Processes       *ProcessesCheck       `json:"processes,omitempty" yaml:"processes,omitempty"`
+	LogForwarding   *LogForwardingCheck   `json:"log_forwarding,omitempty" yaml:"log_forwarding,omitempty"`
+	WebTLS          *WebTLSCheck          `json:"web_tls,omitempty" yaml:"web_tls,omitempty"`
+	SQL             *SQLCheck             `json:"sql,omitempty" yaml:"sql,omitempty"`
+}
+
+// Check types
+const (
+	CheckTypeCommand         = "command"
+	CheckTypeServerVersion   = "server_version"
+	CheckTypeTerrapin        = "terrapin"
+	CheckTypePAM             = "pam"
+	CheckTypeScheduledTasks  = "scheduled_tasks"
+	CheckTypePrivilegedFiles = "privileged_files"
+	CheckTypeKernelModules   = "kernel_modules"
+	CheckTypeDiskEncryption  = "disk_encryption"
+	CheckTypePendingUpdates  = "pending_updates"
+	CheckTypeSecrets         = "secrets"
+	CheckTypeGoldenFile      = "golden_file"
+	CheckTypeConfigFile      = "config_file"
+	CheckTypeFileFreshness   = "file_freshness"
+	CheckTypeProcesses       = "processes"
+	CheckTypeLogForwarding   = "log_forwarding"
+	CheckTypeWebTLS          = "web_tls"
+	CheckTypeSQL             = "sql"
+)
+
+// RunCheck runs a check over an established connection and returns the
+// resulting observations and findings
+func RunCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	switch check.Type {
+	case "", CheckTypeCommand:
+		return runCommandCheck(client, config, check)
+	case CheckTypeServerVersion:
+		return runServerVersionCheck(client, config, check)
+	case CheckTypeTerrapin:
+		return runTerrapinCheck(client, config, check)
+	case CheckTypePAM:
+		return runPAMCheck(client, config, check)
+	case CheckTypeScheduledTasks:
+		return runScheduledTasksCheck(client, config, check)
+	case CheckTypePrivilegedFiles:
+		return runPrivilegedFilesCheck(client, config, check)
+	case CheckTypeKernelModules:
+		return runKernelModulesCheck(client, config, check)
+	case CheckTypeDiskEncryption:
+		return runDiskEncryptionCheck(client, config, check)
+	case CheckTypePendingUpdates:
+		return runPendingUpdatesCheck(client, config, check)
+	case CheckTypeSecrets:
+		return runSecretsCheck(client, config, check)
+	case CheckTypeGoldenFile:
+		return runGoldenFileCheck(client, config, check)
+	case CheckTypeConfigFile:
+		return runConfigFileCheck(client, config, check)
+	case CheckTypeFileFreshness:
+		return runFileFreshnessCheck(client, config, check)
+	case CheckTypeProcesses:
+		return runProcessesCheck(client, config, check)
+	case CheckTypeLogForwarding:
+		return runLogForwardingCheck(client, config, check)
+	case CheckTypeWebTLS:
+		return runWebTLSCheck(client, config, check)
+	case CheckTypeSQL:
+		return runSQLCheck(client, config, check)
+	}
+	return nil, nil, fmt.Errorf("unknown check type %q", check.Type)
+}
+
+func runCommandCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	ssh_target_command := fmt.Sprintf("ssh -p %s %s@%s %s", config.Port, config.Username, config.Host, check.Command)
+
+	// Run the command and get the output
+	output, exit_code, err := RunSessionCommand(client, check.Command)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	props := append([]*Property{
+		{
+			Name:  "Command",
+			Value: ssh_target_command,
+		},
+	}, checkProps(check)...)
+	evidence := []*Evidence{
+		{
+			Description: fmt.Sprintf("The command returned an exit code of %d for the command: %s", exit_code, ssh_target_command),
+		},
+	}
+
+	if exit_code != 0 {
+		// observation and finding
+		obs := newObservation(
+			checkTitle(check, "SSH Command Did Not Succeed"),
+			fmt.Sprintf("The command: %s did not succeed.", ssh_target_command),
+			props,
+			evidence,
+			fmt.Sprintf("The command: '%s' should return a zero exit code.", ssh_target_command),
+		)
+		remarks := fmt.Sprintf("Correct the command %s.", ssh_target_command)
+		if check.Remarks != "" {
+			remarks = check.Remarks
+		}
+		fndng := newFinding(
+			obs,
+			checkTitle(check, "SSH Command Failure"),
+			fmt.Sprintf("The command %s did not succeed, and produced output: %s.", ssh_target_command, output),
+			remarks,
+			props,
+		)
+		return []*Observation{obs}, []*Finding{fndng}, nil
+	}
+
+	// observation only
+	obs := newObservation(
+		checkTitle(check, "SSH Command Succeeded"),
+		fmt.Sprintf("The command: %s succeeded.", ssh_target_command),
+		props,
+		evidence,
+		"All OK.",
+	)
+	return []*Observation{obs}, nil, nil
+}
+
+// checkTitle prefers the title configured on the check over the default
+func checkTitle(check Check, fallback string) string {
+	if check.Title != "" {
+		return check.Title
+	}
+	return fallback
+}
+
+// checkName identifies a check in logs by its id, title or command
+func checkName(check Check) string {
+	switch {
+	case check.Id != "":
+		return check.Id
+	case check.Title != "":
+		return fmt.Sprintf("%q", check.Title)
+	case check.Type != "" && check.Type != CheckTypeCommand:
+		return check.Type
+	}
+	return fmt.Sprintf("%q", check.Command)
+}
+
+// newObservation creates an observation collected now which expires in a month
+func newObservation(title string, description string, props []*Property, evidence []*Evidence, remarks string) *Observation {
+	return &Observation{
+		Id:               uuid.New().String(),
+		Title:            title,
+		Description:      description,
+		Collected:        time.Now().Format(time.RFC3339),
+		Expires:          time.Now().AddDate(0, 1, 0).Format(time.RFC3339), // Add one month for the expiration
+		Links:            []*Link{},
+		Props:            props,
+		RelevantEvidence: evidence,
+		Remarks:          remarks,
+	}
+}
+
+// newFinding creates a finding related to the given observation
+func newFinding(obs *Observation, title string, description string, remarks string, props []*Property) *Finding {
+	return &Finding{
+		Id:                  uuid.New().String(),
+		Title:               title,
+		Description:         description,
+		Remarks:             remarks,
+		Props:               props,
+		RelatedObservations: []string{obs.Id},
+	}
+}
+
+// checkProps returns the properties identifying a check
+func checkProps(check Check) []*Property {
+	props := []*Property{}
+	if check.Id != "" {
+		props = append(props, &Property{Name: "Check", Value: check.Id})
+	}
+	return props
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// ConfigFileCheck asserts on the effective keys of a configuration file
+type ConfigFileCheck struct {
+	Path   string `json:"path" yaml:"path"`
+	Format string `json:"format" yaml:"format"`
+
+	// Separator and CommentPrefixes override the keyvalue and ini defaults
+	Separator       string   `json:"separator,omitempty" yaml:"separator,omitempty"`
+	CommentPrefixes []string `json:"comment_prefixes,omitempty" yaml:"comment_prefixes,omitempty"`
+
+	// Include names the directive including other files, e.g. "include" or
+	// "@include". sshd includes are always followed.
+	Include     string `json:"include,omitempty" yaml:"include,omitempty"`
+	IncludeBase string `json:"include_base,omitempty" yaml:"include_base,omitempty"`
+
+	// NoDuplicates raises a Finding for keys assigned more than once
+	NoDuplicates bool `json:"no_duplicates,omitempty" yaml:"no_duplicates,omitempty"`
+
+	Assertions []ConfigAssertion `json:"assertions" yaml:"assertions"`
+}
+
+// ConfigAssertion is a rule on the effective value of a key. Op is one of eq,
+// ne, in, not_in, matches, present, absent, gte and lte, default eq.
+type ConfigAssertion struct {
+	Section string   `json:"section,omitempty" yaml:"section,omitempty"`
+	Key     string   `json:"key" yaml:"key"`
+	Op      string   `json:"op,omitempty" yaml:"op,omitempty"`
+	Value   string   `json:"value,omitempty" yaml:"value,omitempty"`
+	Values  []string `json:"values,omitempty" yaml:"values,omitempty"`
+
+	// IgnoreCase compares values without case
+	IgnoreCase bool `json:"ignore_case,omitempty" yaml:"ignore_case,omitempty"`
+}
+
+// String describes the assertion for findings
+func (a ConfigAssertion) String() string {
+	key := a.Key
+	if a.Section != "" {
+		key = fmt.Sprintf("[%s] %s", a.Section, a.Key)
+	}
+	op := a.Op
+	if op == "" {
+		op = "eq"
+	}
+	switch op {
+	case "present", "absent":
+		return fmt.Sprintf("%s is %s", key, op)
+	case "in", "not_in":
+		return fmt.Sprintf("%s %s [%s]", key, op, strings.Join(a.Values, ", "))
+	}
+	return fmt.Sprintf("%s %s %s", key, op, a.Value)
+}
+
+// Evaluate checks the assertion against the document, returning a reason
+// when it fails
+func (a ConfigAssertion) Evaluate(doc *ConfigDocument) (bool, string, error) {
+	value, found := doc.Get(a.Section, a.Key)
+	op := a.Op
+	if op == "" {
+		op = "eq"
+	}
+	equal := func(x string, y string) bool {
+		if a.IgnoreCase {
+			return strings.EqualFold(x, y)
+		}
+		return x == y
+	}
+
+	switch op {
+	case "present":
+		return found, "the key is not set", nil
+	case "absent":
+		return !found, fmt.Sprintf("the key is set to %q", value), nil
+	}
+	if !found {
+		if op == "ne" || op == "not_in" {
+			return true, "", nil
+		}
+		return false, "the key is not set", nil
+	}
+
+	switch op {
+	case "eq":
+		return equal(value, a.Value), fmt.Sprintf("the value is %q", value), nil
+	case "ne":
+		return !equal(value, a.Value), fmt.Sprintf("the value is %q", value), nil
+	case "in", "not_in":
+		in := false
+		for _, allowed := range a.Values {
+			if equal(value, allowed) {
+				in = true
+			}
+		}
+		return in == (op == "in"), fmt.Sprintf("the value is %q", value), nil
+	case "matches":
+		re, err := regexp.Compile(a.Value)
+		if err != nil {
+			return false, "", fmt.Errorf("invalid pattern %q: %v", a.Value, err)
+		}
+		return re.MatchString(value), fmt.Sprintf("the value is %q", value), nil
+	case "gte", "lte":
+		limit, err := strconv.ParseFloat(a.Value, 64)
+		if err != nil {
+			return false, "", fmt.Errorf("invalid number %q: %v", a.Value, err)
+		}
+		actual, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false, fmt.Sprintf("the value %q is not a number", value), nil
+		}
+		if op == "gte" {
+			return actual >= limit, fmt.Sprintf("the value is %q", value), nil
+		}
+		return actual <= limit, fmt.Sprintf("the value is %q", value), nil
+	}
+	return false, "", fmt.Errorf("unknown assertion op %q", op)
+}
+
+func runConfigFileCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	if check.ConfigFile == nil || check.ConfigFile.Path == "" || check.ConfigFile.Format == "" {
+		return nil, nil, fmt.Errorf("config_file check requires a path and a format")
+	}
+	settings := *check.ConfigFile
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	props := append([]*Property{
+		{Name: "Path", Value: settings.Path},
+		{Name: "Format", Value: settings.Format},
+	}, checkProps(check)...)
+
+	content, found, err := ReadRemoteFile(client, settings.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		obs := newObservation(
+			checkTitle(check, "Configuration File Assertions"),
+			fmt.Sprintf("%s could not be read on %s.", settings.Path, target),
+			props,
+			[]*Evidence{},
+			"The file should exist.",
+		)
+		fndng := newFinding(
+			obs,
+			"Configuration File Missing",
+			fmt.Sprintf("%s is missing or unreadable on %s.", settings.Path, target),
+			fmt.Sprintf("Deploy %s.", settings.Path),
+			props,
+		)
+		return []*Observation{obs}, []*Finding{fndng}, nil
+	}
+
+	options := ConfigParseOptions{
+		Separator:        settings.Separator,
+		CommentPrefixes:  settings.CommentPrefixes,
+		IncludeDirective: settings.Include,
+		IncludeBase:      settings.IncludeBase,
+	}
+	doc, err := ParseConfig(settings.Format, settings.Path, content, options, RemoteFileLoader(client))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	findings := []*Finding{}
+	obs := newObservation(
+		checkTitle(check, "Configuration File Assertions"),
+		fmt.Sprintf("Parsed %s on %s as %s across %d files.", settings.Path, target, settings.Format, len(doc.Files)),
+		props,
+		[]*Evidence{},
+		"All OK.",
+	)
+	for _, assertion := range settings.Assertions {
+		ok, reason, err := assertion.Evaluate(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			continue
+		}
+		location := settings.Path
+		if entry, set := doc.Lookup(assertion.Section, assertion.Key); set && entry.Line > 0 {
+			location = fmt.Sprintf("%s:%d", entry.File, entry.Line)
+		}
+		obs.RelevantEvidence = append(obs.RelevantEvidence, &Evidence{
+			Title:       assertion.String(),
+			Description: fmt.Sprintf("Failed at %s: %s.", location, reason),
+		})
+		findings = append(findings, newFinding(
+			obs,
+			"Configuration Assertion Failed",
+			fmt.Sprintf("%s on %s: expected %s, but %s.", location, target, assertion, reason),
+			fmt.Sprintf("Update %s so that %s.", settings.Path, assertion),
+			append([]*Property{
+				{Name: "Path", Value: settings.Path},
+				{Name: "Key", Value: assertion.Key},
+				{Name: "Section", Value: assertion.Section},
+			}, checkProps(check)...),
+		))
+	}
+
+	if settings.NoDuplicates {
+		for _, entry := range doc.Duplicates() {
+			location := fmt.Sprintf("%s:%d", entry.File, entry.Line)
+			findings = append(findings, newFinding(
+				obs,
+				"Duplicate Configuration Key",
+				fmt.Sprintf("%s is assigned more than once on %s, again at %s.", entry.Key, target, location),
+				fmt.Sprintf("Remove the duplicate %s so the effective value is unambiguous.", entry.Key),
+				append([]*Property{
+					{Name: "Path", Value: entry.File},
+					{Name: "Key", Value: entry.Key},
+					{Name: "Section", Value: entry.Section},
+				}, checkProps(check)...),
+			))
+		}
+	}
+
+	if len(findings) > 0 {
+		obs.Remarks = fmt.Sprintf("%d configuration problems were found.", len(findings))
+	}
+	return []*Observation{obs}, findings, nil
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Supported configuration formats
+const (
+	FormatKeyValue   = "keyvalue"
+	FormatDirectives = "directives"
+	FormatINI        = "ini"
+	FormatSSHD       = "sshd"
+	FormatSystemd    = "systemd"
+	FormatJSON       = "json"
+	FormatYAML       = "yaml"
+	FormatTOML       = "toml"
+)
+
+// maxIncludeDepth bounds nested includes, which may otherwise loop
+const maxIncludeDepth = 8
+
+// multiValueKeys are keys a format allows to be assigned more than once,
+// each assignment adding a value rather than replacing the last
+var multiValueKeys = map[string][]string{
+	FormatSSHD: {
+		"HostKey", "HostCertificate", "Port", "ListenAddress", "AllowUsers", "AllowGroups",
+		"DenyUsers", "DenyGroups", "AcceptEnv", "Subsystem",
+	},
+	FormatSystemd: {
+		"After", "Before", "Wants", "Requires", "Requisite", "BindsTo", "PartOf", "Conflicts",
+		"WantedBy", "RequiredBy", "Also", "Alias", "Environment", "EnvironmentFile",
+		"ExecStartPre", "ExecStart", "ExecStartPost", "ExecReload", "ExecStop", "ExecStopPost",
+		"ReadWritePaths", "ReadOnlyPaths", "InaccessiblePaths", "ListenStream", "ListenDatagram",
+	},
+}
+
+// systemdUnitDirs are the unit directories in order of precedence. Drop-ins
+// of a unit are read from all of them, a file masking those of the same name
+// in later directories.
+var systemdUnitDirs = []string{"/etc/systemd/system", "/run/systemd/system", "/usr/local/lib/systemd/system", "/usr/lib/systemd/system", "/lib/systemd/system"}
+
+// ConfigEntry is a single key assignment in a configuration file. Section is
+// the INI or systemd section, the sshd Match block, or empty at the top
+// level. Structured formats use dotted keys such as "server.tls.enabled".
+type ConfigEntry struct {
+	Section string
+	Key     string
+	Value   string
+	File    string
+	Line    int
+}
+
+// ConfigDocument holds the entries of a configuration file and its includes
+// in the order they are read, along with the rules for resolving them
+type ConfigDocument struct {
+	Format  string
+	Entries []ConfigEntry
+	Files   []string
+
+	// FirstWins selects the first assignment of a duplicate key as the
+	// effective one, as sshd does. Otherwise the last one wins.
+	FirstWins bool
+
+	// CaseInsensitive compares keys and sections without case
+	CaseInsensitive bool
+}
+
+// ConfigParseOptions tune the line based parsers
+type ConfigParseOptions struct {
+	// Separator between keys and values for keyvalue and ini, default "="
+	Separator string
+
+	// CommentPrefixes default to "#" and, for ini, ";"
+	CommentPrefixes []string
+
+	// IncludeDirective names the directive including other files, e.g.
+	// "include". sshd always uses Include.
+	IncludeDirective string
+
+	// IncludeBase resolves relative include paths
+	IncludeBase string
+}
+
+func (d *ConfigDocument) same(a string, b string) bool {
+	if d.CaseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// GetAll returns every value assigned to the key in the section, in order.
+// For systemd an empty assignment resets the list.
+func (d *ConfigDocument) GetAll(section string, key string) []string {
+	values := []string{}
+	for _, entry := range d.Entries {
+		if !d.same(entry.Section, section) || !d.same(entry.Key, key) {
+			continue
+		}
+		if d.Format == FormatSystemd && entry.Value == "" {
+			values = []string{}
+			continue
+		}
+		values = append(values, entry.Value)
+	}
+	return values
+}
+
+// Get returns the effective value of the key in the section
+func (d *ConfigDocument) Get(section string, key string) (string, bool) {
+	entry, ok := d.Lookup(section, key)
+	return entry.Value, ok
+}
+
+// Lookup returns the entry providing the effective value of the key
+func (d *ConfigDocument) Lookup(section string, key string) (ConfigEntry, bool) {
+	var found ConfigEntry
+	ok := false
+	for _, entry := range d.Entries {
+		if !d.same(entry.Section, section) || !d.same(entry.Key, key) {
+			continue
+		}
+		if d.FirstWins {
+			return entry, true
+		}
+		found = entry
+		ok = true
+	}
+	return found, ok
+}
+
+// Duplicates returns the keys assigned more than once within a section,
+// other than those the format allows to repeat. For systemd an empty
+// assignment resets the key.
+func (d *ConfigDocument) Duplicates() []ConfigEntry {
+	seen := map[string]bool{}
+	duplicates := []ConfigEntry{}
+	for _, entry := range d.Entries {
+		if slices.ContainsFunc(multiValueKeys[d.Format], func(key string) bool { return d.same(key, entry.Key) }) {
+			continue
+		}
+		id := entry.Section + "\x00" + entry.Key
+		if d.CaseInsensitive {
+			id = strings.ToLower(id)
+		}
+		if d.Format == FormatSystemd && entry.Value == "" {
+			delete(seen, id)
+			continue
+		}
+		if seen[id] {
+			duplicates = append(duplicates, entry)
+		}
+		seen[id] = true
+	}
+	return duplicates
+}
+
+// Sections returns the distinct sections in order of appearance
+func (d *ConfigDocument) Sections() []string {
+	sections := []string{}
+	for _, entry := range d.Entries {
+		if !contains(sections, entry.Section) {
+			sections = append(sections, entry.Section)
+		}
+	}
+	return sections
+}
+
+// ParseConfig parses a configuration file in the given format. Includes are
+// loaded through load, which may be nil if includes are not followed.
+func ParseConfig(format string, file string, content string, options ConfigParseOptions, load FileLoader) (*ConfigDocument, error) {
+	doc := &ConfigDocument{Format: format}
+	switch format {
+	case FormatSSHD:
+		doc.FirstWins = true
+		doc.CaseInsensitive = true
+		options.IncludeDirective = "Include"
+		if options.IncludeBase == "" {
+			options.IncludeBase = "/etc/ssh"
+		}
+	case FormatSystemd:
+		options.CommentPrefixes = []string{"#", ";"}
+	case FormatINI:
+		if len(options.CommentPrefixes) == 0 {
+			options.CommentPrefixes = []string{"#", ";"}
+		}
+	case FormatKeyValue, FormatDirectives:
+	case FormatJSON, FormatYAML, FormatTOML:
+		entries, err := parseStructuredConfig(format, file, content)
+		if err != nil {
+			return nil, err
+		}
+		doc.Entries = entries
+		doc.Files = []string{file}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown config format %q", format)
+	}
+	if options.Separator == "" {
+		options.Separator = "="
+	}
+	if len(options.CommentPrefixes) == 0 {
+		options.CommentPrefixes = []string{"#"}
+	}
+
+	parser := &lineConfigParser{doc: doc, options: options, load: load}
+	if err := parser.parse(file, content, "", 0); err != nil {
+		return nil, err
+	}
+	if format == FormatSystemd {
+		if err := parser.dropIns(file); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+type lineConfigParser struct {
+	doc     *ConfigDocument
+	options ConfigParseOptions
+	load    FileLoader
+}
+
+func (p *lineConfigParser) parse(file string, content string, section string, depth int) error {
+	p.doc.Files = append(p.doc.Files, file)
+	format := p.doc.Format
+	for index, line := range joinContinuations(content) {
+		line_number := index + 1
+		line = strings.TrimSpace(line)
+		if line == "" || p.isComment(line) {
+			continue
+		}
+
+		// Sections
+		if (format == FormatINI || format == FormatSystemd) && strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		var key, value string
+		switch format {
+		case FormatKeyValue, FormatINI, FormatSystemd:
+			k, v, ok := strings.Cut(line, p.options.Separator)
+			if !ok {
+				// A key without a value, e.g. an INI flag or an include
+				k = line
+			}
+			key, value = strings.TrimSpace(k), unquoteConfigValue(strings.TrimSpace(v))
+			if p.options.IncludeDirective != "" && !ok {
+				if directive, rest, found := strings.Cut(line, " "); found && directive == p.options.IncludeDirective {
+					key, value = directive, strings.TrimSpace(rest)
+				}
+			}
+		case FormatDirectives, FormatSSHD:
+			fields := strings.Fields(line)
+			key = fields[0]
+			value = strings.TrimSpace(strings.TrimPrefix(line, key))
+			// sshd also accepts "Key=value"
+			if k, v, ok := strings.Cut(key, "="); ok && format == FormatSSHD {
+				key = k
+				value = strings.TrimSpace(v + " " + value)
+			}
+		}
+
+		if format == FormatSSHD && strings.EqualFold(key, "Match") {
+			section = "Match " + value
+			if strings.EqualFold(value, "all") {
+				section = ""
+			}
+			continue
+		}
+
+		if p.options.IncludeDirective != "" && p.doc.same(key, p.options.IncludeDirective) {
+			if err := p.include(value, section, depth); err != nil {
+				return fmt.Errorf("%s:%d: %v", file, line_number, err)
+			}
+			continue
+		}
+
+		p.doc.Entries = append(p.doc.Entries, ConfigEntry{
+			Section: section,
+			Key:     key,
+			Value:   value,
+			File:    file,
+			Line:    line_number,
+		})
+	}
+	return nil
+}
+
+// include parses the files named by an include directive in place, within
+// the current section
+func (p *lineConfigParser) include(value string, section string, depth int) error {
+	if p.load == nil {
+		return nil
+	}
+	if depth >= maxIncludeDepth {
+		return fmt.Errorf("includes nested too deeply")
+	}
+	for _, pattern := range strings.Fields(value) {
+		if !strings.HasPrefix(pattern, "/") && p.options.IncludeBase != "" {
+			pattern = path.Join(p.options.IncludeBase, pattern)
+		}
+		files, err := p.load(pattern)
+		if err != nil {
+			return err
+		}
+		// Globs are expanded in lexical order
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+		for _, included := range files {
+			if err := p.parse(included.Path, included.Content, section, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dropIns parses the *.conf files of the drop-in directories of a systemd
+// file in order of their names, after the file itself
+func (p *lineConfigParser) dropIns(file string) error {
+	if p.load == nil {
+		return nil
+	}
+	dirs := []string{path.Dir(file)}
+	if slices.Contains(systemdUnitDirs, dirs[0]) {
+		dirs = systemdUnitDirs
+	}
+	byName := map[string]IncludedFile{}
+	for _, dir := range dirs {
+		files, err := p.load(path.Join(dir, path.Base(file)+".d", "*.conf"))
+		if err != nil {
+			return err
+		}
+		for _, dropIn := range files {
+			if _, masked := byName[path.Base(dropIn.Path)]; !masked {
+				byName[path.Base(dropIn.Path)] = dropIn
+			}
+		}
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := p.parse(byName[name].Path, byName[name].Content, "", 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *lineConfigParser) isComment(line string) bool {
+	for _, prefix := range p.options.CommentPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// unquoteConfigValue removes matching surrounding quotes
+func unquoteConfigValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// parseStructuredConfig flattens a JSON, YAML or TOML document into dotted
+// keys. Array elements are addressed by index, e.g. "servers.0.name".
+func parseStructuredConfig(format string, file string, content string) ([]ConfigEntry, error) {
+	var data interface{}
+	var err error
+	switch format {
+	case FormatJSON:
+		// Numbers are kept as written rather than rounded through float64
+		decoder := json.NewDecoder(strings.NewReader(content))
+		decoder.UseNumber()
+		if err = decoder.Decode(&data); err == nil && decoder.More() {
+			err = fmt.Errorf("unexpected data after the top-level value")
+		}
+	case FormatYAML:
+		err = yaml.Unmarshal([]byte(content), &data)
+	case FormatTOML:
+		var table map[string]interface{}
+		_, err = toml.Decode(content, &table)
+		data = table
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s as %s: %v", file, format, err)
+	}
+	entries := []ConfigEntry{}
+	flattenConfig("", data, file, &entries)
+	return entries, nil
+}
+
+func flattenConfig(prefix string, value interface{}, file string, entries *[]ConfigEntry) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			flattenConfig(join(key), v[key], file, entries)
+		}
+	case map[interface{}]interface{}:
+		keys := make([]string, 0, len(v))
+		values := map[string]interface{}{}
+		for key, item := range v {
+			name := fmt.Sprint(key)
+			keys = append(keys, name)
+			values[name] = item
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			flattenConfig(join(key), values[key], file, entries)
+		}
+	case []interface{}:
+		for i, item := range v {
+			flattenConfig(join(strconv.Itoa(i)), item, file, entries)
+		}
+	case []map[string]interface{}:
+		// TOML arrays of tables
+		for i, item := range v {
+			flattenConfig(join(strconv.Itoa(i)), item, file, entries)
+		}
+	case nil:
+		*entries = append(*entries, ConfigEntry{Key: prefix, File: file})
+	default:
+		*entries = append(*entries, ConfigEntry{Key: prefix, Value: fmt.Sprint(v), File: file})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"path"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// mapLoader expands include patterns against the files
+func mapLoader(files map[string]string) FileLoader {
+	return func(pattern string) ([]IncludedFile, error) {
+		included := []IncludedFile{}
+		for file, content := range files {
+			if ok, _ := path.Match(pattern, file); ok {
+				included = append(included, IncludedFile{Path: file, Content: content})
+			}
+		}
+		return included, nil
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		options ConfigParseOptions
+		section string
+		key     string
+		want    string
+		found   bool
+	}{
+		{"keyvalue last wins", FormatKeyValue, "a = 1\na = \"2\"\n", ConfigParseOptions{}, "", "a", "2", true},
+		{"keyvalue separator", FormatKeyValue, "a: 1\n", ConfigParseOptions{Separator: ":"}, "", "a", "1", true},
+		{"ini section", FormatINI, "; comment\n[mysqld]\nbind-address = 127.0.0.1\n", ConfigParseOptions{}, "mysqld", "bind-address", "127.0.0.1", true},
+		{"sshd first wins", FormatSSHD, "PermitRootLogin no\npermitrootlogin yes\n", ConfigParseOptions{}, "", "PermitRootLogin", "no", true},
+		{"sshd equals", FormatSSHD, "PasswordAuthentication=no\n", ConfigParseOptions{}, "", "PasswordAuthentication", "no", true},
+		{"sshd match", FormatSSHD, "Match User backup\n  X11Forwarding yes\nMatch all\nX11Forwarding no\n", ConfigParseOptions{}, "Match User backup", "X11Forwarding", "yes", true},
+		{"systemd continuation", FormatSystemd, "[Service]\nExecStart=/usr/bin/app\\\n--flag\n", ConfigParseOptions{}, "Service", "ExecStart", "/usr/bin/app --flag", true},
+		{"directives", FormatDirectives, "server_tokens off;\n", ConfigParseOptions{}, "", "server_tokens", "off;", true},
+		{"missing", FormatKeyValue, "a = 1\n", ConfigParseOptions{}, "", "b", "", false},
+		{"json", FormatJSON, `{"server": {"tls": {"enabled": true}}, "ports": [80, 443]}`, ConfigParseOptions{}, "", "ports.1", "443", true},
+		{"json large integer", FormatJSON, `{"id": 12345678901234567890}`, ConfigParseOptions{}, "", "id", "12345678901234567890", true},
+		{"json decimal", FormatJSON, `{"ratio": 0.10}`, ConfigParseOptions{}, "", "ratio", "0.10", true},
+		{"yaml", FormatYAML, "server:\n  tls:\n    enabled: true\n", ConfigParseOptions{}, "", "server.tls.enabled", "true", true},
+		{"toml", FormatTOML, "[[servers]]\nname = \"a\"\n", ConfigParseOptions{}, "", "servers.0.name", "a", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := ParseConfig(test.format, "/etc/test.conf", test.content, test.options, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, found := doc.Get(test.section, test.key)
+			if found != test.found || value != test.want {
+				t.Errorf("expected %q %t, got %q %t", test.want, test.found, value, found)
+			}
+		})
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		format  string
+		content string
+	}{
+		{"xml", "<a/>"},
+		{FormatJSON, `{"a": 1} {"b": 2}`},
+		{FormatJSON, `{"a": `},
+		{FormatYAML, "a: [1"},
+		{FormatTOML, "a = "},
+	}
+	for _, test := range tests {
+		if _, err := ParseConfig(test.format, "/etc/test.conf", test.content, ConfigParseOptions{}, nil); err == nil {
+			t.Errorf("%s %q: expected an error", test.format, test.content)
+		}
+	}
+}
+
+func TestParseConfigIncludes(t *testing.T) {
+	files := map[string]string{
+		"/etc/ssh/sshd_config.d/50-cloud.conf": "PasswordAuthentication yes\n",
+		"/etc/ssh/sshd_config.d/10-cis.conf":   "PasswordAuthentication no\nInclude /etc/ssh/loop.conf\n",
+		"/etc/ssh/loop.conf":                   "Include /etc/ssh/loop.conf\n",
+	}
+	content := "Include sshd_config.d/*.conf\nPasswordAuthentication yes\n"
+	_, err := ParseConfig(FormatSSHD, "/etc/ssh/sshd_config", content, ConfigParseOptions{}, mapLoader(files))
+	if err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+		t.Fatalf("expected the include loop to be reported, got %v", err)
+	}
+
+	delete(files, "/etc/ssh/loop.conf")
+	files["/etc/ssh/sshd_config.d/10-cis.conf"] = "PasswordAuthentication no\n"
+	doc, err := ParseConfig(FormatSSHD, "/etc/ssh/sshd_config", content, ConfigParseOptions{}, mapLoader(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := doc.Lookup("", "PasswordAuthentication")
+	if entry.Value != "no" || entry.File != "/etc/ssh/sshd_config.d/10-cis.conf" {
+		t.Errorf("expected the first include in lexical order to win, got %+v", entry)
+	}
+}
+
+func TestParseConfigSystemdDropIns(t *testing.T) {
+	unit := "[Service]\nExecStart=/usr/sbin/sshd -D\nProtectSystem=full\nEnvironment=A=1\n"
+	files := map[string]string{
+		"/usr/lib/systemd/system/sshd.service.d/10-vendor.conf":    "[Service]\nProtectSystem=true\n",
+		"/usr/lib/systemd/system/sshd.service.d/20-hardening.conf": "[Service]\nProtectSystem=false\n",
+		"/etc/systemd/system/sshd.service.d/20-hardening.conf":     "[Service]\nProtectSystem=strict\nExecStart=\nExecStart=/usr/sbin/sshd -D -e\n",
+		"/run/systemd/system/sshd.service.d/30-env.conf":           "[Service]\nEnvironment=B=2\n",
+	}
+	doc, err := ParseConfig(FormatSystemd, "/usr/lib/systemd/system/sshd.service", unit, ConfigParseOptions{}, mapLoader(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := []string{
+		"/usr/lib/systemd/system/sshd.service",
+		"/usr/lib/systemd/system/sshd.service.d/10-vendor.conf",
+		"/etc/systemd/system/sshd.service.d/20-hardening.conf",
+		"/run/systemd/system/sshd.service.d/30-env.conf",
+	}
+	if !slices.Equal(doc.Files, wantFiles) {
+		t.Errorf("expected the drop-ins by name with /etc masking /usr/lib, got %v", doc.Files)
+	}
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"ProtectSystem", []string{"full", "true", "strict"}},
+		{"ExecStart", []string{"/usr/sbin/sshd -D -e"}},
+		{"Environment", []string{"A=1", "B=2"}},
+	}
+	for _, test := range tests {
+		if values := doc.GetAll("Service", test.key); !slices.Equal(values, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.key, test.want, values)
+		}
+	}
+
+	// Files outside the unit directories only have their own drop-ins
+	files = map[string]string{
+		"/etc/systemd/journald.conf.d/forward.conf":  "[Journal]\nForwardToSyslog=yes\n",
+		"/etc/systemd/system/journald.conf.d/x.conf": "[Journal]\nForwardToSyslog=no\n",
+	}
+	doc, err = ParseConfig(FormatSystemd, "/etc/systemd/journald.conf", "[Journal]\n", ConfigParseOptions{}, mapLoader(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := doc.Get("Journal", "ForwardToSyslog"); value != "yes" {
+		t.Errorf("expected the journald drop-in, got %q", value)
+	}
+}
+
+func TestConfigDuplicates(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		want    []string
+	}{
+		{"sshd multi-value keys", FormatSSHD, "Port 22\nPort 2222\nHostKey /a\nHostKey /b\nListenAddress 0.0.0.0\nlistenaddress ::\nAllowUsers a\nAllowUsers b\n", nil},
+		{"sshd repeated key", FormatSSHD, "PermitRootLogin no\npermitrootlogin yes\n", []string{"permitrootlogin"}},
+		{"sshd match blocks", FormatSSHD, "X11Forwarding no\nMatch User a\nX11Forwarding yes\n", nil},
+		{"systemd reset", FormatSystemd, "[Service]\nUser=a\nUser=\nUser=b\n", nil},
+		{"systemd repeated key", FormatSystemd, "[Service]\nUser=a\nUser=b\nExecStartPre=/a\nExecStartPre=/b\n", []string{"User"}},
+		{"keyvalue", FormatKeyValue, "Port = 1\nPort = 2\n", []string{"Port"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := ParseConfig(test.format, "/etc/test.conf", test.content, ConfigParseOptions{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys := []string{}
+			for _, entry := range doc.Duplicates() {
+				keys = append(keys, entry.Key)
+			}
+			if !slices.Equal(keys, test.want) {
+				t.Errorf("expected duplicates %v, got %v", test.want, keys)
+			}
+		})
+	}
+}
+
+func TestConfigFileCheckDuplicates(t *testing.T) {
+	files := map[string]string{
+		"/etc/ssh/sshd_config": "Port 22\nPort 2222\nPermitRootLogin no\nPermitRootLogin yes\n",
+	}
+	check := Check{Id: "sshd", Type: "config_file", ConfigFile: &ConfigFileCheck{Path: "/etc/ssh/sshd_config", Format: FormatSSHD, NoDuplicates: true}}
+	_, findings, err := runCheckAgainst(t, remoteFilesHandler(files, nil), check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || !strings.Contains(findings[0].Description, "PermitRootLogin is assigned more than once") {
+		t.Errorf("expected only PermitRootLogin to be reported, got %v", findings)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultAuthFailureWindow is how long authentication failures are counted
+// when no window is configured, matching common lockout observation windows
+const defaultAuthFailureWindow = 30 * time.Minute
+
+// errCredentialSuspended is returned when every credential of a target has
+// exhausted its authentication failure budget
+var errCredentialSuspended = errors.New("credential suspended")
+
+// errAuthFailed marks a connection attempt rejected by authentication
+var errAuthFailed = errors.New("authentication failed")
+
+// Credential is a login tried when the previous ones are rejected
+type Credential struct {
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+}
+
+// CredentialList returns Username and Password followed by Credentials,
+// leaving out repeated ones
+func (c SSHConfig) CredentialList() []Credential {
+	credentials := []Credential{}
+	if c.Username != "" || len(c.Credentials) == 0 {
+		credentials = append(credentials, Credential{Username: c.Username, Password: c.Password})
+	}
+	for _, credential := range c.Credentials {
+		if !slices.Contains(credentials, credential) {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials
+}
+
+// validate rejects an authentication failure window which is not a positive
+// duration, rather than counting failures over the default window
+func (c SSHConfig) validate() error {
+	if c.AuthFailureWindow == "" {
+		return nil
+	}
+	if window, err := time.ParseDuration(c.AuthFailureWindow); err != nil || window <= 0 {
+		return fmt.Errorf("invalid auth_failure_window %q: must be a positive duration", c.AuthFailureWindow)
+	}
+	return nil
+}
+
+// AuthWindow returns the configured authentication failure window
+func (c SSHConfig) AuthWindow() time.Duration {
+	if window, err := time.ParseDuration(c.AuthFailureWindow); err == nil && window > 0 {
+		return window
+	}
+	return defaultAuthFailureWindow
+}
+
+// isAuthFailure reports whether a dial error is an authentication rejection
+// rather than a network or protocol failure
+func isAuthFailure(err error) bool {
+	return strings.Contains(err.Error(), "unable to authenticate")
+}
+
+// authBudget counts authentication failures per user across all targets,
+// as central lockout policies count them per account. Attempts in flight
+// could all fail, so attempts beyond the remaining budget wait for them to
+// settle rather than overrun it.
+type authBudget struct {
+	mu       sync.Mutex
+	settled  *sync.Cond
+	failures map[string][]time.Time
+	inflight map[string]int
+}
+
+func newAuthBudget() *authBudget {
+	b := &authBudget{
+		failures: map[string][]time.Time{},
+		inflight: map[string]int{},
+	}
+	b.settled = sync.NewCond(&b.mu)
+	return b
+}
+
+// reserve reports whether an attempt with the user is allowed, unlimited
+// when the budget is zero, and holds it until settled. It waits while the
+// attempts in flight take up the remaining budget, and refuses the user
+// only once the recorded failures reach the budget.
+func (b *authBudget) reserve(user string, budget int, window time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		failures := b.failures[user]
+		cutoff := time.Now().Add(-window)
+		for len(failures) > 0 && failures[0].Before(cutoff) {
+			failures = failures[1:]
+		}
+		b.failures[user] = failures
+		if budget > 0 && len(failures) >= budget {
+			return false
+		}
+		if budget <= 0 || len(failures)+b.inflight[user] < budget {
+			b.inflight[user]++
+			return true
+		}
+		b.settled.Wait()
+	}
+}
+
+// settle releases a reserved attempt, counting it if authentication failed
+func (b *authBudget) settle(user string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inflight[user]--
+	if failed {
+		b.failures[user] = append(b.failures[user], time.Now())
+	}
+	b.settled.Broadcast()
+}
+
+// Failures returns the authentication failures counted for the user
+func (b *authBudget) Failures(user string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.failures[user])
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+)
+
+func TestFallbackCredential(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+	config := server.SSHConfig()
+	config.Password = "wrong"
+	config.Credentials = []Credential{{Username: "audit", Password: "secret"}}
+	config.Command = "true"
+
+	pool := NewConnectionPool(PoolOptions{})
+	defer pool.Close()
+	result, err := RunAssessment(pool, config, nil)
+	if err != nil {
+		t.Fatalf("expected the second credential to connect: %v", err)
+	}
+	if result.Status != ExecutionStatus_SUCCESS || len(result.Observations) != 1 {
+		t.Fatalf("expected the check to run, got %v with logs %v", result.Status, failedChecks(result))
+	}
+	if failures := pool.auth.Failures("audit"); failures != 1 {
+		t.Errorf("expected the rejected password to be counted once, got %d", failures)
+	}
+}
+
+func TestAuthFailureBudgetSuspendsCredential(t *testing.T) {
+	pool := NewConnectionPool(PoolOptions{})
+	defer pool.Close()
+
+	// Each host rejects the password until the budget of two is spent
+	for i := 0; i < 4; i++ {
+		server := newTestServer(t, echoHandler)
+		config := server.SSHConfig()
+		config.Password = "wrong"
+		config.Command = "true"
+		config.AuthFailureBudget = 2
+
+		result, err := RunAssessment(pool, config, nil)
+		if i < 2 {
+			if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+				t.Fatalf("host %d: expected an authentication failure, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("host %d: expected a suspended result, got %v", i, err)
+		}
+		if result.Status != ExecutionStatus_FAILURE || len(result.Observations) != 1 || result.Observations[0].Title != "SSH Credential Suspended" {
+			t.Fatalf("host %d: expected the credential to be suspended, got %v", i, result)
+		}
+		if server.Connections() != 0 {
+			t.Errorf("host %d: expected no connection with a suspended credential", i)
+		}
+	}
+	if failures := pool.auth.Failures("audit"); failures != 2 {
+		t.Errorf("expected the failures to stop at the budget, got %d", failures)
+	}
+}
+
+func TestAuthFailuresAreNotRetried(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	server := newTestServer(t, echoHandler)
+	config := server.SSHConfig()
+	config.Password = "wrong"
+	config.Command = "true"
+	config.Retries = 3
+
+	pool := NewConnectionPool(PoolOptions{})
+	defer pool.Close()
+	if _, err := RunAssessment(pool, config, nil); err == nil {
+		t.Fatal("expected an authentication failure")
+	}
+	if server.Connections() != 1 {
+		t.Errorf("expected a single attempt, got %d connections", server.Connections())
+	}
+}
+
+// TestConcurrentLoginsWithinBudget assesses more hosts at once than the
+// budget allows failures, and checks that successful logins are not held
+// against it
+func TestConcurrentLoginsWithinBudget(t *testing.T) {
+	pool := NewConnectionPool(PoolOptions{})
+	defer pool.Close()
+
+	const hosts = 8
+	results := make([]*ExecuteResult, hosts)
+	errs := make([]error, hosts)
+	var wg sync.WaitGroup
+	for i := 0; i < hosts; i++ {
+		config := newTestServer(t, echoHandler, Faults{Latency: 5 * time.Millisecond}).SSHConfig()
+		config.Command = "true"
+		config.AuthFailureBudget = 2
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = RunAssessment(pool, config, nil)
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < hosts; i++ {
+		if errs[i] != nil {
+			t.Fatalf("host %d: %v", i, errs[i])
+		}
+		if results[i].Status != ExecutionStatus_SUCCESS || len(results[i].Observations) != 1 {
+			t.Errorf("host %d: expected the host to be assessed, got %v with observations %v", i, results[i].Status, results[i].Observations)
+		}
+	}
+	if failures := pool.auth.Failures("audit"); failures != 0 {
+		t.Errorf("expected no failures, got %d", failures)
+	}
+}
+
+// TestAuthBudgetConcurrentFailures fails many concurrent attempts and checks
+// that the waiting attempts do not overrun the budget
+func TestAuthBudgetConcurrentFailures(t *testing.T) {
+	budget := newAuthBudget()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	refused := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !budget.reserve("audit", 3, time.Hour) {
+				mu.Lock()
+				refused++
+				mu.Unlock()
+				return
+			}
+			time.Sleep(time.Millisecond)
+			budget.settle("audit", true)
+		}()
+	}
+	wg.Wait()
+	if failures := budget.Failures("audit"); failures != 3 || refused != 17 {
+		t.Errorf("expected 3 failures and 17 refused attempts, got %d and %d", failures, refused)
+	}
+}
+
+func TestAuthBudgetWindowExpires(t *testing.T) {
+	budget := newAuthBudget()
+	for i := 0; i < 2; i++ {
+		if !budget.reserve("audit", 2, 50*time.Millisecond) {
+			t.Fatalf("attempt %d: expected the budget to allow it", i)
+		}
+		budget.settle("audit", true)
+	}
+	if budget.reserve("audit", 2, 50*time.Millisecond) {
+		t.Fatal("expected the exhausted budget to suspend the user")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !budget.reserve("audit", 2, 50*time.Millisecond) {
+		t.Fatal("expected the failures to expire after the window")
+	}
+}
+
+func TestCredentialSuspendedError(t *testing.T) {
+	pool := NewConnectionPool(PoolOptions{})
+	defer pool.Close()
+	pool.auth.reserve("audit", 0, time.Hour)
+	pool.auth.settle("audit", true)
+
+	conn := &targetConnection{pool: pool, config: SSHConfig{Username: "audit", Host: "127.0.0.1", Port: "1", AuthFailureBudget: 1}}
+	if err := conn.connect(); !errors.Is(err, errCredentialSuspended) {
+		t.Fatalf("expected the credential to be suspended, got %v", err)
+	}
+}
+
+func TestInvalidAuthFailureWindow(t *testing.T) {
+	for _, window := range []string{"30 minutes", "0s", "-1h"} {
+		yamlString := "host: 127.0.0.1\nusername: audit\nauth_failure_budget: 3\nauth_failure_window: " + window + "\n"
+		if _, err := LoadConfig(yamlString); err == nil || !strings.Contains(err.Error(), "invalid auth_failure_window") {
+			t.Errorf("%q: expected the configuration to be rejected, got %v", window, err)
+		}
+		request := JobRequest{Target: &SSHConfig{Host: "127.0.0.1", Username: "audit", AuthFailureWindow: window}}
+		if _, err := request.Config(); err == nil || !strings.Contains(err.Error(), "invalid auth_failure_window") {
+			t.Errorf("%q: expected the API target to be rejected, got %v", window, err)
+		}
+	}
+	config, err := LoadConfig("host: 127.0.0.1\nauth_failure_window: 1h\n")
+	if err != nil || config.AuthWindow() != time.Hour {
+		t.Errorf("expected a window of 1h, got %v %v", config.AuthWindow(), err)
+	}
+}
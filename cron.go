@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// scheduledTasksScript prints every cron table and periodic script, each
+// preceded by a header with its mode, owner, group and path, followed by the
+// systemd timers with their schedules. Cron tables and spool directories
+// which cannot be read, as when not running as root, are listed as such.
+const scheduledTasksScript = `
+for d in /var/spool/cron/crontabs /var/spool/cron; do
+  [ -d "$d" ] && ! [ -r "$d" ] && printf '==>unreadable %s\n' "$d"
+done
+for f in /etc/crontab /etc/cron.d/* /var/spool/cron/crontabs/* /var/spool/cron/*; do
+  [ -f "$f" ] || continue
+  if ! [ -r "$f" ]; then
+    printf '==>unreadable %s\n' "$f"
+    continue
+  fi
+  printf '==>table %s %s\n' "$(stat -c '%a %U %G' "$f")" "$f"
+  cat "$f"; echo
+done
+for d in /etc/cron.hourly /etc/cron.daily /etc/cron.weekly /etc/cron.monthly; do
+  for f in "$d"/*; do
+    [ -f "$f" ] || continue
+    printf '==>script %s %s\n' "$(stat -c '%a %U %G' "$f")" "$f"
+  done
+done
+systemctl list-timers --all --no-legend --no-pager 2>/dev/null | awk '{print $(NF-1), $NF}' |
+while read -r timer unit; do
+  case "$timer" in *.timer) ;; *) continue ;; esac
+  printf '==>timer %s %s\n' "$timer" "$unit"
+  systemctl show -p TimersCalendar -p TimersMonotonic "$timer" 2>/dev/null
+done
+`
+
+// ScheduledTasksCheck configures the scheduled task inventory check
+type ScheduledTasksCheck struct {
+	Approved []ApprovedJob `json:"approved,omitempty" yaml:"approved,omitempty"`
+}
+
+// ApprovedJob matches jobs by a regular expression on their command and
+// optionally by user and schedule
+type ApprovedJob struct {
+	Command  string `json:"command" yaml:"command"`
+	User     string `json:"user,omitempty" yaml:"user,omitempty"`
+	Schedule string `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+}
+
+// ScheduledJob is a single entry of the scheduled task inventory
+type ScheduledJob struct {
+	Kind     string // cron, periodic or timer
+	Source   string
+	User     string
+	Schedule string
+	Command  string
+}
+
+// ScheduleFile is a cron table or periodic script with its permissions
+type ScheduleFile struct {
+	Path  string
+	Mode  uint64
+	Owner string
+	Group string
+}
+
+// ScheduledTasks is the collected inventory. Unreadable lists the cron
+// tables and spool directories whose jobs could not be collected.
+type ScheduledTasks struct {
+	Files      []ScheduleFile
+	Jobs       []ScheduledJob
+	Unreadable []string
+}
+
+var (
+	cronEnvironmentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\s*=`)
+
+	// timerTriggerRe matches a trigger in the TimersCalendar and
+	// TimersMonotonic properties, such as "{ OnCalendar=daily ; next_elapse=..."
+	timerTriggerRe = regexp.MustCompile(`\{\s*(On[A-Za-z]+)=(.*?)\s*;`)
+)
+
+// ParseScheduledTasks parses the output of scheduledTasksScript run with the
+// section marker. Lines of the cron tables are never taken as headers.
+func ParseScheduledTasks(output string, marker string) ScheduledTasks {
+	tasks := ScheduledTasks{}
+	section := ""
+	var file ScheduleFile
+	for _, line := range strings.Split(output, "\n") {
+		if header, ok := strings.CutPrefix(line, marker); ok {
+			fields := strings.Fields(header)
+			if len(fields) == 0 {
+				section = ""
+				continue
+			}
+			section = fields[0]
+			switch section {
+			case "unreadable":
+				if len(fields) > 1 {
+					tasks.Unreadable = append(tasks.Unreadable, strings.Join(fields[1:], " "))
+				}
+			case "timer":
+				if len(fields) < 3 {
+					section = ""
+					continue
+				}
+				tasks.Jobs = append(tasks.Jobs, ScheduledJob{
+					Kind:    "timer",
+					Source:  fields[1],
+					User:    "root",
+					Command: fields[2],
+				})
+			case "table", "script":
+				if len(fields) < 5 {
+					section = ""
+					continue
+				}
+				mode, _ := strconv.ParseUint(fields[1], 8, 32)
+				file = ScheduleFile{
+					Mode:  mode,
+					Owner: fields[2],
+					Group: fields[3],
+					Path:  strings.Join(fields[4:], " "),
+				}
+				tasks.Files = append(tasks.Files, file)
+				if section == "script" {
+					tasks.Jobs = append(tasks.Jobs, ScheduledJob{
+						Kind:     "periodic",
+						Source:   file.Path,
+						User:     "root",
+						Schedule: strings.TrimPrefix(path.Base(path.Dir(file.Path)), "cron."),
+						Command:  file.Path,
+					})
+				}
+			}
+			continue
+		}
+
+		switch section {
+		case "table":
+			if job, ok := parseCronLine(file.Path, line); ok {
+				tasks.Jobs = append(tasks.Jobs, job)
+			}
+		case "timer":
+			// Each trigger is written as in the unit file, for example
+			// "OnCalendar=*-*-* 00:00:00" or "OnUnitActiveSec=1d"
+			m := timerTriggerRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			job := &tasks.Jobs[len(tasks.Jobs)-1]
+			// systemctl show names monotonic triggers in microseconds
+			trigger := m[1]
+			if strings.HasSuffix(trigger, "USec") {
+				trigger = strings.TrimSuffix(trigger, "USec") + "Sec"
+			}
+			if job.Schedule != "" {
+				job.Schedule += "; "
+			}
+			job.Schedule += trigger + "=" + m[2]
+		}
+	}
+	return tasks
+}
+
+// parseCronLine parses a cron table entry. System tables in /etc carry a
+// user field, while per-user tables in the spool are named after the user.
+func parseCronLine(source string, line string) (ScheduledJob, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || cronEnvironmentRe.MatchString(line) {
+		return ScheduledJob{}, false
+	}
+	systemTable := strings.HasPrefix(source, "/etc/")
+
+	fields := strings.Fields(line)
+	scheduleFields := 5
+	if strings.HasPrefix(fields[0], "@") {
+		scheduleFields = 1
+	}
+	commandField := scheduleFields
+	if systemTable {
+		commandField++
+	}
+	if len(fields) <= commandField {
+		return ScheduledJob{}, false
+	}
+
+	job := ScheduledJob{
+		Kind:     "cron",
+		Source:   source,
+		Schedule: strings.Join(fields[:scheduleFields], " "),
+		Command:  strings.Join(fields[commandField:], " "),
+	}
+	if systemTable {
+		job.User = fields[scheduleFields]
+	} else {
+		job.User = path.Base(source)
+	}
+	return job, true
+}
+
+// Unapproved returns the jobs which match no approved entry
+func (c ScheduledTasksCheck) Unapproved(jobs []ScheduledJob) ([]ScheduledJob, error) {
+	patterns := make([]*regexp.Regexp, len(c.Approved))
+	for i, approved := range c.Approved {
+		re, err := regexp.Compile(approved.Command)
+		if err != nil {
+			return nil, fmt.Errorf("invalid approved job pattern %q: %v", approved.Command, err)
+		}
+		patterns[i] = re
+	}
+
+	unapproved := []ScheduledJob{}
+	for _, job := range jobs {
+		matched := false
+		for i, approved := range c.Approved {
+			if patterns[i].MatchString(job.Command) &&
+				(approved.User == "" || approved.User == job.User) &&
+				(approved.Schedule == "" || approved.Schedule == job.Schedule) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			unapproved = append(unapproved, job)
+		}
+	}
+	return unapproved, nil
+}
+
+// permissionProblem describes why a cron file's permissions are unsafe
+func permissionProblem(file ScheduleFile) string {
+	if file.Mode&0o002 != 0 {
+		return fmt.Sprintf("is world writable (mode %o)", file.Mode)
+	}
+	if file.Mode&0o020 != 0 && strings.HasPrefix(file.Path, "/etc/") {
+		return fmt.Sprintf("is group writable (mode %o)", file.Mode)
+	}
+	if file.Owner != "root" && strings.HasPrefix(file.Path, "/etc/") {
+		return fmt.Sprintf("is owned by %s rather than root", file.Owner)
+	}
+	return ""
+}
+
+func runScheduledTasksCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	settings := ScheduledTasksCheck{}
+	if check.ScheduledTasks != nil {
+		settings = *check.ScheduledTasks
+	}
+
+	marker := newSectionMarker()
+	output, _, err := RunSessionCommand(client, withSectionMarker(scheduledTasksScript, marker))
+	if err != nil {
+		return nil, nil, err
+	}
+	tasks := ParseScheduledTasks(output, marker)
+	unapproved, err := settings.Unapproved(tasks.Jobs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	props := append([]*Property{
+		{Name: "Jobs", Value: strconv.Itoa(len(tasks.Jobs))},
+		{Name: "Files", Value: strconv.Itoa(len(tasks.Files))},
+		{Name: "Unapproved", Value: strconv.Itoa(len(unapproved))},
+		{Name: "Unreadable", Value: strconv.Itoa(len(tasks.Unreadable))},
+	}, checkProps(check)...)
+	evidence := []*Evidence{}
+	if len(tasks.Unreadable) > 0 {
+		evidence = append(evidence, &Evidence{
+			Title:       "Unreadable cron tables",
+			Description: fmt.Sprintf("The jobs in %s could not be read as %s and are missing from the inventory.", strings.Join(tasks.Unreadable, ", "), config.Username),
+		})
+	}
+	for _, job := range tasks.Jobs {
+		evidence = append(evidence, &Evidence{
+			Title:       fmt.Sprintf("%s job in %s", job.Kind, job.Source),
+			Description: fmt.Sprintf("%s runs %s as %s", job.Schedule, job.Command, job.User),
+		})
+	}
+
+	remarks := "All OK."
+	if len(unapproved) > 0 {
+		remarks = fmt.Sprintf("%d scheduled jobs are not on the approved list.", len(unapproved))
+	} else if len(tasks.Unreadable) > 0 {
+		remarks = fmt.Sprintf("The inventory is incomplete: %d cron tables or directories could not be read.", len(tasks.Unreadable))
+	}
+	obs := newObservation(
+		checkTitle(check, "Scheduled Task Inventory"),
+		fmt.Sprintf("Collected %d scheduled jobs from cron tables, periodic directories and systemd timers on %s.", len(tasks.Jobs), target),
+		props,
+		evidence,
+		remarks,
+	)
+
+	findings := []*Finding{}
+	for _, job := range unapproved {
+		findings = append(findings, newFinding(
+			obs,
+			"Unapproved Scheduled Job",
+			fmt.Sprintf("The %s job in %s on %s runs %q as %s on schedule %q and is not on the approved list.", job.Kind, job.Source, target, job.Command, job.User, job.Schedule),
+			"Remove the job, or add it to the approved job list if it is expected.",
+			append([]*Property{
+				{Name: "Source", Value: job.Source},
+				{Name: "User", Value: job.User},
+			}, checkProps(check)...),
+		))
+	}
+	for _, file := range tasks.Files {
+		problem := permissionProblem(file)
+		if problem == "" {
+			continue
+		}
+		findings = append(findings, newFinding(
+			obs,
+			"Insecure Scheduled Task Permissions",
+			fmt.Sprintf("The file %s on %s %s.", file.Path, target, problem),
+			"Scheduled task files should be owned by root and writable only by their owner.",
+			append([]*Property{
+				{Name: "Source", Value: file.Path},
+				{Name: "Mode", Value: fmt.Sprintf("%o", file.Mode)},
+				{Name: "Owner", Value: file.Owner},
+			}, checkProps(check)...),
+		))
+	}
+	return []*Observation{obs}, findings, nil
+}
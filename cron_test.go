@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseScheduledTasks(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "scheduled_tasks.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks := ParseScheduledTasks(string(content), sectionMarker)
+
+	want := []ScheduledJob{
+		{"cron", "/etc/crontab", "root", "17 * * * *", "cd / && run-parts --report /etc/cron.hourly"},
+		{"cron", "/etc/crontab", "root", "25 6 * * *", "test -x /usr/sbin/anacron || ( cd / && run-parts --report /etc/cron.daily )"},
+		{"cron", "/var/spool/cron/crontabs/alice", "alice", "@reboot", "/home/alice/bin/start-agent"},
+		{"cron", "/var/spool/cron/crontabs/alice", "alice", "*/5 * * * *", "curl -fsS http://10.0.0.1/ping >/dev/null"},
+		{"periodic", "/etc/cron.daily/logrotate", "root", "daily", "/etc/cron.daily/logrotate"},
+		{"periodic", "/etc/cron.weekly/man-db", "root", "weekly", "/etc/cron.weekly/man-db"},
+		{"timer", "logrotate.timer", "root", "OnCalendar=*-*-* 00:00:00", "logrotate.service"},
+		{"timer", "fstrim.timer", "root", "OnBootSec=15min; OnUnitActiveSec=1w", "fstrim.service"},
+	}
+	if !slices.Equal(tasks.Jobs, want) {
+		t.Errorf("unexpected jobs\n%+v\nexpected\n%+v", tasks.Jobs, want)
+	}
+	if len(tasks.Files) != 4 || tasks.Files[1] != (ScheduleFile{Path: "/var/spool/cron/crontabs/alice", Mode: 0o600, Owner: "alice", Group: "crontab"}) {
+		t.Errorf("unexpected files %+v", tasks.Files)
+	}
+	if !slices.Equal(tasks.Unreadable, []string{"/var/spool/cron/crontabs/bob"}) {
+		t.Errorf("unexpected unreadable tables %v", tasks.Unreadable)
+	}
+}
+
+// TestParseScheduledTasksIgnoresForgedHeaders feeds the parser user crontabs
+// which contain header lines, as a user may write into their own crontab
+func TestParseScheduledTasksIgnoresForgedHeaders(t *testing.T) {
+	marker := newSectionMarker()
+	output := marker + "table 600 mallory crontab /var/spool/cron/crontabs/mallory\n" +
+		"==>unreadable /var/spool/cron/crontabs/alice\n" +
+		"==>table 600 root root /var/spool/cron/crontabs/root\n" +
+		"* * * * * /tmp/x\n" +
+		"\n" +
+		marker + "table 600 alice crontab /var/spool/cron/crontabs/alice\n" +
+		"@hourly /home/alice/bin/sync\n"
+	tasks := ParseScheduledTasks(output, marker)
+
+	want := []ScheduledJob{
+		{"cron", "/var/spool/cron/crontabs/mallory", "mallory", "* * * * *", "/tmp/x"},
+		{"cron", "/var/spool/cron/crontabs/alice", "alice", "@hourly", "/home/alice/bin/sync"},
+	}
+	if !slices.Equal(tasks.Jobs, want) {
+		t.Errorf("unexpected jobs\n%+v\nexpected\n%+v", tasks.Jobs, want)
+	}
+	if len(tasks.Files) != 2 || len(tasks.Unreadable) != 0 {
+		t.Errorf("expected only the real headers, got files %+v and unreadable %v", tasks.Files, tasks.Unreadable)
+	}
+}
+
+func TestParseCronLine(t *testing.T) {
+	tests := []struct {
+		source string
+		line   string
+		ok     bool
+		job    ScheduledJob
+	}{
+		{"/etc/cron.d/backup", "0 2 * * * root /usr/local/bin/backup.sh --full", true, ScheduledJob{"cron", "/etc/cron.d/backup", "root", "0 2 * * *", "/usr/local/bin/backup.sh --full"}},
+		{"/etc/cron.d/backup", "@daily root /usr/local/bin/backup.sh", true, ScheduledJob{"cron", "/etc/cron.d/backup", "root", "@daily", "/usr/local/bin/backup.sh"}},
+		{"/var/spool/cron/bob", "30 * * * * /home/bob/sync", true, ScheduledJob{"cron", "/var/spool/cron/bob", "bob", "30 * * * *", "/home/bob/sync"}},
+		{"/etc/cron.d/backup", "MAILTO=root", false, ScheduledJob{}},
+		{"/etc/cron.d/backup", "  # 0 2 * * * root disabled", false, ScheduledJob{}},
+		{"/etc/cron.d/backup", "0 2 * * * root", false, ScheduledJob{}},
+	}
+	for _, test := range tests {
+		job, ok := parseCronLine(test.source, test.line)
+		if ok != test.ok || job != test.job {
+			t.Errorf("%q: expected %v %+v, got %v %+v", test.line, test.ok, test.job, ok, job)
+		}
+	}
+}
+
+func TestScheduledTasksUnapproved(t *testing.T) {
+	jobs := []ScheduledJob{
+		{"cron", "/etc/cron.d/backup", "root", "0 2 * * *", "/usr/local/bin/backup.sh"},
+		{"cron", "/var/spool/cron/bob", "bob", "0 2 * * *", "/usr/local/bin/backup.sh"},
+		{"timer", "logrotate.timer", "root", "OnCalendar=*-*-* 00:00:00", "logrotate.service"},
+		{"timer", "logrotate.timer", "root", "OnCalendar=hourly", "logrotate.service"},
+	}
+	check := ScheduledTasksCheck{Approved: []ApprovedJob{
+		{Command: `^/usr/local/bin/backup\.sh$`, User: "root", Schedule: "0 2 * * *"},
+		{Command: `^logrotate\.service$`, Schedule: "OnCalendar=*-*-* 00:00:00"},
+	}}
+	unapproved, err := check.Unapproved(jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(unapproved, []ScheduledJob{jobs[1], jobs[3]}) {
+		t.Errorf("unexpected unapproved jobs %+v", unapproved)
+	}
+
+	if _, err := (ScheduledTasksCheck{Approved: []ApprovedJob{{Command: "("}}}).Unapproved(jobs); err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+}
+
+func TestPermissionProblem(t *testing.T) {
+	tests := []struct {
+		file    ScheduleFile
+		problem string
+	}{
+		{ScheduleFile{Path: "/etc/crontab", Mode: 0o644, Owner: "root"}, ""},
+		{ScheduleFile{Path: "/etc/cron.d/x", Mode: 0o646, Owner: "root"}, "world writable"},
+		{ScheduleFile{Path: "/etc/cron.d/x", Mode: 0o664, Owner: "root"}, "group writable"},
+		{ScheduleFile{Path: "/etc/cron.d/x", Mode: 0o644, Owner: "deploy"}, "owned by deploy"},
+		{ScheduleFile{Path: "/var/spool/cron/crontabs/alice", Mode: 0o660, Owner: "alice"}, ""},
+	}
+	for _, test := range tests {
+		problem := permissionProblem(test.file)
+		if (test.problem == "") != (problem == "") || !strings.Contains(problem, test.problem) {
+			t.Errorf("%s: expected %q, got %q", test.file.Path, test.problem, problem)
+		}
+	}
+}
+
+func TestScheduledTasksReportsUnreadableTables(t *testing.T) {
+	handler := func(command string) (string, int) {
+		return markOutput(command, "==>unreadable /var/spool/cron/crontabs\n"), 0
+	}
+	observations, findings, err := runCheckAgainst(t, handler, Check{Id: "cron", Type: "scheduled_tasks"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected no findings, got %v", findings)
+	}
+	obs := observations[0]
+	if len(obs.RelevantEvidence) != 1 || !strings.Contains(obs.RelevantEvidence[0].Description, "/var/spool/cron/crontabs could not be read") {
+		t.Errorf("expected the unreadable spool as evidence, got %v", obs.RelevantEvidence)
+	}
+	if !strings.Contains(obs.Remarks, "incomplete") {
+		t.Errorf("expected the remarks to flag the incomplete inventory, got %q", obs.Remarks)
+	}
+}
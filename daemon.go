@@ -0,0 +1,360 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+)
+
+const (
+	defaultDaemonListen = "127.0.0.1:8750"
+	defaultJobRetention = time.Hour
+	defaultMaxQueued    = 100
+	daemonTokenEnv      = "SSH_CF_DAEMON_TOKEN"
+	maxJobRequestBytes  = 1 << 20
+)
+
+// Job states reported by the daemon API
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobRequest selects the target and checks of an on-demand assessment. The
+// target is given either as an SSHConfig object or as the YAML configuration
+// the runtime passes to the plugin. Checks lists check ids to run, all of
+// them when empty.
+type JobRequest struct {
+	Target *SSHConfig `json:"target,omitempty"`
+	YAML   string     `json:"yaml,omitempty"`
+	Checks []string   `json:"checks,omitempty"`
+}
+
+// Job is an assessment submitted through the daemon API
+type Job struct {
+	Id       string     `json:"id"`
+	Target   string     `json:"target"`
+	Checks   []string   `json:"checks,omitempty"`
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	result *ExecuteResult
+}
+
+// Daemon runs assessments on demand through an authenticated HTTP API,
+// sharing the connection pool and its concurrency limits between jobs.
+// At most maxQueued jobs may be queued or running at once.
+type Daemon struct {
+	pool      *ConnectionPool
+	token     string
+	retention time.Duration
+	maxQueued int
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewDaemon creates a daemon accepting requests bearing the token
+func NewDaemon(pool *ConnectionPool, token string, retention time.Duration, maxQueued int) *Daemon {
+	if retention <= 0 {
+		retention = defaultJobRetention
+	}
+	if maxQueued <= 0 {
+		maxQueued = defaultMaxQueued
+	}
+	return &Daemon{
+		pool:      pool,
+		token:     token,
+		retention: retention,
+		maxQueued: maxQueued,
+		jobs:      map[string]*Job{},
+	}
+}
+
+// Handler returns the HTTP API of the daemon
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/jobs", d.submitJob)
+	mux.HandleFunc("GET /v1/jobs/{id}", d.jobStatus)
+	mux.HandleFunc("GET /v1/jobs/{id}/result", d.jobResult)
+	return d.authenticate(mux)
+}
+
+// authenticate rejects requests without the daemon bearer token
+func (d *Daemon) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (d *Daemon) submitJob(w http.ResponseWriter, r *http.Request) {
+	var request JobRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJobRequestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+	config, err := request.Config()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job := &Job{
+		Id:      newJobId(),
+		Target:  fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port),
+		Checks:  request.Checks,
+		Status:  JobQueued,
+		Created: time.Now(),
+	}
+	d.mu.Lock()
+	d.prune(job.Created)
+	if d.pending() >= d.maxQueued {
+		d.mu.Unlock()
+		w.Header().Set("Retry-After", "60")
+		writeError(w, http.StatusServiceUnavailable, "too many jobs are queued")
+		return
+	}
+	d.jobs[job.Id] = job
+	snapshot := *job
+	d.mu.Unlock()
+
+	go d.run(job, config)
+
+	w.Header().Set("Location", "/v1/jobs/"+job.Id)
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+func (d *Daemon) jobStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := d.job(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown job")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (d *Daemon) jobResult(w http.ResponseWriter, r *http.Request) {
+	job, ok := d.job(r.PathValue("id"))
+	switch {
+	case !ok:
+		writeError(w, http.StatusNotFound, "unknown job")
+	case job.Status == JobFailed:
+		writeError(w, http.StatusUnprocessableEntity, job.Error)
+	case job.Status != JobSucceeded:
+		writeError(w, http.StatusConflict, fmt.Sprintf("job is %s", job.Status))
+	default:
+		writeJSON(w, http.StatusOK, job.result)
+	}
+}
+
+// job returns a copy of the job with the id
+func (d *Daemon) job(id string) (Job, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	job, ok := d.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// run waits for the pool limits and runs the assessment of a job
+func (d *Daemon) run(job *Job, config SSHConfig) {
+	d.update(job, func() {
+		job.Status = JobRunning
+		now := time.Now()
+		job.Started = &now
+	})
+	result, err := RunAssessment(d.pool, config, job.Checks)
+	d.update(job, func() {
+		now := time.Now()
+		job.Finished = &now
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = JobSucceeded
+		job.result = result
+	})
+	if err != nil {
+		log.Printf("Job %s against %s failed: %v", job.Id, job.Target, err)
+	}
+}
+
+func (d *Daemon) update(job *Job, change func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	change()
+}
+
+// pending returns the number of jobs that have not finished
+func (d *Daemon) pending() int {
+	count := 0
+	for _, job := range d.jobs {
+		if job.Finished == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// prune forgets finished jobs older than the retention
+func (d *Daemon) prune(now time.Time) {
+	for id, job := range d.jobs {
+		if job.Finished != nil && now.Sub(*job.Finished) > d.retention {
+			delete(d.jobs, id)
+		}
+	}
+}
+
+// Config returns the SSH configuration of the requested target
+func (r JobRequest) Config() (SSHConfig, error) {
+	var config SSHConfig
+	switch {
+	case r.Target != nil && r.YAML != "":
+		return config, fmt.Errorf("only one of target and yaml may be given")
+	case r.Target != nil:
+		config = *r.Target
+		if err := config.validate(); err != nil {
+			return config, err
+		}
+	case r.YAML != "":
+		loaded, err := LoadConfig(r.YAML)
+		if err != nil {
+			return config, err
+		}
+		config = loaded
+	default:
+		return config, fmt.Errorf("target or yaml is required")
+	}
+	if config.Host == "" {
+		return config, fmt.Errorf("target host is required")
+	}
+	if config.Port == "" {
+		config.Port = "22" // default to 22 if no port supplied
+	}
+	if settings := localSettings(config); len(settings) > 0 {
+		return config, fmt.Errorf("%s cannot be set through the API", strings.Join(settings, ", "))
+	}
+	if _, err := SelectChecks(config, r.Checks); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// localSettings returns the settings of a configuration that read or write
+// files on the daemon's host, or post to other URLs, which API clients may
+// not use
+func localSettings(config SSHConfig) []string {
+	settings := []string{}
+	if config.Trace != nil {
+		settings = append(settings, "trace")
+	}
+	if config.Export != nil {
+		settings = append(settings, "export")
+	}
+	for _, check := range config.Checks {
+		if check.PrivilegedFiles != nil && check.PrivilegedFiles.BaselineDir != "" {
+			settings = append(settings, fmt.Sprintf("privileged_files.baseline_dir of check %s", check.Id))
+		}
+		if check.GoldenFile != nil && check.GoldenFile.Template != "" {
+			settings = append(settings, fmt.Sprintf("golden_file.template of check %s", check.Id))
+		}
+		if check.ServerVersion != nil && check.ServerVersion.Table != "" {
+			settings = append(settings, fmt.Sprintf("server_version.table of check %s", check.Id))
+		}
+	}
+	return settings
+}
+
+func newJobId() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(fmt.Sprintf("failed to generate job id: %v", err))
+	}
+	return hex.EncodeToString(id)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// DaemonCommand serves the daemon API until the process is stopped. The
+// token is read from the token file, or from SSH_CF_DAEMON_TOKEN.
+func DaemonCommand(args []string) int {
+	flags := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	listen := flags.String("listen", defaultDaemonListen, "address to serve the API on")
+	tokenFile := flags.String("token-file", "", "file holding the API bearer token")
+	retention := flags.Duration("retention", defaultJobRetention, "how long finished jobs are kept")
+	maxQueued := flags.Int("max-queued", defaultMaxQueued, "jobs queued or running at once, further submissions are refused")
+	var options PoolOptions
+	flags.IntVar(&options.MaxConcurrent, "max-concurrent", 0, "assessments running at once, unlimited when 0")
+	flags.IntVar(&options.MaxPerHost, "max-per-host", defaultMaxPerHost, "assessments running at once against a host")
+	flags.DurationVar(&options.IdleTimeout, "idle-timeout", defaultIdleTimeout, "how long idle connections are kept")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	token := os.Getenv(daemonTokenEnv)
+	if *tokenFile != "" {
+		content, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read token file: %v\n", err)
+			return 1
+		}
+		token = strings.TrimSpace(string(content))
+	}
+	if token == "" {
+		fmt.Fprintf(os.Stderr, "a token is required, use -token-file or %s\n", daemonTokenEnv)
+		return 1
+	}
+
+	pool := NewConnectionPool(options)
+	defer pool.Close()
+	daemon := NewDaemon(pool, token, *retention, *maxQueued)
+
+	log.Printf("Serving the assessment API on %s", *listen)
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           daemon.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to serve: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testDaemonToken = "daemon-token"
+
+// daemonRequest sends an authenticated request to the daemon API and
+// decodes the JSON response into value
+func daemonRequest(t *testing.T, server *httptest.Server, method string, path string, body interface{}, value interface{}) *http.Response {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	request, err := http.NewRequest(method, server.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer "+testDaemonToken)
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if value != nil {
+		json.NewDecoder(response.Body).Decode(value)
+	}
+	return response
+}
+
+func newDaemonServer(t *testing.T, maxQueued int) *httptest.Server {
+	t.Helper()
+	pool := NewConnectionPool(PoolOptions{})
+	server := httptest.NewServer(NewDaemon(pool, testDaemonToken, time.Hour, maxQueued).Handler())
+	t.Cleanup(func() {
+		server.Close()
+		pool.Close()
+	})
+	return server
+}
+
+// waitForJob polls the job until it has finished
+func waitForJob(t *testing.T, server *httptest.Server, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var job Job
+		daemonRequest(t, server, http.MethodGet, "/v1/jobs/"+id, nil, &job)
+		if job.Status == JobSucceeded || job.Status == JobFailed {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestDaemonAuthentication(t *testing.T) {
+	server := newDaemonServer(t, 0)
+	tests := []string{"", "Bearer wrong", "Basic " + testDaemonToken}
+	for _, header := range tests {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/v1/jobs/x", nil)
+		if header != "" {
+			request.Header.Set("Authorization", header)
+		}
+		response, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%q: expected 401, got %s", header, response.Status)
+		}
+	}
+}
+
+func TestDaemonRejectsInvalidJobs(t *testing.T) {
+	server := newDaemonServer(t, 0)
+	tests := []struct {
+		name  string
+		body  interface{}
+		error string
+	}{
+		{"unknown field", map[string]interface{}{"host": "10.0.0.5"}, "unknown field"},
+		{"no target", map[string]interface{}{}, "target or yaml is required"},
+		{"both targets", map[string]interface{}{"target": map[string]string{"host": "a"}, "yaml": "host: a"}, "only one of target and yaml"},
+		{"no host", map[string]interface{}{"target": map[string]string{"username": "audit"}}, "target host is required"},
+		{"unknown check", map[string]interface{}{"target": map[string]string{"host": "a"}, "checks": []string{"missing"}}, "missing"},
+		{"trace", map[string]interface{}{"target": map[string]interface{}{"host": "a", "trace": map[string]string{"directory": "/etc"}}}, "trace cannot be set"},
+		{"export", map[string]interface{}{"yaml": "host: a\nexport:\n  url: https://example.com/rest/api/2/issue\n"}, "export cannot be set"},
+		{"baseline", map[string]interface{}{"target": map[string]interface{}{"host": "a", "checks": []map[string]interface{}{
+			{"id": "suid", "type": "privileged_files", "privileged_files": map[string]string{"baseline_dir": "/etc/cron.d"}},
+		}}}, "privileged_files.baseline_dir of check suid"},
+		{"template", map[string]interface{}{"target": map[string]interface{}{"host": "a", "checks": []map[string]interface{}{
+			{"id": "motd", "type": "golden_file", "golden_file": map[string]string{"path": "/etc/motd", "template": "/etc/shadow"}},
+		}}}, "golden_file.template of check motd"},
+	}
+	for _, test := range tests {
+		var body map[string]string
+		response := daemonRequest(t, server, http.MethodPost, "/v1/jobs", test.body, &body)
+		if response.StatusCode != http.StatusBadRequest || !strings.Contains(body["error"], test.error) {
+			t.Errorf("%s: expected 400 %q, got %s %q", test.name, test.error, response.Status, body["error"])
+		}
+	}
+}
+
+func TestDaemonRunsJobs(t *testing.T) {
+	target := newTestServer(t, echoHandler).SSHConfig()
+	target.Command = "uname -a"
+	server := newDaemonServer(t, 0)
+
+	var job Job
+	response := daemonRequest(t, server, http.MethodPost, "/v1/jobs", JobRequest{Target: &target, Checks: []string{"command"}}, &job)
+	if response.StatusCode != http.StatusAccepted || job.Id == "" || response.Header.Get("Location") != "/v1/jobs/"+job.Id {
+		t.Fatalf("expected the job to be accepted, got %s %+v", response.Status, job)
+	}
+	if finished := waitForJob(t, server, job.Id); finished.Status != JobSucceeded || finished.Started == nil || finished.Finished == nil {
+		t.Fatalf("expected the job to succeed, got %+v", finished)
+	}
+	var result map[string]interface{}
+	if response := daemonRequest(t, server, http.MethodGet, "/v1/jobs/"+job.Id+"/result", nil, &result); response.StatusCode != http.StatusOK || result["Observations"] == nil {
+		t.Errorf("expected the result, got %s %v", response.Status, result)
+	}
+	for _, path := range []string{"/v1/jobs/unknown", "/v1/jobs/unknown/result"} {
+		if response := daemonRequest(t, server, http.MethodGet, path, nil, nil); response.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %s", path, response.Status)
+		}
+	}
+
+	// A job whose assessment cannot run reports its error
+	target.Password = "wrong"
+	daemonRequest(t, server, http.MethodPost, "/v1/jobs", JobRequest{Target: &target}, &job)
+	finished := waitForJob(t, server, job.Id)
+	if finished.Status != JobFailed || !strings.Contains(finished.Error, "unable to authenticate") {
+		t.Fatalf("expected the job to fail, got %+v", finished)
+	}
+	var body map[string]string
+	if response := daemonRequest(t, server, http.MethodGet, "/v1/jobs/"+job.Id+"/result", nil, &body); response.StatusCode != http.StatusUnprocessableEntity || body["error"] != finished.Error {
+		t.Errorf("expected the job error, got %s %v", response.Status, body)
+	}
+}
+
+func TestDaemonCapsQueuedJobs(t *testing.T) {
+	release := make(chan struct{})
+	target := newTestServer(t, func(command string) (string, int) {
+		<-release
+		return "ok\n", 0
+	}).SSHConfig()
+	target.Command = "sleep"
+	server := newDaemonServer(t, 2)
+
+	ids := []string{}
+	for i := 0; i < 2; i++ {
+		var job Job
+		if response := daemonRequest(t, server, http.MethodPost, "/v1/jobs", JobRequest{Target: &target}, &job); response.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected job %d to be accepted, got %s", i, response.Status)
+		}
+		ids = append(ids, job.Id)
+	}
+	var body map[string]string
+	response := daemonRequest(t, server, http.MethodPost, "/v1/jobs", JobRequest{Target: &target}, &body)
+	if response.StatusCode != http.StatusServiceUnavailable || response.Header.Get("Retry-After") == "" {
+		t.Errorf("expected the third job to be refused, got %s %v", response.Status, body)
+	}
+	if response := daemonRequest(t, server, http.MethodGet, "/v1/jobs/"+ids[0]+"/result", nil, nil); response.StatusCode != http.StatusConflict {
+		t.Errorf("expected no result before the job finished, got %s", response.Status)
+	}
+
+	close(release)
+	for _, id := range ids {
+		waitForJob(t, server, id)
+	}
+	var job Job
+	if response := daemonRequest(t, server, http.MethodPost, "/v1/jobs", JobRequest{Target: &target}, &job); response.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected jobs to be accepted once the queue drained, got %s", response.Status)
+	}
+	waitForJob(t, server, job.Id)
+}
+
+// TestAcquireTakesHostSlotFirst queues a job on a busy host and checks that
+// it does not hold the global slot another host needs
+func TestAcquireTakesHostSlotFirst(t *testing.T) {
+	busy := newTestServer(t, echoHandler).SSHConfig()
+	idle := newTestServer(t, echoHandler).SSHConfig()
+	pool := NewConnectionPool(PoolOptions{MaxConcurrent: 2, MaxPerHost: 1})
+	defer pool.Close()
+
+	_, release, err := pool.Acquire(busy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued := make(chan func())
+	go func() {
+		_, release, err := pool.Acquire(busy)
+		if err != nil {
+			t.Error(err)
+		}
+		queued <- release
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	acquired := make(chan func())
+	go func() {
+		_, release, err := pool.Acquire(idle)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- release
+	}()
+	select {
+	case releaseIdle := <-acquired:
+		releaseIdle()
+	case <-time.After(5 * time.Second):
+		t.Fatal("the idle host waited for the job queued on the busy host")
+	}
+	release()
+	(<-queued)()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffOp is a single line of an edit script: ' ' for a line in both inputs,
+// '-' for a line only in the first and '+' for a line only in the second
+type diffOp struct {
+	Kind byte
+	Text string
+}
+
+// Bounds of diffLines. The search keeps O(D²) state for D edits, so inputs
+// that differ in more lines are not diffed.
+const (
+	maxDiffInputLines = 200000
+	maxDiffEdits      = 1000
+)
+
+// diffLines computes a shortest edit script from a to b with Myers' algorithm.
+// It reports false when the inputs, after their common prefix and suffix,
+// exceed maxDiffInputLines or need more than maxDiffEdits edits.
+func diffLines(a []string, b []string) ([]diffOp, bool) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops := []diffOp{}
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	middle, ok := myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	if !ok {
+		return nil, false
+	}
+	ops = append(ops, middle...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops, true
+}
+
+// myersDiff runs the greedy search of Myers' algorithm, keeping only the
+// diagonals -d..d reached at each step d for the walk back
+func myersDiff(a []string, b []string) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	if n+m == 0 {
+		return nil, true
+	}
+	if n+m > maxDiffInputLines {
+		return nil, false
+	}
+	max := min(n+m, maxDiffEdits)
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d][k+d] is the furthest x on diagonal k before step d
+	trace := [][]int{}
+
+	found := false
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break search
+			}
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	// Walk back through the trace to recover the edits
+	ops := []diffOp{}
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		// at returns v[offset+k] as it was before step d
+		at := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[y-1]})
+			} else {
+				ops = append(ops, diffOp{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops, true
+}
+
+// UnifiedDiff returns a unified diff of the two line slices with the given
+// number of context lines, or an empty string if they are equal
+func UnifiedDiff(a []string, b []string, fromName string, toName string, context int) string {
+	ops, ok := diffLines(a, b)
+	if !ok {
+		return fmt.Sprintf("--- %s\n+++ %s\nfiles differ too much to diff (%d and %d lines)\n", fromName, toName, len(a), len(b))
+	}
+
+	// Find the ranges of ops to print, merging changes whose context overlaps
+	type hunk struct{ start, end int }
+	hunks := []hunk{}
+	for i, op := range ops {
+		if op.Kind == ' ' {
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1].end {
+			hunks[len(hunks)-1].end = end
+		} else {
+			hunks = append(hunks, hunk{start, end})
+		}
+	}
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	// Line numbers of the first line of each op in a and b
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.Kind != '+' {
+			aLine[i+1]++
+		}
+		if op.Kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks {
+		aCount := aLine[h.end] - aLine[h.start]
+		bCount := bLine[h.end] - bLine[h.start]
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aLine[h.start], aCount), hunkRange(bLine[h.start], bCount))
+		for _, op := range ops[h.start:h.end] {
+			fmt.Fprintf(&out, "%c%s\n", op.Kind, op.Text)
+		}
+	}
+	return out.String()
+}
+
+// hunkRange formats a hunk range, which starts at the line before an empty range
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
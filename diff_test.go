@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		edits int
+	}{
+		{"", "", 0},
+		{"a b c", "a b c", 0},
+		{"", "a b", 2},
+		{"a b", "", 2},
+		{"a b c", "a x c", 2},
+		{"a b c a b b a", "c b a b a c", 5},
+		{"x a b c", "a b c y", 2},
+	}
+	for _, test := range tests {
+		a, b := strings.Fields(test.a), strings.Fields(test.b)
+		ops, ok := diffLines(a, b)
+		if !ok {
+			t.Fatalf("%q %q: expected a diff", test.a, test.b)
+		}
+		var from, to []string
+		edits := 0
+		for _, op := range ops {
+			if op.Kind != '+' {
+				from = append(from, op.Text)
+			}
+			if op.Kind != '-' {
+				to = append(to, op.Text)
+			}
+			if op.Kind != ' ' {
+				edits++
+			}
+		}
+		if strings.Join(from, " ") != test.a || strings.Join(to, " ") != test.b {
+			t.Errorf("%q %q: the edit script does not reproduce the inputs: %v", test.a, test.b, ops)
+		}
+		if edits != test.edits {
+			t.Errorf("%q %q: expected %d edits, got %d", test.a, test.b, test.edits, edits)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []string{"Port 22", "PermitRootLogin no", "X11Forwarding no", "UsePAM yes"}
+	b := []string{"Port 22", "PermitRootLogin yes", "X11Forwarding no", "UsePAM yes", "Banner /etc/issue"}
+	want := strings.Join([]string{
+		"--- golden",
+		"+++ host",
+		"@@ -1,4 +1,5 @@",
+		" Port 22",
+		"-PermitRootLogin no",
+		"+PermitRootLogin yes",
+		" X11Forwarding no",
+		" UsePAM yes",
+		"+Banner /etc/issue",
+		"",
+	}, "\n")
+	if diff := UnifiedDiff(a, b, "golden", "host", 3); diff != want {
+		t.Errorf("unexpected diff\n%s\nexpected\n%s", diff, want)
+	}
+	if diff := UnifiedDiff(a, a, "golden", "host", 3); diff != "" {
+		t.Errorf("expected no diff for equal inputs, got %q", diff)
+	}
+}
+
+func TestUnifiedDiffLargeInputs(t *testing.T) {
+	numbered := func(prefix string, n int) []string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = fmt.Sprintf("%s %d", prefix, i)
+		}
+		return lines
+	}
+
+	// A small change in a large file is diffed after the common ends
+	a := numbered("line", 150000)
+	b := append(append([]string{}, a...), "tail")
+	b[75000] = "changed"
+	diff := UnifiedDiff(a, b, "golden", "host", 1)
+	if !strings.Contains(diff, "-line 75000\n+changed\n") || !strings.Contains(diff, "+tail\n") {
+		t.Errorf("expected the two changes, got\n%s", diff)
+	}
+
+	tests := []struct {
+		name string
+		a, b []string
+	}{
+		{"too many edits", numbered("a", 5000), numbered("b", 5000)},
+		{"too many lines", numbered("a", maxDiffInputLines), numbered("b", 10)},
+	}
+	for _, test := range tests {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		diff := UnifiedDiff(test.a, test.b, "golden", "host", 3)
+		runtime.ReadMemStats(&after)
+		if !strings.Contains(diff, "files differ too much to diff") {
+			t.Errorf("%s: expected the diff to be refused, got %.80q", test.name, diff)
+		}
+		// The search state is bounded by maxDiffEdits, not the input size
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+			t.Errorf("%s: expected bounded memory, allocated %d bytes", test.name, allocated)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// diskEncryptionScript prints the block device tree, the mount table, the
+// dm-crypt tables and the status of each dm-crypt mapping. Table keys are
+// never printed as dmsetup hides them unless --showkeys is given.
+const diskEncryptionScript = `
+printf '==>lsblk\n'
+lsblk -J -o NAME,KNAME,TYPE,FSTYPE,MOUNTPOINT 2>/dev/null
+printf '==>mounts\n'
+cat /proc/self/mounts 2>/dev/null
+printf '==>crypt\n'
+dmsetup table --target crypt 2>/dev/null
+for d in $(dmsetup ls --target crypt 2>/dev/null | awk '{print $1}'); do
+  printf '==>status %s\n' "$d"
+  cryptsetup status "$d" 2>/dev/null | grep -E '^ *(type|cipher|keysize|device):'
+done
+`
+
+// DiskEncryptionCheck configures the disk encryption check
+type DiskEncryptionCheck struct {
+	// SensitiveMounts are paths whose filesystem must be encrypted. A path
+	// which is not a mount point is checked on the filesystem holding it.
+	SensitiveMounts []string `json:"sensitive_mounts" yaml:"sensitive_mounts"`
+
+	// AllowedCiphers optionally restricts the dm-crypt ciphers in use
+	AllowedCiphers []string `json:"allowed_ciphers,omitempty" yaml:"allowed_ciphers,omitempty"`
+}
+
+// BlockDevice is a node of the `lsblk -J` device tree
+type BlockDevice struct {
+	Name       string        `json:"name"`
+	KName      string        `json:"kname"`
+	Type       string        `json:"type"`
+	FSType     string        `json:"fstype"`
+	MountPoint string        `json:"mountpoint"`
+	Children   []BlockDevice `json:"children"`
+}
+
+// CryptMapping is a dm-crypt mapping with its cipher
+type CryptMapping struct {
+	Name    string
+	Type    string
+	Cipher  string
+	KeySize string
+	Device  string
+}
+
+// MountedVolume is a mounted filesystem and its encryption state. Pseudo
+// filesystems such as tmpfs are not stored on a block device.
+type MountedVolume struct {
+	MountPoint string
+	Device     string
+	FSType     string
+	Encrypted  bool
+	Mapping    string
+	Pseudo     bool
+}
+
+// pseudoFilesystems are kept in memory or by the kernel rather than on disk
+var pseudoFilesystems = []string{
+	"tmpfs", "ramfs", "devtmpfs", "proc", "sysfs", "devpts", "cgroup", "cgroup2",
+	"securityfs", "debugfs", "tracefs", "configfs", "mqueue", "hugetlbfs", "pstore",
+	"bpf", "efivarfs", "autofs", "fusectl", "binfmt_misc", "rpc_pipefs", "nsfs",
+}
+
+// mountEscapes decodes the octal escapes of /proc/mounts fields
+var mountEscapes = strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+
+// ParseDiskEncryption parses the output of diskEncryptionScript
+func ParseDiskEncryption(output string) ([]MountedVolume, map[string]*CryptMapping, error) {
+	sections := map[string][]string{}
+	mappings := map[string]*CryptMapping{}
+	section := ""
+	var mapping *CryptMapping
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "==>") {
+			section = strings.TrimPrefix(line, "==>")
+			mapping = nil
+			if name, ok := strings.CutPrefix(section, "status "); ok {
+				section = "status"
+				mapping = cryptMapping(mappings, name)
+			}
+			continue
+		}
+		switch section {
+		case "crypt":
+			// name: start length crypt cipher key iv_offset device offset
+			name, table, ok := strings.Cut(line, ":")
+			fields := strings.Fields(table)
+			if ok && len(fields) >= 4 && fields[2] == "crypt" {
+				cryptMapping(mappings, name).Cipher = fields[3]
+			}
+		case "status":
+			key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+			value = strings.TrimSpace(value)
+			if !ok || mapping == nil {
+				continue
+			}
+			switch key {
+			case "type":
+				mapping.Type = value
+			case "cipher":
+				mapping.Cipher = value
+			case "keysize":
+				mapping.KeySize = value
+			case "device":
+				mapping.Device = value
+			}
+		default:
+			sections[section] = append(sections[section], line)
+		}
+	}
+
+	var tree struct {
+		BlockDevices []BlockDevice `json:"blockdevices"`
+	}
+	if err := json.Unmarshal([]byte(strings.Join(sections["lsblk"], "\n")), &tree); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse lsblk output: %v", err)
+	}
+	volumes := []MountedVolume{}
+	for _, device := range tree.BlockDevices {
+		volumes = collectVolumes(device, "", volumes)
+	}
+	// lsblk only lists block devices, so pseudo filesystems come from the
+	// mount table
+	for _, line := range sections["mounts"] {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !contains(pseudoFilesystems, fields[2]) {
+			continue
+		}
+		volumes = append(volumes, MountedVolume{
+			MountPoint: mountEscapes.Replace(fields[1]),
+			Device:     fields[0],
+			FSType:     fields[2],
+			Pseudo:     true,
+		})
+	}
+	return volumes, mappings, nil
+}
+
+func cryptMapping(mappings map[string]*CryptMapping, name string) *CryptMapping {
+	name = strings.TrimSpace(name)
+	if mappings[name] == nil {
+		mappings[name] = &CryptMapping{Name: name}
+	}
+	return mappings[name]
+}
+
+// collectVolumes walks the device tree. A filesystem is encrypted when it or
+// any device beneath it is a dm-crypt mapping, e.g. LVM on LUKS.
+func collectVolumes(device BlockDevice, mapping string, volumes []MountedVolume) []MountedVolume {
+	if device.Type == "crypt" {
+		mapping = device.Name
+	}
+	if device.MountPoint != "" && strings.HasPrefix(device.MountPoint, "/") {
+		volumes = append(volumes, MountedVolume{
+			MountPoint: device.MountPoint,
+			Device:     device.Name,
+			FSType:     device.FSType,
+			Encrypted:  mapping != "",
+			Mapping:    mapping,
+		})
+	}
+	for _, child := range device.Children {
+		volumes = collectVolumes(child, mapping, volumes)
+	}
+	return volumes
+}
+
+// VolumeFor returns the mounted volume holding the path, using the longest
+// matching mount point
+func VolumeFor(volumes []MountedVolume, target string) (MountedVolume, bool) {
+	best := MountedVolume{}
+	found := false
+	for _, volume := range volumes {
+		mount := volume.MountPoint
+		if target == mount || mount == "/" || strings.HasPrefix(target, strings.TrimSuffix(mount, "/")+"/") {
+			if !found || len(mount) > len(best.MountPoint) {
+				best = volume
+				found = true
+			}
+		}
+	}
+	return best, found
+}
+
+func runDiskEncryptionCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	settings := DiskEncryptionCheck{}
+	if check.DiskEncryption != nil {
+		settings = *check.DiskEncryption
+	}
+
+	output, _, err := RunSessionCommand(client, diskEncryptionScript)
+	if err != nil {
+		return nil, nil, err
+	}
+	volumes, mappings, err := ParseDiskEncryption(output)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	evidence := []*Evidence{}
+	mounted := 0
+	for _, volume := range volumes {
+		if volume.Pseudo {
+			continue
+		}
+		mounted++
+		state := "unencrypted"
+		if volume.Encrypted {
+			state = fmt.Sprintf("encrypted by dm-crypt mapping %s", volume.Mapping)
+			if m, ok := mappings[volume.Mapping]; ok && m.Cipher != "" {
+				state = fmt.Sprintf("%s (%s %s %s)", state, m.Type, m.Cipher, m.KeySize)
+			}
+		}
+		evidence = append(evidence, &Evidence{
+			Title:       volume.MountPoint,
+			Description: fmt.Sprintf("%s %s on %s is %s", volume.FSType, volume.MountPoint, volume.Device, state),
+		})
+	}
+
+	type problem struct {
+		path        string
+		description string
+	}
+	problems := []problem{}
+	for _, sensitive := range settings.SensitiveMounts {
+		volume, found := VolumeFor(volumes, sensitive)
+		if !found {
+			problems = append(problems, problem{sensitive, fmt.Sprintf("No mounted filesystem holding %s was found on %s.", sensitive, target)})
+			continue
+		}
+		if volume.Pseudo {
+			evidence = append(evidence, &Evidence{
+				Title:       sensitive,
+				Description: fmt.Sprintf("%s is held by the %s filesystem mounted at %s, which is not stored on disk", sensitive, volume.FSType, volume.MountPoint),
+			})
+			continue
+		}
+		if !volume.Encrypted {
+			problems = append(problems, problem{sensitive, fmt.Sprintf("%s on %s is held by the unencrypted %s filesystem %s mounted at %s.", sensitive, target, volume.FSType, volume.Device, volume.MountPoint)})
+			continue
+		}
+		if m, ok := mappings[volume.Mapping]; ok && len(settings.AllowedCiphers) > 0 && !contains(settings.AllowedCiphers, m.Cipher) {
+			problems = append(problems, problem{sensitive, fmt.Sprintf("%s on %s is encrypted with cipher %s, which is not allowed.", sensitive, target, m.Cipher)})
+		}
+	}
+
+	props := append([]*Property{
+		{Name: "Volumes", Value: fmt.Sprintf("%d", mounted)},
+		{Name: "SensitiveMounts", Value: strings.Join(settings.SensitiveMounts, ",")},
+	}, checkProps(check)...)
+	remarks := "All OK."
+	if len(problems) > 0 {
+		remarks = fmt.Sprintf("%d sensitive mount points are not adequately encrypted.", len(problems))
+	}
+	obs := newObservation(
+		checkTitle(check, "Disk Encryption Status"),
+		fmt.Sprintf("Mapped %d mounted filesystems to their encryption state on %s.", mounted, target),
+		props,
+		evidence,
+		remarks,
+	)
+
+	findings := []*Finding{}
+	for _, p := range problems {
+		findings = append(findings, newFinding(
+			obs,
+			"Sensitive Data Not Encrypted At Rest",
+			p.description,
+			"Move the data to a dm-crypt/LUKS encrypted volume using an approved cipher.",
+			append([]*Property{{Name: "MountPoint", Value: p.path}}, checkProps(check)...),
+		))
+	}
+	return []*Observation{obs}, findings, nil
+}
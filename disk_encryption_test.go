@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDiskEncryption(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "disk_encryption.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumes, mappings, err := ParseDiskEncryption(string(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := mappings["cryptroot"]; m == nil || m.Type != "LUKS2" || m.Cipher != "aes-xts-plain64" || m.Device != "/dev/nvme0n1p2" {
+		t.Errorf("unexpected mapping %+v", m)
+	}
+
+	tests := []struct {
+		path  string
+		found bool
+		want  MountedVolume
+	}{
+		{"/etc/shadow", true, MountedVolume{MountPoint: "/", Device: "cryptroot", FSType: "ext4", Encrypted: true, Mapping: "cryptroot"}},
+		{"/boot/efi/EFI", true, MountedVolume{MountPoint: "/boot/efi", Device: "nvme0n1p1", FSType: "vfat"}},
+		{"/boot/efix", true, MountedVolume{MountPoint: "/", Device: "cryptroot", FSType: "ext4", Encrypted: true, Mapping: "cryptroot"}},
+		{"/run/secrets", true, MountedVolume{MountPoint: "/run", Device: "tmpfs", FSType: "tmpfs", Pseudo: true}},
+		{"/var/lib/app cache/db", true, MountedVolume{MountPoint: "/var/lib/app cache", Device: "tmpfs", FSType: "tmpfs", Pseudo: true}},
+		{"/proc/1", true, MountedVolume{MountPoint: "/proc", Device: "proc", FSType: "proc", Pseudo: true}},
+	}
+	for _, test := range tests {
+		volume, found := VolumeFor(volumes, test.path)
+		if found != test.found || volume != test.want {
+			t.Errorf("%s: expected %t %+v, got %t %+v", test.path, test.found, test.want, found, volume)
+		}
+	}
+
+	if _, found := VolumeFor(nil, "/srv"); found {
+		t.Error("expected no volume without mounts")
+	}
+}
+
+func TestParseDiskEncryptionRejectsBadTree(t *testing.T) {
+	if _, _, err := ParseDiskEncryption("==>lsblk\n{\n==>crypt\n"); err == nil {
+		t.Error("expected truncated lsblk output to be rejected")
+	}
+}
+
+func TestDiskEncryptionSkipsPseudoFilesystems(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "disk_encryption.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := func(command string) (string, int) { return string(content), 0 }
+	check := Check{Id: "luks", Type: "disk_encryption", DiskEncryption: &DiskEncryptionCheck{
+		SensitiveMounts: []string{"/run/secrets", "/boot/efi"},
+	}}
+	observations, findings, err := runCheckAgainst(t, handler, check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || !strings.Contains(findings[0].Description, "unencrypted vfat") {
+		t.Fatalf("expected only /boot/efi to be reported, got %v", findings)
+	}
+	evidence := observations[0].RelevantEvidence
+	last := evidence[len(evidence)-1].Description
+	if !strings.Contains(last, "/run/secrets is held by the tmpfs filesystem mounted at /run") {
+		t.Errorf("expected the tmpfs path as evidence, got %q", last)
+	}
+	if len(evidence) != 3 {
+		t.Errorf("expected two block volumes and one pseudo filesystem as evidence, got %d", len(evidence))
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+)
+
+const (
+	defaultExportTimeout   = 30 * time.Second
+	defaultExcerptLines    = 20
+	defaultIssueType       = "Bug"
+	defaultIssuePriority   = "Medium"
+	dedupPropertyKey       = "cf-dedup-key"
+	dedupLabelPrefix       = "cf-dedup-"
+	existingIssueUpdate    = "update"
+	existingIssueSkip      = "skip"
+	issueDescriptionLimit  = 30000
+	issueSummaryCharacters = 250
+)
+
+// defaultPriorities maps Finding severities to issue priorities
+var defaultPriorities = map[string]string{
+	"critical": "Highest",
+	"high":     "High",
+	"medium":   "Medium",
+	"low":      "Low",
+}
+
+// identityProps are the Finding properties that tell apart Findings with the
+// same title on a host. Counts, ages and pids change between runs and are
+// left out so that the dedup key is stable.
+var identityProps = []string{
+	"Check", "Path", "Section", "Key", "Rule", "CVE", "Type", "Fingerprint",
+	"Module", "MountPoint", "Facility", "Collector", "Endpoint", "Query",
+	"Daemon", "Server", "Kind", "User", "Certificate",
+}
+
+// IssueExport configures exporting Findings to an issue tracker, either as
+// JSON files in Directory or by posting them to URL
+type IssueExport struct {
+	Directory string `json:"directory,omitempty" yaml:"directory,omitempty"`
+	URL       string `json:"url,omitempty" yaml:"url,omitempty"`
+
+	// SearchURL finds open issues by their dedup label with JQL. It
+	// defaults to the search endpoint next to URL, e.g. /rest/api/2/search.
+	SearchURL string `json:"search_url,omitempty" yaml:"search_url,omitempty"`
+
+	// Existing is "update" (the default) to update an open issue of the
+	// same Finding, or "skip" to leave it alone
+	Existing string `json:"existing,omitempty" yaml:"existing,omitempty"`
+
+	// Username and Token authenticate with basic auth, or Token alone as a
+	// bearer token
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Token    string `json:"token,omitempty" yaml:"token,omitempty"`
+	Timeout  string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// Project is used when a Finding has no TicketProject property
+	Project         string            `json:"project" yaml:"project"`
+	IssueType       string            `json:"issue_type,omitempty" yaml:"issue_type,omitempty"`
+	Labels          []string          `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Priorities      map[string]string `json:"priorities,omitempty" yaml:"priorities,omitempty"`
+	DefaultPriority string            `json:"default_priority,omitempty" yaml:"default_priority,omitempty"`
+	ExcerptLines    int               `json:"excerpt_lines,omitempty" yaml:"excerpt_lines,omitempty"`
+}
+
+// IssuePayload is a Jira style issue creation request
+type IssuePayload struct {
+	Fields     IssueFields     `json:"fields"`
+	Properties []IssueProperty `json:"properties,omitempty"`
+}
+
+// IssueUpdate is a Jira style issue edit request. The project and issue
+// type of an existing issue are left alone, labels are only added, and the
+// priority is only set when the severity of the Finding changed, so that
+// triage on the issue is kept.
+type IssueUpdate struct {
+	Fields     IssueUpdateFields `json:"fields"`
+	Update     IssueEdits        `json:"update"`
+	Properties []IssueProperty   `json:"properties,omitempty"`
+}
+
+type IssueUpdateFields struct {
+	Summary     string     `json:"summary"`
+	Description string     `json:"description"`
+	Priority    *IssueName `json:"priority,omitempty"`
+}
+
+type IssueEdits struct {
+	Labels []IssueLabelEdit `json:"labels"`
+}
+
+type IssueLabelEdit struct {
+	Add string `json:"add"`
+}
+
+// existingIssue is an open issue found for a Finding. Severity is nil for
+// issues exported before the severity was recorded.
+type existingIssue struct {
+	Key        string `json:"key"`
+	Properties map[string]struct {
+		Severity *string `json:"severity"`
+	} `json:"properties"`
+}
+
+// issueSearchResult is the part of a Jira search response that is read
+type issueSearchResult struct {
+	Issues []existingIssue `json:"issues"`
+}
+
+type IssueFields struct {
+	Project     IssueKey  `json:"project"`
+	Summary     string    `json:"summary"`
+	Description string    `json:"description"`
+	IssueType   IssueName `json:"issuetype"`
+	Priority    IssueName `json:"priority"`
+	Labels      []string  `json:"labels"`
+}
+
+type IssueKey struct {
+	Key string `json:"key"`
+}
+
+type IssueName struct {
+	Name string `json:"name"`
+}
+
+type IssueProperty struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// DedupKey returns the stable key of a Finding on a target
+func DedupKey(target string, finding *Finding) string {
+	parts := []string{target, finding.Title}
+	values := map[string]string{}
+	for _, prop := range finding.Props {
+		if contains(identityProps, prop.Name) {
+			values[prop.Name] = prop.Value
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, name+"="+values[name])
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])[:20]
+}
+
+// findingProp returns the value of a Finding property
+func findingProp(finding *Finding, name string) string {
+	for _, prop := range finding.Props {
+		if prop.Name == name {
+			return prop.Value
+		}
+	}
+	return ""
+}
+
+// evidenceExcerpt returns the first lines of the evidence of the
+// observations a Finding relates to
+func evidenceExcerpt(finding *Finding, observations []*Observation, maxLines int) string {
+	lines := []string{}
+	for _, obs := range observations {
+		if !contains(finding.RelatedObservations, obs.Id) {
+			continue
+		}
+		for _, evidence := range obs.RelevantEvidence {
+			lines = append(lines, evidence.Title)
+			for _, line := range strings.Split(strings.TrimRight(evidence.Description, "\n"), "\n") {
+				lines = append(lines, "  "+line)
+			}
+		}
+	}
+	if len(lines) > maxLines {
+		lines = append(lines[:maxLines], fmt.Sprintf("... %d more lines", len(lines)-maxLines))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Payload maps a Finding to an issue
+func (e IssueExport) Payload(target string, finding *Finding, observations []*Observation) IssuePayload {
+	key := DedupKey(target, finding)
+
+	project := findingProp(finding, "TicketProject")
+	if project == "" {
+		project = e.Project
+	}
+	issueType := e.IssueType
+	if issueType == "" {
+		issueType = defaultIssueType
+	}
+	priority := e.DefaultPriority
+	if priority == "" {
+		priority = defaultIssuePriority
+	}
+	if severity := strings.ToLower(findingProp(finding, "Severity")); severity != "" {
+		if mapped, ok := e.Priorities[severity]; ok {
+			priority = mapped
+		} else if mapped, ok := defaultPriorities[severity]; ok {
+			priority = mapped
+		}
+	}
+	maxLines := e.ExcerptLines
+	if maxLines <= 0 {
+		maxLines = defaultExcerptLines
+	}
+
+	var description strings.Builder
+	fmt.Fprintf(&description, "%s\n\n", finding.Description)
+	if finding.Remarks != "" {
+		fmt.Fprintf(&description, "*Remediation:* %s\n\n", finding.Remarks)
+	}
+	fmt.Fprintf(&description, "*Host:* %s\n", target)
+	for _, prop := range finding.Props {
+		fmt.Fprintf(&description, "*%s:* %s\n", prop.Name, prop.Value)
+	}
+	if excerpt := evidenceExcerpt(finding, observations, maxLines); excerpt != "" {
+		fmt.Fprintf(&description, "\n*Evidence:*\n{noformat}\n%s\n{noformat}\n", excerpt)
+	}
+	fmt.Fprintf(&description, "\nDedup key: %s\n", key)
+
+	labels := append([]string{}, e.Labels...)
+	labels = append(labels, dedupLabelPrefix+key)
+	if team := findingProp(finding, "Team"); team != "" {
+		labels = append(labels, "team-"+strings.ReplaceAll(team, " ", "-"))
+	}
+
+	return IssuePayload{
+		Fields: IssueFields{
+			Project:     IssueKey{project},
+			Summary:     truncate(fmt.Sprintf("%s on %s", finding.Title, target), issueSummaryCharacters),
+			Description: truncate(description.String(), issueDescriptionLimit),
+			IssueType:   IssueName{issueType},
+			Priority:    IssueName{priority},
+			Labels:      labels,
+		},
+		Properties: []IssueProperty{{Key: dedupPropertyKey, Value: map[string]string{
+			"key":      key,
+			"finding":  finding.Id,
+			"severity": strings.ToLower(findingProp(finding, "Severity")),
+		}}},
+	}
+}
+
+// searchEndpoint returns the URL of the issue search
+func (e IssueExport) searchEndpoint() (string, error) {
+	if e.SearchURL != "" {
+		return e.SearchURL, nil
+	}
+	parsed, err := url.Parse(e.URL)
+	if err != nil || !strings.HasSuffix(parsed.Path, "/issue") {
+		return "", fmt.Errorf("issue export requires a search_url for %s", e.URL)
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/issue") + "/search"
+	parsed.RawQuery = ""
+	return parsed.String(), nil
+}
+
+// Export writes or posts an issue for each Finding. Posted Findings that
+// already have an open issue, found by their dedup label, update or skip it
+// instead of creating another. A Finding that fails to export does not stop
+// the others; the failures are returned together.
+func (e IssueExport) Export(target string, findings []*Finding, observations []*Observation) error {
+	if e.Directory == "" && e.URL == "" {
+		return fmt.Errorf("issue export requires a directory or a url")
+	}
+	if e.Existing != "" && e.Existing != existingIssueUpdate && e.Existing != existingIssueSkip {
+		return fmt.Errorf("unknown existing issue mode %q", e.Existing)
+	}
+	search := ""
+	if e.URL != "" {
+		endpoint, err := e.searchEndpoint()
+		if err != nil {
+			return err
+		}
+		search = endpoint
+	}
+	timeout := defaultExportTimeout
+	if parsed, err := time.ParseDuration(e.Timeout); err == nil && parsed > 0 {
+		timeout = parsed
+	}
+	client := &http.Client{Timeout: timeout}
+
+	if e.Directory != "" {
+		if err := os.MkdirAll(e.Directory, 0o755); err != nil {
+			return fmt.Errorf("failed to create export directory: %v", err)
+		}
+	}
+	errs := []error{}
+	for _, finding := range findings {
+		if err := e.exportFinding(client, search, target, finding, observations); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", finding.Title, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// exportFinding writes or posts the issue of a single Finding
+func (e IssueExport) exportFinding(client *http.Client, search string, target string, finding *Finding, observations []*Observation) error {
+	payload := e.Payload(target, finding, observations)
+	body, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode issue: %v", err)
+	}
+	key := DedupKey(target, finding)
+
+	// Files are named by dedup key, so a repeated Finding replaces its
+	// previous export
+	if e.Directory != "" {
+		if err := os.WriteFile(filepath.Join(e.Directory, key+".json"), append(body, '\n'), 0o644); err != nil {
+			return fmt.Errorf("failed to write issue: %v", err)
+		}
+	}
+	if e.URL == "" {
+		return nil
+	}
+	existing, err := e.findIssue(client, search, key)
+	if err != nil {
+		return err
+	}
+	switch {
+	case existing == nil:
+		if _, err := e.send(client, http.MethodPost, e.URL, body); err != nil {
+			return fmt.Errorf("failed to post issue: %v", err)
+		}
+	case e.Existing == existingIssueSkip:
+		// The open issue is left as it is
+	default:
+		update := IssueUpdate{
+			Fields: IssueUpdateFields{
+				Summary:     payload.Fields.Summary,
+				Description: payload.Fields.Description,
+			},
+			Properties: payload.Properties,
+		}
+		for _, label := range payload.Fields.Labels {
+			update.Update.Labels = append(update.Update.Labels, IssueLabelEdit{Add: label})
+		}
+		severity := strings.ToLower(findingProp(finding, "Severity"))
+		if stored := existing.Properties[dedupPropertyKey].Severity; stored != nil && *stored != severity {
+			update.Fields.Priority = &payload.Fields.Priority
+		}
+		encoded, err := json.Marshal(update)
+		if err != nil {
+			return fmt.Errorf("failed to encode issue: %v", err)
+		}
+		if _, err := e.send(client, http.MethodPut, strings.TrimSuffix(e.URL, "/")+"/"+url.PathEscape(existing.Key), encoded); err != nil {
+			return fmt.Errorf("failed to update issue %s: %v", existing.Key, err)
+		}
+	}
+	return nil
+}
+
+// findIssue returns the open issue with the dedup label of a Finding, or nil
+// if there is none
+func (e IssueExport) findIssue(client *http.Client, search string, key string) (*existingIssue, error) {
+	query := url.Values{}
+	query.Set("jql", fmt.Sprintf(`labels = "%s%s" AND statusCategory != Done ORDER BY created ASC`, dedupLabelPrefix, key))
+	query.Set("fields", "key")
+	query.Set("properties", dedupPropertyKey)
+	query.Set("maxResults", "1")
+	separator := "?"
+	if strings.Contains(search, "?") {
+		separator = "&"
+	}
+	body, err := e.send(client, http.MethodGet, search+separator+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search issues: %v", err)
+	}
+	result := issueSearchResult{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to read issue search: %v", err)
+	}
+	if len(result.Issues) == 0 {
+		return nil, nil
+	}
+	return &result.Issues[0], nil
+}
+
+// send makes an authenticated request to the issue tracker and returns the
+// response body
+func (e IssueExport) send(client *http.Client, method string, target string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Accept", "application/json")
+	if e.Username != "" {
+		request.SetBasicAuth(e.Username, e.Token)
+	} else if e.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+e.Token)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return nil, fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(detail)))
+	}
+	return io.ReadAll(io.LimitReader(response.Body, 1<<20))
+}
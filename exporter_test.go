@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+)
+
+func TestDedupKey(t *testing.T) {
+	finding := &Finding{Id: "1", Title: "Forbidden Process Running", Props: []*Property{
+		{Name: "Check", Value: "procs"},
+		{Name: "Rule", Value: "tftp"},
+	}}
+	key := DedupKey("root@web-01:22", finding)
+	if len(key) != 20 {
+		t.Fatalf("expected a 20 character key, got %q", key)
+	}
+	tests := []struct {
+		name    string
+		target  string
+		finding *Finding
+		same    bool
+	}{
+		{"new finding id", "root@web-01:22", &Finding{Id: "2", Title: finding.Title, Props: finding.Props}, true},
+		{"property order", "root@web-01:22", &Finding{Title: finding.Title, Props: []*Property{finding.Props[1], finding.Props[0]}}, true},
+		{"volatile properties", "root@web-01:22", &Finding{Title: finding.Title, Props: append([]*Property{{Name: "Pid", Value: "1044"}, {Name: "Age", Value: "3h"}}, finding.Props...)}, true},
+		{"routing properties", "root@web-01:22", &Finding{Title: finding.Title, Props: append([]*Property{{Name: "Team", Value: "web"}, {Name: "Severity", Value: "high"}}, finding.Props...)}, true},
+		{"other host", "root@web-02:22", finding, false},
+		{"other title", "root@web-01:22", &Finding{Title: "Required Process Not Running", Props: finding.Props}, false},
+		{"other rule", "root@web-01:22", &Finding{Title: finding.Title, Props: []*Property{{Name: "Check", Value: "procs"}, {Name: "Rule", Value: "telnet"}}}, false},
+	}
+	for _, test := range tests {
+		if same := DedupKey(test.target, test.finding) == key; same != test.same {
+			t.Errorf("%s: expected the same key %t, got %t", test.name, test.same, same)
+		}
+	}
+}
+
+func TestIssuePayload(t *testing.T) {
+	obs := &Observation{Id: "obs-1", RelevantEvidence: []*Evidence{{Title: "sshd", Description: "line 1\nline 2\nline 3\n"}}}
+	tests := []struct {
+		name     string
+		export   IssueExport
+		props    []*Property
+		project  string
+		priority string
+		labels   []string
+	}{
+		{"defaults", IssueExport{Project: "OPS"}, nil, "OPS", "Medium", nil},
+		{"vulnerability severity", IssueExport{Project: "OPS"}, []*Property{{Name: "Severity", Value: "Critical"}}, "OPS", "Highest", nil},
+		{"configured priorities", IssueExport{Project: "OPS", Priorities: map[string]string{"low": "Lowest"}, DefaultPriority: "Low"}, []*Property{{Name: "Severity", Value: "low"}}, "OPS", "Lowest", nil},
+		{"unknown severity", IssueExport{Project: "OPS", DefaultPriority: "Low"}, []*Property{{Name: "Severity", Value: "info"}}, "OPS", "Low", nil},
+		{"ownership", IssueExport{Project: "OPS", Labels: []string{"compliance"}}, []*Property{{Name: "TicketProject", Value: "SEC"}, {Name: "Team", Value: "web ops"}}, "SEC", "Medium", []string{"compliance", "team-web-ops"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			finding := &Finding{Id: "f-1", Title: "Weak Cipher", Description: "A weak cipher is enabled.", Remarks: "Disable it.", RelatedObservations: []string{"obs-1"}, Props: test.props}
+			payload := test.export.Payload("root@web-01:22", finding, []*Observation{obs})
+			key := DedupKey("root@web-01:22", finding)
+			fields := payload.Fields
+			if fields.Project.Key != test.project || fields.Priority.Name != test.priority || fields.IssueType.Name != "Bug" || fields.Summary != "Weak Cipher on root@web-01:22" {
+				t.Errorf("unexpected fields %+v", fields)
+			}
+			labels := []string{}
+			for _, label := range fields.Labels {
+				if label != "cf-dedup-"+key {
+					labels = append(labels, label)
+				}
+			}
+			if !contains(fields.Labels, "cf-dedup-"+key) || !slices.Equal(labels, append([]string{}, test.labels...)) {
+				t.Errorf("expected labels %v and the dedup label, got %v", test.labels, fields.Labels)
+			}
+			for _, part := range []string{"A weak cipher is enabled.", "*Remediation:* Disable it.", "*Host:* root@web-01:22", "{noformat}\nsshd\n  line 1\n  line 2\n  line 3\n{noformat}", "Dedup key: " + key} {
+				if !strings.Contains(fields.Description, part) {
+					t.Errorf("expected the description to contain %q, got\n%s", part, fields.Description)
+				}
+			}
+			if len(payload.Properties) != 1 || payload.Properties[0].Key != "cf-dedup-key" {
+				t.Errorf("expected the dedup key property, got %+v", payload.Properties)
+			}
+		})
+	}
+
+	long := &Finding{Title: strings.Repeat("x", 300)}
+	if summary := (IssueExport{}).Payload("host", long, nil).Fields.Summary; len([]rune(summary)) != issueSummaryCharacters {
+		t.Errorf("expected the summary to be truncated to %d characters, got %d", issueSummaryCharacters, len(summary))
+	}
+}
+
+func TestCheckSeveritySetsPriority(t *testing.T) {
+	config := SSHConfig{Host: "web-01"}
+	findings := []*Finding{
+		{Title: "Weak Cipher", Props: []*Property{{Name: "Check", Value: "tls"}}},
+		{Title: "CVE-2024-6387: regreSSHion", Props: []*Property{{Name: "Severity", Value: "critical"}}},
+	}
+	applyRouting(findings, config.RoutingProps(Check{Id: "tls", Severity: "High"}))
+	export := IssueExport{Project: "OPS"}
+	priorities := []string{}
+	for _, finding := range findings {
+		priorities = append(priorities, export.Payload("root@web-01:22", finding, nil).Fields.Priority.Name)
+	}
+	if !slices.Equal(priorities, []string{"High", "Highest"}) {
+		t.Errorf("expected the check severity unless the finding has its own, got %v", priorities)
+	}
+}
+
+// issueTracker is a stand-in for the Jira issue and search endpoints. It
+// keeps the severity recorded on each issue and the last edit of each, and
+// fails to create issues whose summary contains failSummary.
+type issueTracker struct {
+	mu          sync.Mutex
+	open        map[string]string
+	severities  map[string]string
+	updates     map[string]IssueUpdate
+	failSummary string
+	requests    []string
+}
+
+func (tracker *issueTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	tracker.requests = append(tracker.requests, r.Method+" "+r.URL.Path)
+	if user, token, ok := r.BasicAuth(); !ok || user != "bot" || token != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/rest/api/2/search":
+		result := map[string][]map[string]interface{}{"issues": {}}
+		for label, key := range tracker.open {
+			if strings.Contains(r.URL.Query().Get("jql"), `labels = "`+label+`"`) {
+				issue := map[string]interface{}{"key": key}
+				if severity, ok := tracker.severities[key]; ok && r.URL.Query().Get("properties") == dedupPropertyKey {
+					issue["properties"] = map[string]interface{}{dedupPropertyKey: map[string]string{"severity": severity}}
+				}
+				result["issues"] = append(result["issues"], issue)
+			}
+		}
+		json.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPost && r.URL.Path == "/rest/api/2/issue":
+		payload := IssuePayload{}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &payload)
+		if tracker.failSummary != "" && strings.Contains(payload.Fields.Summary, tracker.failSummary) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for _, label := range payload.Fields.Labels {
+			if strings.HasPrefix(label, dedupLabelPrefix) {
+				tracker.open[label] = "OPS-" + string(rune('0'+len(tracker.open)+1))
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/rest/api/2/issue/"):
+		update := IssueUpdate{}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &update)
+		if tracker.updates != nil {
+			tracker.updates[strings.TrimPrefix(r.URL.Path, "/rest/api/2/issue/")] = update
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestIssueExportDeduplicates(t *testing.T) {
+	findings := []*Finding{
+		{Id: "1", Title: "Weak Cipher", Props: []*Property{{Name: "Check", Value: "tls"}}},
+		{Id: "2", Title: "Forbidden Process Running", Props: []*Property{{Name: "Check", Value: "procs"}}},
+	}
+	tests := []struct {
+		existing string
+		want     []string
+	}{
+		{"", []string{
+			"GET /rest/api/2/search", "POST /rest/api/2/issue", "GET /rest/api/2/search", "POST /rest/api/2/issue",
+			"GET /rest/api/2/search", "PUT /rest/api/2/issue/OPS-1", "GET /rest/api/2/search", "PUT /rest/api/2/issue/OPS-2",
+		}},
+		{"skip", []string{
+			"GET /rest/api/2/search", "POST /rest/api/2/issue", "GET /rest/api/2/search", "POST /rest/api/2/issue",
+			"GET /rest/api/2/search", "GET /rest/api/2/search",
+		}},
+	}
+	for _, test := range tests {
+		tracker := &issueTracker{open: map[string]string{}}
+		server := httptest.NewServer(tracker)
+		export := IssueExport{URL: server.URL + "/rest/api/2/issue", Username: "bot", Token: "secret", Project: "OPS", Existing: test.existing}
+		// The second run finds the issues of the first
+		for run := 0; run < 2; run++ {
+			if err := export.Export("root@web-01:22", findings, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		server.Close()
+		if !slices.Equal(tracker.requests, test.want) {
+			t.Errorf("%q: expected requests\n%v\ngot\n%v", test.existing, test.want, tracker.requests)
+		}
+	}
+}
+
+func TestIssueExportUpdatesExistingIssues(t *testing.T) {
+	tracker := &issueTracker{open: map[string]string{}, severities: map[string]string{}, updates: map[string]IssueUpdate{}}
+	server := httptest.NewServer(tracker)
+	defer server.Close()
+	export := IssueExport{URL: server.URL + "/rest/api/2/issue", Username: "bot", Token: "secret", Project: "OPS", Labels: []string{"compliance"}}
+	findings := []*Finding{
+		{Id: "1", Title: "Weak Cipher", Props: []*Property{{Name: "Check", Value: "tls"}, {Name: "Severity", Value: "high"}}},
+		{Id: "2", Title: "Forbidden Process Running", Props: []*Property{{Name: "Check", Value: "procs"}, {Name: "Severity", Value: "low"}}},
+		{Id: "3", Title: "Reboot Pending", Props: []*Property{{Name: "Check", Value: "updates"}, {Name: "Severity", Value: "low"}}},
+	}
+	for _, finding := range findings {
+		tracker.open[dedupLabelPrefix+DedupKey("root@web-01:22", finding)] = "OPS-" + finding.Id
+	}
+	// OPS-1 was exported at medium, OPS-2 at the same severity and OPS-3
+	// before severities were recorded
+	tracker.severities["OPS-1"] = "medium"
+	tracker.severities["OPS-2"] = "low"
+	if err := export.Export("root@web-01:22", findings, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		issue    string
+		priority string
+	}{
+		{"OPS-1", "High"},
+		{"OPS-2", ""},
+		{"OPS-3", ""},
+	}
+	for _, test := range tests {
+		update, ok := tracker.updates[test.issue]
+		if !ok {
+			t.Errorf("%s: expected an update", test.issue)
+			continue
+		}
+		priority := ""
+		if update.Fields.Priority != nil {
+			priority = update.Fields.Priority.Name
+		}
+		if priority != test.priority {
+			t.Errorf("%s: expected priority %q, got %q", test.issue, test.priority, priority)
+		}
+		if update.Fields.Summary == "" || update.Fields.Description == "" {
+			t.Errorf("%s: expected the summary and description, got %+v", test.issue, update.Fields)
+		}
+		added := []string{}
+		for _, edit := range update.Update.Labels {
+			added = append(added, edit.Add)
+		}
+		if !contains(added, "compliance") || len(added) != 2 {
+			t.Errorf("%s: expected the labels to be added, got %v", test.issue, added)
+		}
+	}
+}
+
+func TestIssueExportContinuesAfterFailure(t *testing.T) {
+	tracker := &issueTracker{open: map[string]string{}, failSummary: "Weak Cipher"}
+	server := httptest.NewServer(tracker)
+	defer server.Close()
+	export := IssueExport{URL: server.URL + "/rest/api/2/issue", Username: "bot", Token: "secret", Project: "OPS"}
+	findings := []*Finding{
+		{Id: "1", Title: "Weak Cipher", Props: []*Property{{Name: "Check", Value: "tls"}}},
+		{Id: "2", Title: "Forbidden Process Running", Props: []*Property{{Name: "Check", Value: "procs"}}},
+	}
+	err := export.Export("root@web-01:22", findings, nil)
+	if err == nil || !strings.Contains(err.Error(), "Weak Cipher: failed to post issue: 500") {
+		t.Errorf("expected the failed Finding to be reported, got %v", err)
+	}
+	if len(tracker.open) != 1 {
+		t.Errorf("expected the second Finding to be exported, got %v", tracker.open)
+	}
+}
+
+func TestIssueExportErrors(t *testing.T) {
+	tracker := &issueTracker{open: map[string]string{}}
+	server := httptest.NewServer(tracker)
+	defer server.Close()
+	finding := &Finding{Title: "Weak Cipher"}
+	tests := []struct {
+		export IssueExport
+		error  string
+	}{
+		{IssueExport{}, "requires a directory or a url"},
+		{IssueExport{URL: server.URL + "/issues/new"}, "requires a search_url"},
+		{IssueExport{URL: server.URL + "/rest/api/2/issue", Existing: "close"}, "unknown existing issue mode"},
+		{IssueExport{URL: server.URL + "/rest/api/2/issue", Username: "bot", Token: "wrong"}, "401 Unauthorized"},
+	}
+	for _, test := range tests {
+		err := test.export.Export("root@web-01:22", []*Finding{finding}, nil)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%+v: expected %q, got %v", test.export, test.error, err)
+		}
+	}
+}
+
+func TestIssueExportDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "issues")
+	finding := &Finding{Id: "1", Title: "Weak Cipher"}
+	export := IssueExport{Directory: dir, Project: "OPS"}
+	for run := 0; run < 2; run++ {
+		if err := export.Export("root@web-01:22", []*Finding{finding}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != DedupKey("root@web-01:22", finding)+".json" {
+		t.Errorf("expected a single file named by the dedup key, got %v", entries)
+	}
+}
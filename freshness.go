@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// freshnessContentBytes is how much of each file is read to find an
+// embedded timestamp
+const freshnessContentBytes = 65536
+
+const defaultMaxClockSkew = 5 * time.Minute
+
+// FileFreshnessCheck asserts that files were updated recently, e.g. backup
+// markers, antivirus definitions and rotated logs
+type FileFreshnessCheck struct {
+	// Paths are files or globs on the host
+	Paths  []string `json:"paths" yaml:"paths"`
+	MaxAge string   `json:"max_age" yaml:"max_age"`
+
+	// Newest only requires the most recent file matched by each path to be
+	// fresh, for rotated files such as dated backups
+	Newest bool `json:"newest,omitempty" yaml:"newest,omitempty"`
+
+	// Timestamp reads the time from the file content instead of its mtime
+	Timestamp *EmbeddedTimestamp `json:"timestamp,omitempty" yaml:"timestamp,omitempty"`
+
+	// MaxClockSkew raises a Finding when the host clock is further than
+	// this from the collection time, default 5m
+	MaxClockSkew string `json:"max_clock_skew,omitempty" yaml:"max_clock_skew,omitempty"`
+}
+
+// EmbeddedTimestamp locates a timestamp in the first 64KiB of a file. The
+// first submatch of Pattern, or the whole match, is parsed with Layout,
+// which is a Go time layout or "unix". Times without a zone are read in
+// Timezone, default UTC.
+type EmbeddedTimestamp struct {
+	Pattern  string `json:"pattern" yaml:"pattern"`
+	Layout   string `json:"layout" yaml:"layout"`
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+
+	// External marks timestamps written elsewhere, such as a vendor's
+	// definition release time, which are not corrected for clock skew
+	External bool `json:"external,omitempty" yaml:"external,omitempty"`
+}
+
+// Parse finds and parses the timestamp in content
+func (t EmbeddedTimestamp) Parse(content string) (time.Time, error) {
+	re, err := regexp.Compile(t.Pattern)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp pattern %q: %v", t.Pattern, err)
+	}
+	match := re.FindStringSubmatch(content)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("no timestamp matching %q", t.Pattern)
+	}
+	value := match[0]
+	if len(match) > 1 {
+		value = match[1]
+	}
+	if t.Layout == "unix" {
+		parsed := unixTime(value)
+		if parsed.IsZero() {
+			return time.Time{}, fmt.Errorf("invalid unix timestamp %q", value)
+		}
+		return parsed, nil
+	}
+	location := time.UTC
+	if t.Timezone != "" {
+		location, err = time.LoadLocation(t.Timezone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timezone %q: %v", t.Timezone, err)
+		}
+	}
+	parsed, err := time.ParseInLocation(t.Layout, strings.TrimSpace(value), location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse timestamp %q: %v", value, err)
+	}
+	return parsed, nil
+}
+
+// FileTimestamp is a remote file and its mtime by the remote clock
+type FileTimestamp struct {
+	Pattern string
+	Path    string
+	ModTime time.Time
+	Content string
+}
+
+// FileFreshness is the collected state: the remote clock reading and the
+// files found for each path
+type FileFreshness struct {
+	RemoteNow time.Time
+	Files     []FileTimestamp
+}
+
+// command returns the collection script printing its headers with the
+// section marker, so file content cannot forge them
+func (c FileFreshnessCheck) command(marker string) string {
+	lines := []string{fmt.Sprintf(`printf '%snow %%s\n' "$(date +%%s)"`, marker)}
+	read := ""
+	if c.Timestamp != nil {
+		read = fmt.Sprintf(` head -c %d "$f"; echo;`, freshnessContentBytes)
+	}
+	for _, pattern := range c.Paths {
+		lines = append(lines,
+			fmt.Sprintf("printf '%spath %%s\\n' %s", marker, shellQuote(pattern)),
+			fmt.Sprintf(`for f in %s; do [ -f "$f" ] || continue; printf '%smtime %%s %%s\n' "$(stat -c %%Y "$f")" "$f";%s done`, globQuote(pattern), marker, read),
+		)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParseFileFreshness parses the output of the collection script run with
+// the section marker
+func ParseFileFreshness(output string, marker string) FileFreshness {
+	state := FileFreshness{}
+	pattern := ""
+	var current *FileTimestamp
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.HasPrefix(line, marker+"now "):
+			state.RemoteNow = unixTime(strings.TrimPrefix(line, marker+"now "))
+		case strings.HasPrefix(line, marker+"path "):
+			pattern = strings.TrimPrefix(line, marker+"path ")
+			current = nil
+		case strings.HasPrefix(line, marker+"mtime "):
+			seconds, file, _ := strings.Cut(strings.TrimPrefix(line, marker+"mtime "), " ")
+			state.Files = append(state.Files, FileTimestamp{
+				Pattern: pattern,
+				Path:    file,
+				ModTime: unixTime(seconds),
+			})
+			current = &state.Files[len(state.Files)-1]
+		default:
+			if current != nil {
+				current.Content += line + "\n"
+			}
+		}
+	}
+	return state
+}
+
+// ClockSkew is how far the remote clock is behind the collection time
+func (s FileFreshness) ClockSkew(collected time.Time) time.Duration {
+	if s.RemoteNow.IsZero() {
+		return 0
+	}
+	return collected.Sub(s.RemoteNow)
+}
+
+func runFileFreshnessCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	if check.FileFreshness == nil || len(check.FileFreshness.Paths) == 0 {
+		return nil, nil, fmt.Errorf("file_freshness check requires paths")
+	}
+	settings := *check.FileFreshness
+	maxAge, err := time.ParseDuration(settings.MaxAge)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid max_age %q: %v", settings.MaxAge, err)
+	}
+	maxSkew := defaultMaxClockSkew
+	if settings.MaxClockSkew != "" {
+		maxSkew, err = time.ParseDuration(settings.MaxClockSkew)
+		if err != nil || maxSkew <= 0 {
+			return nil, nil, fmt.Errorf("invalid max_clock_skew %q: must be a positive duration", settings.MaxClockSkew)
+		}
+	}
+
+	// The remote clock is read first, so the collection time is taken before
+	// the command rather than after a slow transfer of file contents
+	collected := time.Now()
+	marker := newSectionMarker()
+	output, _, err := RunSessionCommand(client, settings.command(marker))
+	if err != nil {
+		return nil, nil, err
+	}
+	state := ParseFileFreshness(output, marker)
+
+	// Timestamps written by the host are moved onto the collection clock,
+	// so a host with a wrong clock neither hides nor invents stale files
+	skew := state.ClockSkew(collected)
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	props := append([]*Property{
+		{Name: "MaxAge", Value: maxAge.String()},
+		{Name: "ClockSkew", Value: skew.Round(time.Second).String()},
+	}, checkProps(check)...)
+	obs := newObservation(
+		checkTitle(check, "File Freshness"),
+		fmt.Sprintf("Checked the age of %s on %s at %s.", strings.Join(settings.Paths, ", "), target, collected.UTC().Format(time.RFC3339)),
+		props,
+		[]*Evidence{},
+		"All OK.",
+	)
+
+	findings := []*Finding{}
+	addFinding := func(title string, description string, remarks string, path string) {
+		findings = append(findings, newFinding(obs, title, description, remarks,
+			append([]*Property{{Name: "Path", Value: path}}, checkProps(check)...)))
+	}
+
+	if skew > maxSkew || -skew > maxSkew {
+		addFinding("Clock Skew",
+			fmt.Sprintf("The clock on %s is %s away from the collection time.", target, skew.Round(time.Second)),
+			"Synchronise the host clock with NTP.", "")
+	}
+
+	for _, pattern := range settings.Paths {
+		files := []FileTimestamp{}
+		for _, file := range state.Files {
+			if file.Pattern == pattern {
+				files = append(files, file)
+			}
+		}
+		if len(files) == 0 {
+			addFinding("File Missing",
+				fmt.Sprintf("No file matching %s was found on %s.", pattern, target),
+				fmt.Sprintf("Make sure the process maintaining %s is running.", pattern), pattern)
+			continue
+		}
+
+		type dated struct {
+			path    string
+			updated time.Time
+		}
+		updates := []dated{}
+		for _, file := range files {
+			updated := file.ModTime.Add(skew)
+			if settings.Timestamp != nil {
+				updated, err = settings.Timestamp.Parse(file.Content)
+				if err != nil {
+					addFinding("File Timestamp Unreadable",
+						fmt.Sprintf("%s on %s: %v.", file.Path, target, err),
+						"Check the timestamp pattern and layout against the file.", file.Path)
+					continue
+				}
+				if !settings.Timestamp.External {
+					updated = updated.Add(skew)
+				}
+			}
+			updates = append(updates, dated{file.Path, updated})
+		}
+		if settings.Newest && len(updates) > 0 {
+			newest := updates[0]
+			for _, update := range updates[1:] {
+				if update.updated.After(newest.updated) {
+					newest = update
+				}
+			}
+			updates = []dated{newest}
+		}
+
+		for _, update := range updates {
+			age := collected.Sub(update.updated)
+			obs.RelevantEvidence = append(obs.RelevantEvidence, &Evidence{
+				Title:       update.path,
+				Description: fmt.Sprintf("Updated %s, %s ago.", update.updated.UTC().Format(time.RFC3339), age.Round(time.Second)),
+				Props:       []*Property{{Name: "Age", Value: strconv.FormatInt(int64(age.Seconds()), 10)}},
+			})
+			if age > maxAge {
+				addFinding("File Not Recently Updated",
+					fmt.Sprintf("%s on %s was last updated %s ago, more than the allowed %s.", update.path, target, age.Round(time.Second), maxAge),
+					fmt.Sprintf("Check the job maintaining %s.", update.path), update.path)
+			}
+		}
+	}
+
+	if len(findings) > 0 {
+		obs.Remarks = fmt.Sprintf("%d freshness problems were found.", len(findings))
+	}
+	return []*Observation{obs}, findings, nil
+}
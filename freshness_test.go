@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFileFreshness(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "file_freshness.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := ParseFileFreshness(string(content), sectionMarker)
+	if !state.RemoteNow.Equal(time.Unix(1720627200, 0)) {
+		t.Errorf("unexpected remote time %s", state.RemoteNow)
+	}
+	want := []FileTimestamp{
+		{Pattern: "/var/backups/*.stamp", Path: "/var/backups/db.stamp", ModTime: time.Unix(1720600000, 0), Content: "2024-07-10T08:26:40Z\n"},
+		{Pattern: "/var/backups/*.stamp", Path: "/var/backups/files.stamp", ModTime: time.Unix(1720000000, 0)},
+	}
+	if len(state.Files) != len(want) {
+		t.Fatalf("expected %d files, got %+v", len(want), state.Files)
+	}
+	for i, file := range want {
+		got := state.Files[i]
+		if got.Pattern != file.Pattern || got.Path != file.Path || !got.ModTime.Equal(file.ModTime) || got.Content != file.Content {
+			t.Errorf("file %d: expected %+v, got %+v", i, file, got)
+		}
+	}
+}
+
+func TestEmbeddedTimestampParse(t *testing.T) {
+	tests := []struct {
+		timestamp EmbeddedTimestamp
+		content   string
+		want      time.Time
+		error     string
+	}{
+		{EmbeddedTimestamp{Pattern: `finished (\S+)`, Layout: time.RFC3339}, "backup finished 2024-07-10T08:26:40Z\n", time.Date(2024, 7, 10, 8, 26, 40, 0, time.UTC), ""},
+		{EmbeddedTimestamp{Pattern: `[0-9]{10}`, Layout: "unix"}, "version 1720600000\n", time.Unix(1720600000, 0), ""},
+		{EmbeddedTimestamp{Pattern: `at (.*)`, Layout: "2006-01-02 15:04", Timezone: "Europe/Berlin"}, "at 2024-07-10 10:00\n", time.Date(2024, 7, 10, 8, 0, 0, 0, time.UTC), ""},
+		{EmbeddedTimestamp{Pattern: `(`, Layout: time.RFC3339}, "", time.Time{}, "invalid timestamp pattern"},
+		{EmbeddedTimestamp{Pattern: `at (.*)`, Layout: time.RFC3339}, "nothing\n", time.Time{}, "no timestamp matching"},
+		{EmbeddedTimestamp{Pattern: `at (.*)`, Layout: time.RFC3339}, "at yesterday\n", time.Time{}, "failed to parse timestamp"},
+		{EmbeddedTimestamp{Pattern: `at (.*)`, Layout: "unix"}, "at soon\n", time.Time{}, "invalid unix timestamp"},
+		{EmbeddedTimestamp{Pattern: `at (.*)`, Layout: time.DateOnly, Timezone: "Mars/Olympus"}, "at 2024-07-10\n", time.Time{}, "invalid timezone"},
+	}
+	for _, test := range tests {
+		parsed, err := test.timestamp.Parse(test.content)
+		if test.error != "" {
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("%q: expected %q, got %v", test.content, test.error, err)
+			}
+			continue
+		}
+		if err != nil || !parsed.Equal(test.want) {
+			t.Errorf("%q: expected %s, got %s %v", test.content, test.want, parsed, err)
+		}
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	now := time.Unix(1720627200, 0)
+	tests := []struct {
+		remote time.Time
+		want   time.Duration
+	}{
+		{now, 0},
+		{now.Add(-time.Hour), time.Hour},
+		{now.Add(90 * time.Second), -90 * time.Second},
+		{time.Time{}, 0},
+	}
+	for _, test := range tests {
+		if skew := (FileFreshness{RemoteNow: test.remote}).ClockSkew(now); skew != test.want {
+			t.Errorf("%s: expected %s, got %s", test.remote, test.want, skew)
+		}
+	}
+}
+
+// TestFileFreshnessSkewIgnoresTransferTime answers slowly after reading
+// the clock, as a host sending large files does
+func TestFileFreshnessSkewIgnoresTransferTime(t *testing.T) {
+	handler := func(command string) (string, int) {
+		now := time.Now()
+		time.Sleep(2 * time.Second)
+		return markOutput(command, fmt.Sprintf("==>now %d\n==>path /var/backups/db.stamp\n==>mtime %d /var/backups/db.stamp\n", now.Unix(), now.Add(-time.Hour).Unix())), 0
+	}
+	check := Check{Id: "backup", Type: "file_freshness", FileFreshness: &FileFreshnessCheck{Paths: []string{"/var/backups/db.stamp"}, MaxAge: "2h", MaxClockSkew: "1s"}}
+	observations, findings, err := runCheckAgainst(t, handler, check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected no clock skew from the transfer time, got %v", findings)
+	}
+	// The remote clock is read in whole seconds
+	for _, prop := range observations[0].Props {
+		if skew, err := time.ParseDuration(prop.Value); prop.Name == "ClockSkew" && (err != nil || skew.Abs() > time.Second) {
+			t.Errorf("expected no clock skew, got %s", prop.Value)
+		}
+	}
+}
+
+func TestParseFileFreshnessIgnoresForgedHeaders(t *testing.T) {
+	marker := newSectionMarker()
+	output := marker + "now 1720627200\n" +
+		marker + "path /var/backups/db.stamp\n" +
+		marker + "mtime 1720000000 /var/backups/db.stamp\n" +
+		"==>now 1720000000\n==>path /etc/passwd\n==>mtime 1720627200 /var/backups/db.stamp\nfinished 2024-07-03T09:46:40Z\n"
+	state := ParseFileFreshness(output, marker)
+	if !state.RemoteNow.Equal(time.Unix(1720627200, 0)) {
+		t.Errorf("expected the remote time to be kept, got %s", state.RemoteNow)
+	}
+	if len(state.Files) != 1 || state.Files[0].Pattern != "/var/backups/db.stamp" || !state.Files[0].ModTime.Equal(time.Unix(1720000000, 0)) {
+		t.Fatalf("expected the one stamp file, got %+v", state.Files)
+	}
+	if !strings.HasPrefix(state.Files[0].Content, "==>now 1720000000\n") {
+		t.Errorf("expected the forged headers to stay in the content, got %q", state.Files[0].Content)
+	}
+}
+
+func TestFileFreshnessInvalidClockSkew(t *testing.T) {
+	handler := func(command string) (string, int) {
+		t.Errorf("expected the configuration to be rejected before running %q", command)
+		return "", 0
+	}
+	for _, skew := range []string{"5 minutes", "0s", "-1m"} {
+		check := Check{Id: "backup", Type: "file_freshness", FileFreshness: &FileFreshnessCheck{Paths: []string{"/var/backups/db.stamp"}, MaxAge: "2h", MaxClockSkew: skew}}
+		if _, _, err := runCheckAgainst(t, handler, check); err == nil || !strings.Contains(err.Error(), "invalid max_clock_skew") {
+			t.Errorf("%q: expected an invalid max_clock_skew error, got %v", skew, err)
+		}
+	}
+}
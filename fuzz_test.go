@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The fuzz targets feed configuration and command output into the parsers,
+// which must never panic whatever a host returns. The seed corpus in
+// testdata/seeds holds real-world outputs of the collection scripts.
+
+// addSeeds adds the seed files matching the pattern to the corpus
+func addSeeds(f *testing.F, pattern string) {
+	f.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "seeds", pattern))
+	if err != nil || len(paths) == 0 {
+		f.Fatalf("no seeds match %s", pattern)
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(content))
+	}
+}
+
+// includeLoader returns a fixed file for every include pattern
+func includeLoader(content string) FileLoader {
+	return func(pattern string) ([]IncludedFile, error) {
+		return []IncludedFile{{Path: strings.TrimSuffix(pattern, "*.conf") + "included.conf", Content: content}}, nil
+	}
+}
+
+func FuzzLoadConfig(f *testing.F) {
+	addSeeds(f, "config.yaml")
+	f.Add("host: example.com\nchecks: [{type: pam}]")
+	f.Add("checks: !!map {}")
+	f.Fuzz(func(t *testing.T, yamlString string) {
+		config, err := LoadConfig(yamlString)
+		if err != nil {
+			return
+		}
+		for _, check := range config.Checks {
+			config.RoutingProps(check)
+		}
+		SelectChecks(config, []string{"command"})
+	})
+}
+
+func FuzzNormaliseLines(f *testing.F) {
+	addSeeds(f, "sshd_config.txt")
+	addSeeds(f, "systemd.txt")
+	f.Add("a\r\n  # comment\n\n\tb  c\r")
+	f.Fuzz(func(t *testing.T, content string) {
+		for _, check := range []GoldenFileCheck{
+			{},
+			{CommentPrefix: "#", IgnoreWhitespace: true, Ignore: []string{`^Port `}},
+		} {
+			lines, err := check.NormaliseLines(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			UnifiedDiff(lines, []string{"Port 22"}, "expected", "actual", 3)
+		}
+	})
+}
+
+func FuzzImportInSpec(f *testing.F) {
+	addSeeds(f, "inspec.txt")
+	f.Add("control 'x' do\n  describe file(\"/a\") do\n    its('mode') { should cmp 0644 }\n  end\nend\n")
+	f.Fuzz(func(t *testing.T, content string) {
+		ImportInSpec("fuzz.rb", strings.NewReader(content))
+	})
+}
+
+func FuzzParseServerVersion(f *testing.F) {
+	f.Add("SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.10")
+	f.Add("SSH-2.0-OpenSSH_7.4")
+	f.Add("SSH-2.0-dropbear_2022.83")
+	f.Add("SSH-1.99-Cisco-1.25")
+	f.Fuzz(func(t *testing.T, banner string) {
+		ParseServerVersion(banner)
+	})
+}
+
+func FuzzParseKexInit(f *testing.F) {
+	lists := []string{
+		"curve25519-sha256,diffie-hellman-group14-sha256,kex-strict-s-v00@openssh.com",
+		"ssh-ed25519,rsa-sha2-512",
+		"chacha20-poly1305@openssh.com,aes256-ctr", "chacha20-poly1305@openssh.com,aes256-ctr",
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256-etm@openssh.com",
+		"none,zlib@openssh.com", "none,zlib@openssh.com",
+		"", "",
+	}
+	payload := append([]byte{msgKexInit}, make([]byte, 16)...)
+	for _, list := range lists {
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(list)))
+		payload = append(payload, list...)
+	}
+	payload = append(payload, 0, 0, 0, 0, 0)
+	f.Add(payload)
+	f.Add(payload[:40])
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		ParseKexInit(payload)
+	})
+}
+
+func FuzzPacketSniffer(f *testing.F) {
+	f.Add([]byte("SSH-2.0-OpenSSH_9.6\r\n\x00\x00\x00\x0c\x0a\x15\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"))
+	f.Add([]byte("banner\r\nSSH-2.0-x\r\n\x00\x00\x00\x10\x04\x01\x00\x00\x00\x02\x00\x00\x00\x09bye"))
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		tracer := &Tracer{kex: map[string]*KexInit{}}
+		sniffer := &packetSniffer{tracer: tracer, side: "server"}
+		for len(stream) > 0 {
+			n := min(len(stream), 7)
+			sniffer.feed(stream[:n])
+			stream = stream[n:]
+		}
+	})
+}
+
+func FuzzParseScheduledTasks(f *testing.F) {
+	addSeeds(f, "scheduled_tasks.txt")
+	f.Add("==>table 644 root root /etc/cron.d/x\n@daily\n* * *\n==>script\n==>")
+	f.Fuzz(func(t *testing.T, output string) {
+		ParseScheduledTasks(output, sectionMarker)
+	})
+}
+
+func FuzzParsePrivilegedFiles(f *testing.F) {
+	addSeeds(f, "privileged_files.txt")
+	f.Fuzz(func(t *testing.T, output string) {
+		ParsePrivilegedFiles(output)
+	})
+}
+
+func FuzzParseKernelModules(f *testing.F) {
+	addSeeds(f, "kernel_modules.txt")
+	f.Add("==>config\ninstall\nblacklist\n==>loaded\n\n")
+	f.Fuzz(func(t *testing.T, output string) {
+		for _, state := range ParseKernelModules(output) {
+			state.Disabled()
+		}
+	})
+}
+
+func FuzzParseDiskEncryption(f *testing.F) {
+	addSeeds(f, "disk_encryption.txt")
+	f.Add("==>lsblk\n{\"blockdevices\":null}\n==>status\n  cipher:\n")
+	f.Fuzz(func(t *testing.T, output string) {
+		ParseDiskEncryption(output)
+	})
+}
+
+func FuzzParsePendingUpdates(f *testing.F) {
+	addSeeds(f, "pending_updates_*.txt")
+	f.Add("==>now x\n==>reboot\ninstalled\nmarker\nneeds-restarting\n")
+	f.Fuzz(func(t *testing.T, output string) {
+		ParsePendingUpdates(output)
+	})
+}
+
+func FuzzParseSecretExposures(f *testing.F) {
+	addSeeds(f, "secrets.txt")
+	f.Add("==>tokens\n/a\x00:password=\"\"\n/b\x00x\n")
+	f.Fuzz(func(t *testing.T, output string) {
+		ParseSecretExposures(output, defaultSecretsMinEntropy)
+	})
+}
+
+func FuzzParseConfig(f *testing.F) {
+	addSeeds(f, "sshd_config.txt")
+	addSeeds(f, "systemd.txt")
+	addSeeds(f, "login_defs.txt")
+	addSeeds(f, "config.yaml")
+	f.Add(`{"server": {"tls": {"min_version": "1.2"}, "ports": [443, 8443]}}`)
+	f.Add("[server]\nport = 8080\n[server.tls]\nenabled = true\n")
+	f.Fuzz(func(t *testing.T, content string) {
+		formats := []string{FormatSSHD, FormatSystemd, FormatINI, FormatKeyValue, FormatDirectives, FormatJSON, FormatYAML, FormatTOML}
+		for _, format := range formats {
+			doc, err := ParseConfig(format, "/etc/fuzz.conf", content, ConfigParseOptions{IncludeDirective: "include"}, includeLoader(content))
+			if err != nil {
+				continue
+			}
+			doc.Duplicates()
+			doc.Sections()
+		}
+	})
+}
+
+func FuzzParseFileListing(f *testing.F) {
+	addSeeds(f, "file_listing.txt")
+	f.Fuzz(func(t *testing.T, output string) {
+		ParseFileListing(output, sectionMarker)
+	})
+}
+
+func FuzzFileListingContent(f *testing.F) {
+	addSeeds(f, "file_listing.txt")
+	f.Add("==>file /etc/shadow\nroot:x:0:0\n")
+	f.Fuzz(func(t *testing.T, content string) {
+		marker := newSectionMarker()
+		files := ParseFileListing(marker+"file /etc/app.conf\n"+content+"\n", marker)
+		if len(files) != 1 || files[0].Path != "/etc/app.conf" || !strings.HasPrefix(files[0].Content, content) {
+			t.Errorf("expected the content to stay in the one file, got %+v", files)
+		}
+	})
+}
+
+func FuzzParseFileFreshness(f *testing.F) {
+	addSeeds(f, "file_freshness.txt")
+	f.Add("==>mtime\n==>mtime 1 \n==>now -99999999999999999999\n")
+	f.Fuzz(func(t *testing.T, output string) {
+		ParseFileFreshness(output, sectionMarker)
+	})
+}
+
+func FuzzParseProcessList(f *testing.F) {
+	addSeeds(f, "processes.txt")
+	f.Fuzz(func(t *testing.T, output string) {
+		describeProcesses(ParseProcessList(output))
+	})
+}
+
+func FuzzParsePAM(f *testing.F) {
+	addSeeds(f, "pam.txt")
+	addSeeds(f, "login_defs.txt")
+	f.Add("auth [default=die\npassword")
+	f.Fuzz(func(t *testing.T, content string) {
+		ParsePAMStack("/etc/pam.d/fuzz", content)
+		ParseLoginDefs(content)
+		ParseKeyValues(content)
+	})
+}
+
+func FuzzParseLogForwarding(f *testing.F) {
+	addSeeds(f, "log_forwarding.txt")
+	f.Add("==>file /etc/rsyslog.conf\n*.* @[::1\n*.* action(type=\"omfwd\"\n")
+	f.Add("==>file /etc/syslog-ng/syslog-ng.conf\ndestination d { network(\"h\" port( }; log { destination(d\n")
+	f.Fuzz(func(t *testing.T, output string) {
+		ParseLogForwarding(output, sectionMarker)
+		ParseRsyslog("/etc/rsyslog.conf", output)
+		ParseSyslogNG("/etc/syslog-ng/syslog-ng.conf", output)
+		ParseJournalUpload("/etc/systemd/journal-upload.conf", output)
+	})
+}
+
+func FuzzParseWebServer(f *testing.F) {
+	addSeeds(f, "nginx.txt")
+	addSeeds(f, "apache.txt")
+	f.Add("server { ssl_protocols 'TLSv1.2 }\n")
+	f.Add("<VirtualHost\n</IfModule>\nSSLProtocol \"")
+	f.Fuzz(func(t *testing.T, content string) {
+		ParseNginx("/etc/nginx/nginx.conf", content, includeLoader("ssl_protocols TLSv1;"))
+		ParseApache("/etc/httpd/conf/httpd.conf", content, "/etc/httpd", includeLoader("SSLProtocol TLSv1"))
+	})
+}
+
+func FuzzParseCertificates(f *testing.F) {
+	addSeeds(f, "certificates.txt")
+	f.Add("==>cert /a\nnotAfter=\nsubject\n=\n")
+	f.Fuzz(func(t *testing.T, output string) {
+		ParseCertificates(output)
+	})
+}
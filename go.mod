@@ -3,13 +3,17 @@ module ssh-cf-plugin
 go 1.22.0
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/compliance-framework/assessment-runtime v0.0.0-20240707093522-9f150d08df50
+	github.com/go-sql-driver/mysql v1.8.1
 	github.com/google/uuid v1.6.0
+	github.com/lib/pq v1.10.9
 	golang.org/x/crypto v0.25.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/fatih/color v1.7.0 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/hashicorp/go-hclog v0.14.1 // indirect
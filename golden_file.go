@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultMaxDiffLines = 200
+
+var templateVariableRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// GoldenFileCheck compares a remote file with an approved local template
+type GoldenFileCheck struct {
+	// Path is the file on the host
+	Path string `json:"path" yaml:"path"`
+
+	// Template is the local golden copy. ${name} is replaced by the named
+	// variable, or by the built-in host, port and username.
+	Template  string            `json:"template" yaml:"template"`
+	Variables map[string]string `json:"variables,omitempty" yaml:"variables,omitempty"`
+
+	// Ignore holds regular expressions of lines left out of the comparison
+	Ignore []string `json:"ignore,omitempty" yaml:"ignore,omitempty"`
+
+	// CommentPrefix drops comment lines and blank lines when set, e.g. "#"
+	CommentPrefix string `json:"comment_prefix,omitempty" yaml:"comment_prefix,omitempty"`
+
+	// IgnoreWhitespace trims lines and collapses runs of whitespace
+	IgnoreWhitespace bool `json:"ignore_whitespace,omitempty" yaml:"ignore_whitespace,omitempty"`
+
+	MaxDiffLines int `json:"max_diff_lines,omitempty" yaml:"max_diff_lines,omitempty"`
+}
+
+// RenderTemplate substitutes ${name} variables, leaving unknown ones as is
+func RenderTemplate(template string, variables map[string]string) string {
+	return templateVariableRe.ReplaceAllStringFunc(template, func(match string) string {
+		name := templateVariableRe.FindStringSubmatch(match)[1]
+		if value, ok := variables[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// NormaliseLines splits content into lines and applies the configured
+// comment, whitespace and ignore rules
+func (c GoldenFileCheck) NormaliseLines(content string) ([]string, error) {
+	ignore := make([]*regexp.Regexp, len(c.Ignore))
+	for i, pattern := range c.Ignore {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %v", pattern, err)
+		}
+		ignore[i] = re
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if c.CommentPrefix != "" {
+			if index := strings.Index(line, c.CommentPrefix); index >= 0 && strings.TrimSpace(line[:index]) == "" {
+				continue
+			}
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+		}
+		if c.IgnoreWhitespace {
+			line = strings.Join(strings.Fields(line), " ")
+		}
+		ignored := false
+		for _, re := range ignore {
+			if re.MatchString(line) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+func runGoldenFileCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	if check.GoldenFile == nil || check.GoldenFile.Path == "" || check.GoldenFile.Template == "" {
+		return nil, nil, fmt.Errorf("golden_file check requires a path and a template")
+	}
+	settings := *check.GoldenFile
+
+	templateContent, err := os.ReadFile(settings.Template)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read template: %v", err)
+	}
+	variables := map[string]string{
+		"host":     config.Host,
+		"port":     config.Port,
+		"username": config.Username,
+	}
+	for name, value := range settings.Variables {
+		variables[name] = value
+	}
+	expected, err := settings.NormaliseLines(RenderTemplate(string(templateContent), variables))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	props := append([]*Property{
+		{Name: "Path", Value: settings.Path},
+		{Name: "Template", Value: settings.Template},
+	}, checkProps(check)...)
+
+	content, found, err := ReadRemoteFile(client, settings.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		obs := newObservation(
+			checkTitle(check, "Golden File Comparison"),
+			fmt.Sprintf("%s could not be read on %s.", settings.Path, target),
+			props,
+			[]*Evidence{},
+			"The file should exist and match the golden template.",
+		)
+		fndng := newFinding(
+			obs,
+			"Configuration File Missing",
+			fmt.Sprintf("%s is missing or unreadable on %s.", settings.Path, target),
+			fmt.Sprintf("Deploy %s from the golden template %s.", settings.Path, settings.Template),
+			props,
+		)
+		return []*Observation{obs}, []*Finding{fndng}, nil
+	}
+
+	actual, err := settings.NormaliseLines(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	diff := UnifiedDiff(expected, actual, settings.Template, fmt.Sprintf("%s:%s", config.Host, settings.Path), 3)
+	if diff == "" {
+		obs := newObservation(
+			checkTitle(check, "Golden File Comparison"),
+			fmt.Sprintf("%s on %s matches the golden template.", settings.Path, target),
+			props,
+			[]*Evidence{},
+			"All OK.",
+		)
+		return []*Observation{obs}, nil, nil
+	}
+
+	maxLines := settings.MaxDiffLines
+	if maxLines <= 0 {
+		maxLines = defaultMaxDiffLines
+	}
+	evidence := []*Evidence{
+		{
+			Title:       "Unified diff",
+			Description: truncateLines(diff, maxLines),
+			Props:       []*Property{{Name: "MediaType", Value: "text/x-diff"}},
+		},
+	}
+	obs := newObservation(
+		checkTitle(check, "Golden File Comparison"),
+		fmt.Sprintf("%s on %s differs from the golden template.", settings.Path, target),
+		props,
+		evidence,
+		"The file should match the golden template.",
+	)
+	fndng := newFinding(
+		obs,
+		"Configuration Drift From Golden Template",
+		fmt.Sprintf("%s on %s differs from the golden template %s.", settings.Path, target, settings.Template),
+		fmt.Sprintf("Restore %s from the golden template, or update the template if the change is approved.", settings.Path),
+		props,
+	)
+	return []*Observation{obs}, []*Finding{fndng}, nil
+}
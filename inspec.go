@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ImportIssue records a part of an InSpec profile which could not be
+// translated into a check
+type ImportIssue struct {
+	File    string
+	Line    int
+	Control string
+	Text    string
+	Reason  string
+}
+
+func (i ImportIssue) String() string {
+	location := fmt.Sprintf("%s:%d", i.File, i.Line)
+	if i.Control != "" {
+		location = fmt.Sprintf("%s (control %s)", location, i.Control)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, i.Reason, i.Text)
+}
+
+// ImportInSpecCommand implements the `import-inspec` subcommand. It reads the
+// InSpec control files given as arguments (or stdin), writes the translated
+// checks to stdout as YAML and reports untranslated parts on stderr.
+func ImportInSpecCommand(args []string) int {
+	checks := []Check{}
+	issues := []ImportIssue{}
+
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	for _, path := range args {
+		fileChecks, fileIssues, err := importInSpecFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		checks = append(checks, fileChecks...)
+		issues = append(issues, fileIssues...)
+	}
+
+	out, err := yaml.Marshal(struct {
+		Checks []Check `yaml:"checks"`
+	}{checks})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to marshal checks: %v\n", err)
+		return 1
+	}
+	os.Stdout.Write(out)
+
+	for _, issue := range issues {
+		fmt.Fprintf(os.Stderr, "untranslated: %s\n", issue)
+	}
+	fmt.Fprintf(os.Stderr, "imported %d checks, %d untranslated parts\n", len(checks), len(issues))
+	return 0
+}
+
+// importInSpecFile imports the controls of a file, or of stdin for "-"
+func importInSpecFile(path string) ([]Check, []ImportIssue, error) {
+	var reader io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open %s: %v", path, err)
+		}
+		defer file.Close()
+		reader = file
+	}
+	checks, issues, err := ImportInSpec(path, reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return checks, issues, nil
+}
+
+var (
+	inspecControlRe  = regexp.MustCompile(`^control\s+(.+?)\s+do$`)
+	inspecDescribeRe = regexp.MustCompile(`^describe\s+(.+?)\s+do$`)
+	inspecResourceRe = regexp.MustCompile(`^(\w+)(?:\s*\(\s*(.*?)\s*\))?$`)
+	inspecItRe       = regexp.MustCompile(`^it\s*\{\s*(should|should_not)\s+(.+?)\s*\}$`)
+	inspecItsRe      = regexp.MustCompile(`^its\s*\(\s*(.+?)\s*\)\s*\{\s*(should|should_not)\s+(.+?)\s*\}$`)
+	inspecMatcherRe  = regexp.MustCompile(`^(\w+\??)\s*(.*)$`)
+	inspecBlockRe    = regexp.MustCompile(`\bdo(\s*\|[^|]*\|)?$`)
+	inspecKeywordRe  = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+)
+
+// inspecParser holds the state while walking an InSpec control file
+type inspecParser struct {
+	file   string
+	checks []Check
+	issues []ImportIssue
+
+	control      *Check
+	predicates   []string
+	untranslated []string
+
+	resource *inspecResource
+}
+
+type inspecResource struct {
+	Name string
+	Arg  string
+}
+
+// ImportInSpec translates the supported subset of InSpec controls into checks.
+// Each control becomes a single command check whose predicates are joined so
+// that the command exits zero only when every translated expectation holds.
+func ImportInSpec(file string, r io.Reader) ([]Check, []ImportIssue, error) {
+	p := &inspecParser{file: file}
+
+	scanner := bufio.NewScanner(r)
+	line_number := 0
+	skipDepth := 0
+	for scanner.Scan() {
+		line_number++
+		line := strings.TrimSpace(stripRubyComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		// Skip over blocks we cannot translate, such as loops
+		if skipDepth > 0 {
+			if inspecBlockRe.MatchString(line) {
+				skipDepth++
+			} else if line == "end" {
+				skipDepth--
+			}
+			continue
+		}
+
+		switch {
+		case p.control == nil:
+			if m := inspecControlRe.FindStringSubmatch(line); m != nil {
+				id, err := parseRubyString(m[1])
+				if err != nil {
+					id = m[1]
+				}
+				p.control = &Check{Id: id}
+				continue
+			}
+			p.issue(line_number, line, "unsupported top-level statement")
+			if inspecBlockRe.MatchString(line) {
+				skipDepth = 1
+			}
+
+		case p.resource == nil:
+			if line == "end" {
+				p.finishControl(line_number)
+				continue
+			}
+			if m := inspecDescribeRe.FindStringSubmatch(line); m != nil {
+				resource, err := parseInSpecResource(m[1])
+				if err != nil {
+					p.issue(line_number, line, err.Error())
+					skipDepth = 1
+					continue
+				}
+				p.resource = resource
+				continue
+			}
+			if p.controlMetadata(line) {
+				continue
+			}
+			p.issue(line_number, line, "unsupported control statement")
+			if inspecBlockRe.MatchString(line) {
+				skipDepth = 1
+			}
+
+		default:
+			if line == "end" {
+				p.resource = nil
+				continue
+			}
+			predicate, err := p.expectation(line)
+			if err != nil {
+				p.issue(line_number, line, err.Error())
+				if inspecBlockRe.MatchString(line) {
+					skipDepth = 1
+				}
+				continue
+			}
+			p.predicates = append(p.predicates, predicate)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if p.control != nil {
+		p.issue(line_number, p.control.Id, "control is not terminated")
+	}
+
+	return p.checks, p.issues, nil
+}
+
+func (p *inspecParser) issue(line int, text string, reason string) {
+	control := ""
+	if p.control != nil {
+		control = p.control.Id
+		p.untranslated = append(p.untranslated, text)
+	}
+	p.issues = append(p.issues, ImportIssue{
+		File:    p.file,
+		Line:    line,
+		Control: control,
+		Text:    text,
+		Reason:  reason,
+	})
+}
+
+// controlMetadata copies the control title and description onto the check
+func (p *inspecParser) controlMetadata(line string) bool {
+	keyword, rest, _ := strings.Cut(line, " ")
+	switch keyword {
+	case "title":
+		if value, err := parseRubyString(strings.TrimSpace(rest)); err == nil {
+			p.control.Title = value
+			return true
+		}
+	case "desc":
+		// desc may carry a label: desc 'rationale', 'text'
+		parts := splitRubyArgs(rest)
+		if value, err := parseRubyString(parts[len(parts)-1]); err == nil {
+			if p.control.Description == "" {
+				p.control.Description = value
+			}
+			return true
+		}
+	case "impact":
+		if _, err := strconv.ParseFloat(strings.TrimSpace(rest), 64); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *inspecParser) finishControl(line int) {
+	control := p.control
+	if len(p.predicates) == 0 {
+		p.issue(line, control.Id, "control has no translatable expectations")
+	} else {
+		control.Command = strings.Join(p.predicates, " && ")
+		if len(p.untranslated) > 0 {
+			control.Remarks = fmt.Sprintf("Partially imported from InSpec; untranslated: %s", strings.Join(p.untranslated, "; "))
+		}
+		p.checks = append(p.checks, *control)
+	}
+	p.control = nil
+	p.predicates = nil
+	p.untranslated = nil
+}
+
+func parseInSpecResource(text string) (*inspecResource, error) {
+	m := inspecResourceRe.FindStringSubmatch(text)
+	if m == nil {
+		return nil, fmt.Errorf("unsupported resource")
+	}
+	resource := &inspecResource{Name: m[1]}
+	switch resource.Name {
+	case "file", "package", "service", "command", "sshd_config":
+	default:
+		return nil, fmt.Errorf("unsupported resource %s", resource.Name)
+	}
+	if m[2] != "" {
+		arg, err := parseRubyString(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("unsupported argument for resource %s", resource.Name)
+		}
+		resource.Arg = arg
+	}
+	if resource.Arg == "" {
+		if resource.Name != "sshd_config" {
+			return nil, fmt.Errorf("resource %s requires an argument", resource.Name)
+		}
+		resource.Arg = "/etc/ssh/sshd_config"
+	}
+	return resource, nil
+}
+
+// expectation translates a single `it` or `its` line into a shell predicate
+func (p *inspecParser) expectation(line string) (string, error) {
+	var property, should, matcher string
+	if m := inspecItRe.FindStringSubmatch(line); m != nil {
+		should, matcher = m[1], m[2]
+	} else if m := inspecItsRe.FindStringSubmatch(line); m != nil {
+		prop, err := parseRubyString(m[1])
+		if err != nil {
+			return "", fmt.Errorf("unsupported property")
+		}
+		property, should, matcher = prop, m[2], m[3]
+	} else {
+		return "", fmt.Errorf("unsupported expectation")
+	}
+
+	m := inspecMatcherRe.FindStringSubmatch(matcher)
+	if m == nil {
+		return "", fmt.Errorf("unsupported matcher")
+	}
+	name := m[1]
+	arg := strings.TrimSpace(m[2])
+	if strings.HasPrefix(arg, "(") && strings.HasSuffix(arg, ")") {
+		arg = strings.TrimSpace(arg[1 : len(arg)-1])
+	}
+
+	predicate, err := translateInSpec(p.resource, property, name, arg)
+	if err != nil {
+		return "", err
+	}
+	if should == "should_not" {
+		predicate = "! " + predicate
+	}
+	return predicate, nil
+}
+
+func translateInSpec(resource *inspecResource, property string, matcher string, arg string) (string, error) {
+	target := shellQuote(resource.Arg)
+
+	switch resource.Name {
+	case "file":
+		switch property {
+		case "":
+			switch matcher {
+			case "exist":
+				return fmt.Sprintf("test -e %s", target), nil
+			case "be_file":
+				return fmt.Sprintf("test -f %s", target), nil
+			case "be_directory":
+				return fmt.Sprintf("test -d %s", target), nil
+			case "be_symlink":
+				return fmt.Sprintf("test -L %s", target), nil
+			case "be_owned_by":
+				return compareShell(fmt.Sprintf("stat -c %%U %s", target), "eq", arg)
+			case "be_grouped_into":
+				return compareShell(fmt.Sprintf("stat -c %%G %s", target), "eq", arg)
+			}
+		case "owner":
+			return compareShell(fmt.Sprintf("stat -c %%U %s", target), matcher, arg)
+		case "group":
+			return compareShell(fmt.Sprintf("stat -c %%G %s", target), matcher, arg)
+		case "mode":
+			mode, err := parseRubyMode(arg)
+			if err != nil {
+				return "", err
+			}
+			if matcher != "cmp" && matcher != "eq" {
+				return "", fmt.Errorf("unsupported mode comparison")
+			}
+			return fmt.Sprintf("[ \"$(stat -c %%a %s)\" = '%o' ]", target, mode), nil
+		case "content":
+			return grepShell(fmt.Sprintf("cat %s", target), matcher, arg)
+		}
+
+	case "package":
+		if property == "" && matcher == "be_installed" {
+			return fmt.Sprintf("{ dpkg-query -W -f='${Status}' %s 2>/dev/null | grep -q 'install ok installed' || rpm -q %s >/dev/null 2>&1; }", target, target), nil
+		}
+
+	case "service":
+		if property == "" {
+			switch matcher {
+			case "be_enabled":
+				return fmt.Sprintf("systemctl is-enabled --quiet %s", target), nil
+			case "be_running":
+				return fmt.Sprintf("systemctl is-active --quiet %s", target), nil
+			case "be_installed":
+				return fmt.Sprintf("systemctl cat %s >/dev/null 2>&1", target), nil
+			}
+		}
+
+	case "command":
+		run := fmt.Sprintf("sh -c %s", target)
+		switch property {
+		case "stdout":
+			return grepShell(fmt.Sprintf("%s 2>/dev/null", run), matcher, arg)
+		case "stderr":
+			return grepShell(fmt.Sprintf("%s 2>&1 >/dev/null", run), matcher, arg)
+		case "exit_status":
+			code, err := strconv.Atoi(arg)
+			if err != nil || (matcher != "eq" && matcher != "cmp") {
+				return "", fmt.Errorf("unsupported exit status comparison")
+			}
+			return fmt.Sprintf("{ %s >/dev/null 2>&1; [ $? -eq %d ]; }", run, code), nil
+		}
+
+	case "sshd_config":
+		if property != "" {
+			if !inspecKeywordRe.MatchString(property) {
+				return "", fmt.Errorf("unsupported sshd_config keyword %s", property)
+			}
+			// InSpec uses the first occurrence of a keyword, as sshd does
+			value := fmt.Sprintf("awk 'tolower($1)==\"%s\"{$1=\"\"; sub(/^[ \\t]+/, \"\"); print; exit}' %s", strings.ToLower(property), target)
+			return compareShell(value, matcher, arg)
+		}
+	}
+
+	if property != "" {
+		return "", fmt.Errorf("unsupported matcher %s for %s property %s", matcher, resource.Name, property)
+	}
+	return "", fmt.Errorf("unsupported matcher %s for %s", matcher, resource.Name)
+}
+
+// compareShell compares the output of a shell command with an expected value
+func compareShell(command string, matcher string, arg string) (string, error) {
+	switch matcher {
+	case "eq", "cmp":
+		value, err := parseRubyValue(arg)
+		if err != nil {
+			return "", err
+		}
+		if matcher == "cmp" {
+			// cmp compares strings case-insensitively
+			return fmt.Sprintf("[ \"$(%s | tr '[:upper:]' '[:lower:]')\" = %s ]", command, shellQuote(strings.ToLower(value))), nil
+		}
+		return fmt.Sprintf("[ \"$(%s)\" = %s ]", command, shellQuote(value)), nil
+	case "match", "include", "be_empty":
+		return grepShell(command, matcher, arg)
+	}
+	return "", fmt.Errorf("unsupported matcher %s", matcher)
+}
+
+// grepShell matches the output of a shell command against a pattern
+func grepShell(command string, matcher string, arg string) (string, error) {
+	switch matcher {
+	case "match":
+		pattern, flags, err := parseRubyRegexp(arg)
+		if err != nil {
+			return "", err
+		}
+		options := "-Eq"
+		if strings.Contains(flags, "i") {
+			options = "-Eqi"
+		}
+		return fmt.Sprintf("%s | grep %s %s", command, options, shellQuote(pattern)), nil
+	case "include":
+		value, err := parseRubyString(arg)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s | grep -Fq %s", command, shellQuote(value)), nil
+	case "be_empty":
+		return fmt.Sprintf("[ -z \"$(%s)\" ]", command), nil
+	case "eq", "cmp":
+		return compareShell(command, matcher, arg)
+	}
+	return "", fmt.Errorf("unsupported matcher %s", matcher)
+}
+
+// parseRubyValue accepts a string or numeric literal
+func parseRubyValue(text string) (string, error) {
+	if _, err := strconv.ParseFloat(text, 64); err == nil {
+		return text, nil
+	}
+	return parseRubyString(text)
+}
+
+// parseRubyMode parses a file mode given as a quoted octal string or as an
+// integer literal, octal when it has a leading zero as in Ruby
+func parseRubyMode(text string) (uint64, error) {
+	if value, err := parseRubyString(text); err == nil {
+		if mode, err := strconv.ParseUint(value, 8, 32); err == nil {
+			return mode, nil
+		}
+		return 0, fmt.Errorf("unsupported mode %s", text)
+	}
+	digits := strings.ReplaceAll(text, "_", "")
+	base := 10
+	if strings.HasPrefix(digits, "0o") || strings.HasPrefix(digits, "0O") {
+		digits, base = digits[2:], 8
+	} else if len(digits) > 1 && strings.HasPrefix(digits, "0") {
+		base = 8
+	}
+	mode, err := strconv.ParseUint(digits, base, 32)
+	if err != nil || mode > 0o7777 {
+		return 0, fmt.Errorf("unsupported mode %s", text)
+	}
+	return mode, nil
+}
+
+// parseRubyString parses a single or double quoted string, or a symbol
+func parseRubyString(text string) (string, error) {
+	if len(text) >= 2 && strings.HasPrefix(text, ":") {
+		return text[1:], nil
+	}
+	if len(text) < 2 {
+		return "", fmt.Errorf("unsupported literal %s", text)
+	}
+	quote := text[0]
+	if (quote != '\'' && quote != '"') || text[len(text)-1] != quote {
+		return "", fmt.Errorf("unsupported literal %s", text)
+	}
+	body := text[1 : len(text)-1]
+	if quote == '"' && strings.Contains(body, "#{") {
+		return "", fmt.Errorf("unsupported string interpolation %s", text)
+	}
+	var value strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] == '\\' && i+1 < len(body) {
+			i++
+		} else if body[i] == quote {
+			return "", fmt.Errorf("unsupported literal %s", text)
+		}
+		value.WriteByte(body[i])
+	}
+	return value.String(), nil
+}
+
+// parseRubyRegexp parses a /regexp/ literal into an extended regular
+// expression and its flags
+func parseRubyRegexp(text string) (string, string, error) {
+	if !strings.HasPrefix(text, "/") {
+		if value, err := parseRubyString(text); err == nil {
+			return regexp.QuoteMeta(value), "", nil
+		}
+		return "", "", fmt.Errorf("unsupported regular expression %s", text)
+	}
+	end := strings.LastIndex(text, "/")
+	if end == 0 {
+		return "", "", fmt.Errorf("unsupported regular expression %s", text)
+	}
+	flags := text[end+1:]
+	if strings.Trim(flags, "imx") != "" || strings.Contains(flags, "x") {
+		return "", "", fmt.Errorf("unsupported regular expression flags %s", flags)
+	}
+	replacer := strings.NewReplacer(
+		`\A`, `^`,
+		`\z`, `$`,
+		`\Z`, `$`,
+		`\d`, `[0-9]`,
+		`\D`, `[^0-9]`,
+		`\s`, `[[:space:]]`,
+		`\S`, `[^[:space:]]`,
+		`\w`, `[[:alnum:]_]`,
+		`\W`, `[^[:alnum:]_]`,
+		`\/`, `/`,
+	)
+	return replacer.Replace(text[1:end]), flags, nil
+}
+
+// splitRubyArgs splits a comma separated argument list outside of quotes
+func splitRubyArgs(text string) []string {
+	args := []string{}
+	var quote byte
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		case quote == 0 && c == ',':
+			args = append(args, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	return append(args, strings.TrimSpace(text[start:]))
+}
+
+// stripRubyComment removes a trailing # comment outside of quotes
+func stripRubyComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '\'' || c == '"' || c == '/'):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// shellQuote quotes a value for use as a single POSIX shell word
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportInSpecExpectations(t *testing.T) {
+	tests := []struct {
+		name     string
+		describe string
+		line     string
+		want     string
+	}{
+		{"file exists", "file('/etc/passwd')", "it { should exist }", "test -e '/etc/passwd'"},
+		{"file owner", "file('/etc/passwd')", "it { should be_owned_by 'root' }", `[ "$(stat -c %U '/etc/passwd')" = 'root' ]`},
+		{"quoted mode", "file('/etc/shadow')", "its('mode') { should cmp '0640' }", `[ "$(stat -c %a '/etc/shadow')" = '640' ]`},
+		{"octal mode", "file('/etc/shadow')", "its('mode') { should cmp 0640 }", `[ "$(stat -c %a '/etc/shadow')" = '640' ]`},
+		{"ruby octal mode", "file('/etc/shadow')", "its('mode') { should cmp 0o600 }", `[ "$(stat -c %a '/etc/shadow')" = '600' ]`},
+		{"decimal mode", "file('/etc/shadow')", "its('mode') { should eq 420 }", `[ "$(stat -c %a '/etc/shadow')" = '644' ]`},
+		{"package", "package('telnetd')", "it { should_not be_installed }", "! { dpkg-query -W -f='${Status}' 'telnetd' 2>/dev/null | grep -q 'install ok installed' || rpm -q 'telnetd' >/dev/null 2>&1; }"},
+		{"service", "service('sshd')", "it { should be_running }", "systemctl is-active --quiet 'sshd'"},
+		{"command stdout", "command('sysctl -n kernel.randomize_va_space')", "its('stdout') { should match /^2$/ }", `sh -c 'sysctl -n kernel.randomize_va_space' 2>/dev/null | grep -Eq '^2$'`},
+		{"command exit status", "command('true')", "its('exit_status') { should eq 0 }", "{ sh -c 'true' >/dev/null 2>&1; [ $? -eq 0 ]; }"},
+		{"sshd_config", "sshd_config", "its('PermitRootLogin') { should cmp 'no' }", `[ "$(awk 'tolower($1)=="permitrootlogin"{$1=""; sub(/^[ \t]+/, ""); print; exit}' '/etc/ssh/sshd_config' | tr '[:upper:]' '[:lower:]')" = 'no' ]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profile := "control 'c' do\n  describe " + test.describe + " do\n    " + test.line + "\n  end\nend\n"
+			checks, issues, err := ImportInSpec("test.rb", strings.NewReader(profile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(issues) != 0 {
+				t.Fatalf("unexpected issues %v", issues)
+			}
+			if len(checks) != 1 || checks[0].Command != test.want {
+				t.Fatalf("expected command\n%s\ngot %+v", test.want, checks)
+			}
+		})
+	}
+}
+
+func TestImportInSpecUntranslated(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		reason string
+	}{
+		{"unknown matcher", "it { should be_immutable }", "unsupported matcher be_immutable"},
+		{"invalid mode", "its('mode') { should cmp 0999 }", "unsupported mode 0999"},
+		{"mode comparison", "its('mode') { should be <= 0644 }", "unsupported"},
+		{"unparsable line", "puts 'x'", "unsupported expectation"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profile := "control 'c' do\n  describe file('/a') do\n    it { should exist }\n    " + test.line + "\n  end\nend\n"
+			checks, issues, err := ImportInSpec("test.rb", strings.NewReader(profile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(issues) != 1 || !strings.Contains(issues[0].Reason, test.reason) || issues[0].Line != 4 {
+				t.Fatalf("expected an issue on line 4 with %q, got %v", test.reason, issues)
+			}
+			if len(checks) != 1 || !strings.HasPrefix(checks[0].Remarks, "Partially imported") {
+				t.Fatalf("expected a partially imported check, got %+v", checks)
+			}
+		})
+	}
+}
+
+func TestImportInSpecRejectsUnsafeSSHDKeyword(t *testing.T) {
+	profile := "control 'c' do\n  describe sshd_config do\n    its('x\"}1;system(\"id\")#') { should eq 'no' }\n  end\nend\n"
+	checks, issues, err := ImportInSpec("test.rb", strings.NewReader(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 0 || len(issues) != 2 || !strings.Contains(issues[0].Reason, "unsupported sshd_config keyword") {
+		t.Fatalf("expected the keyword to be rejected, got %+v %v", checks, issues)
+	}
+}
+
+func TestImportInSpecMetadata(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "inspec.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks, issues, err := ImportInSpec("inspec.rb", strings.NewReader(string(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 0 || len(checks) != 1 {
+		t.Fatalf("expected one check without issues, got %+v %v", checks, issues)
+	}
+	check := checks[0]
+	if check.Id != "sshd-01" || check.Title != "Disable root login" || check.Description != "Root must not log in over SSH" {
+		t.Errorf("unexpected metadata %+v", check)
+	}
+	if predicates := strings.Count(check.Command, " && ") + 1; predicates != 5 {
+		t.Errorf("expected 5 predicates, got %d in %s", predicates, check.Command)
+	}
+}
+
+func TestImportInSpecFiles(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{}
+	for _, id := range []string{"a", "b", "c"} {
+		path := filepath.Join(dir, id+".rb")
+		profile := "control '" + id + "' do\n  describe file('/" + id + "') do\n    it { should exist }\n  end\nend\n"
+		if err := os.WriteFile(path, []byte(profile), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	for _, path := range paths {
+		checks, _, err := importInSpecFile(path)
+		if err != nil || len(checks) != 1 {
+			t.Fatalf("%s: expected one check, got %v %v", path, checks, err)
+		}
+	}
+	if _, _, err := importInSpecFile(filepath.Join(dir, "missing.rb")); err == nil || !strings.Contains(err.Error(), "failed to open") {
+		t.Errorf("expected a missing file to fail, got %v", err)
+	}
+}
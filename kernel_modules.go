@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// kernelModulesScript prints the loaded modules followed by the effective
+// modprobe configuration
+const kernelModulesScript = `
+printf '==>loaded\n'
+cat /proc/modules 2>/dev/null || lsmod 2>/dev/null
+printf '==>config\n'
+modprobe --showconfig 2>/dev/null || cat /etc/modprobe.d/*.conf /run/modprobe.d/*.conf /lib/modprobe.d/*.conf /usr/lib/modprobe.d/*.conf 2>/dev/null
+`
+
+// Kernel module policy rules
+const (
+	ModuleNotLoaded   = "not_loaded"
+	ModuleDisabled    = "disabled"
+	ModuleBlacklisted = "blacklisted"
+)
+
+// KernelModulesCheck configures the kernel module policy check
+type KernelModulesCheck struct {
+	Modules []string `json:"modules" yaml:"modules"`
+
+	// Rules each module must satisfy, defaulting to not_loaded and disabled
+	Rules []string `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+// KernelModuleState is the state of a module on the host
+type KernelModuleState struct {
+	Loaded      bool
+	Install     string
+	Blacklisted bool
+}
+
+// Disabled reports whether modprobe is configured to run a no-op instead of
+// loading the module
+func (s KernelModuleState) Disabled() bool {
+	fields := strings.Fields(s.Install)
+	if len(fields) == 0 {
+		return false
+	}
+	command := path.Base(fields[0])
+	return command == "false" || command == "true"
+}
+
+// normaliseModule converts a module name to the form used by the kernel,
+// where dashes and underscores are interchangeable
+func normaliseModule(name string) string {
+	return strings.ReplaceAll(strings.TrimSpace(name), "-", "_")
+}
+
+// ParseKernelModules parses the output of kernelModulesScript
+func ParseKernelModules(output string) map[string]*KernelModuleState {
+	states := map[string]*KernelModuleState{}
+	state := func(name string) *KernelModuleState {
+		name = normaliseModule(name)
+		if states[name] == nil {
+			states[name] = &KernelModuleState{}
+		}
+		return states[name]
+	}
+
+	section := ""
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "==>") {
+			section = strings.TrimPrefix(line, "==>")
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch section {
+		case "loaded":
+			if fields[0] != "Module" {
+				state(fields[0]).Loaded = true
+			}
+		case "config":
+			if len(fields) < 2 {
+				continue
+			}
+			switch fields[0] {
+			case "install":
+				state(fields[1]).Install = strings.Join(fields[2:], " ")
+			case "blacklist":
+				state(fields[1]).Blacklisted = true
+			}
+		}
+	}
+	return states
+}
+
+// EffectiveRules returns the configured rules or the default ones
+func (c KernelModulesCheck) EffectiveRules() []string {
+	if len(c.Rules) == 0 {
+		return []string{ModuleNotLoaded, ModuleDisabled}
+	}
+	return c.Rules
+}
+
+// anyModuleLoaded reports whether the listing showed any loaded module
+func anyModuleLoaded(states map[string]*KernelModuleState) bool {
+	for _, state := range states {
+		if state.Loaded {
+			return true
+		}
+	}
+	return false
+}
+
+// Violations returns a description of each rule the module breaks
+func (c KernelModulesCheck) Violations(module string, state KernelModuleState) []string {
+	violations := []string{}
+	for _, rule := range c.EffectiveRules() {
+		switch rule {
+		case ModuleNotLoaded:
+			if state.Loaded {
+				violations = append(violations, fmt.Sprintf("module %s is loaded", module))
+			}
+		case ModuleDisabled:
+			if !state.Disabled() {
+				violations = append(violations, fmt.Sprintf("module %s is not disabled with an install /bin/false entry", module))
+			}
+		case ModuleBlacklisted:
+			if !state.Blacklisted {
+				violations = append(violations, fmt.Sprintf("module %s is not blacklisted", module))
+			}
+		}
+	}
+	return violations
+}
+
+func runKernelModulesCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	if check.KernelModules == nil || len(check.KernelModules.Modules) == 0 {
+		return nil, nil, fmt.Errorf("kernel_modules check requires modules")
+	}
+	settings := *check.KernelModules
+	for _, rule := range settings.Rules {
+		if rule != ModuleNotLoaded && rule != ModuleDisabled && rule != ModuleBlacklisted {
+			return nil, nil, fmt.Errorf("unknown kernel module rule %q", rule)
+		}
+	}
+
+	output, _, err := RunSessionCommand(client, kernelModulesScript)
+	if err != nil {
+		return nil, nil, err
+	}
+	states := ParseKernelModules(output)
+	// Without the list of loaded modules every module would pass not_loaded
+	if contains(settings.EffectiveRules(), ModuleNotLoaded) && !anyModuleLoaded(states) {
+		return nil, nil, fmt.Errorf("the loaded kernel modules could not be listed, neither /proc/modules nor lsmod gave any output")
+	}
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	evidence := []*Evidence{}
+	violations := map[string][]string{}
+	count := 0
+	for _, module := range settings.Modules {
+		state := KernelModuleState{}
+		if s, ok := states[normaliseModule(module)]; ok {
+			state = *s
+		}
+		evidence = append(evidence, &Evidence{
+			Title: module,
+			Description: fmt.Sprintf("loaded: %t, install: %q, blacklisted: %t",
+				state.Loaded, state.Install, state.Blacklisted),
+		})
+		violations[module] = settings.Violations(module, state)
+		count += len(violations[module])
+	}
+
+	props := append([]*Property{
+		{Name: "Modules", Value: strings.Join(settings.Modules, ",")},
+		{Name: "Violations", Value: strconv.Itoa(count)},
+	}, checkProps(check)...)
+	remarks := "All OK."
+	if count > 0 {
+		remarks = fmt.Sprintf("%d kernel module policy violations.", count)
+	}
+	obs := newObservation(
+		checkTitle(check, "Kernel Module Policy"),
+		fmt.Sprintf("Checked %d kernel modules against the module policy on %s.", len(settings.Modules), target),
+		props,
+		evidence,
+		remarks,
+	)
+
+	findings := []*Finding{}
+	for _, module := range settings.Modules {
+		for _, violation := range violations[module] {
+			findings = append(findings, newFinding(
+				obs,
+				checkTitle(check, "Kernel Module Policy Violation"),
+				fmt.Sprintf("On %s the %s.", target, violation),
+				fmt.Sprintf("Unload %s and add \"install %s /bin/false\" and \"blacklist %s\" to a file in /etc/modprobe.d.", module, module, module),
+				append([]*Property{{Name: "Module", Value: module}}, checkProps(check)...),
+			))
+		}
+	}
+	return []*Observation{obs}, findings, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseKernelModules(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "kernel_modules.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := ParseKernelModules(string(content))
+	tests := []struct {
+		module   string
+		state    KernelModuleState
+		disabled bool
+	}{
+		{"usb_storage", KernelModuleState{Loaded: true, Blacklisted: true}, false},
+		{"cramfs", KernelModuleState{Install: "/bin/false"}, true},
+		{"dccp", KernelModuleState{Install: "/bin/true"}, true},
+		{"dccp_ipv4", KernelModuleState{Loaded: true}, false},
+	}
+	for _, test := range tests {
+		state, ok := states[test.module]
+		if !ok {
+			t.Errorf("%s: missing", test.module)
+			continue
+		}
+		if *state != test.state || state.Disabled() != test.disabled {
+			t.Errorf("%s: expected %+v disabled %t, got %+v", test.module, test.state, test.disabled, *state)
+		}
+	}
+}
+
+func TestKernelModuleDisabled(t *testing.T) {
+	tests := []struct {
+		install  string
+		disabled bool
+	}{
+		{"/bin/false", true},
+		{"/usr/bin/true", true},
+		{"/bin/false # disabled", true},
+		{"/sbin/modprobe --ignore-install usb_storage", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if disabled := (KernelModuleState{Install: test.install}).Disabled(); disabled != test.disabled {
+			t.Errorf("%q: expected disabled %t", test.install, test.disabled)
+		}
+	}
+}
+
+func TestKernelModuleViolations(t *testing.T) {
+	tests := []struct {
+		rules      []string
+		state      KernelModuleState
+		violations []string
+	}{
+		{nil, KernelModuleState{Install: "/bin/false"}, nil},
+		{nil, KernelModuleState{Loaded: true}, []string{"is loaded", "is not disabled"}},
+		{[]string{ModuleBlacklisted}, KernelModuleState{Install: "/bin/false"}, []string{"is not blacklisted"}},
+		{[]string{ModuleNotLoaded, ModuleBlacklisted}, KernelModuleState{Blacklisted: true}, nil},
+	}
+	for _, test := range tests {
+		violations := KernelModulesCheck{Rules: test.rules}.Violations("cramfs", test.state)
+		if len(violations) != len(test.violations) {
+			t.Errorf("%v %+v: expected %v, got %v", test.rules, test.state, test.violations, violations)
+			continue
+		}
+		for i, want := range test.violations {
+			if !strings.Contains(violations[i], want) {
+				t.Errorf("expected %q in %q", want, violations[i])
+			}
+		}
+	}
+}
+
+func TestKernelModulesCheckConfiguration(t *testing.T) {
+	handler := func(command string) (string, int) {
+		return "==>loaded\nusb_storage 81920 0 - Live 0x0\n==>config\n", 0
+	}
+	for _, settings := range []*KernelModulesCheck{nil, {}, {Modules: []string{}}} {
+		_, _, err := runCheckAgainst(t, handler, Check{Type: "kernel_modules", KernelModules: settings})
+		if err == nil || !strings.Contains(err.Error(), "requires modules") {
+			t.Errorf("%+v: expected an empty module list to be rejected, got %v", settings, err)
+		}
+	}
+
+	check := Check{Type: "kernel_modules", Title: "CIS 1.1.1", KernelModules: &KernelModulesCheck{Modules: []string{"usb-storage"}}}
+	_, findings, err := runCheckAgainst(t, handler, check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 || findings[0].Title != "CIS 1.1.1" {
+		t.Errorf("expected two findings titled after the check, got %v", findings)
+	}
+}
+
+func TestKernelModulesCheckWithoutModuleList(t *testing.T) {
+	handler := func(command string) (string, int) {
+		return "==>loaded\n==>config\ninstall cramfs /bin/false\nblacklist cramfs\n", 0
+	}
+	tests := []struct {
+		rules []string
+		error bool
+	}{
+		{nil, true},
+		{[]string{ModuleNotLoaded}, true},
+		{[]string{ModuleDisabled, ModuleBlacklisted}, false},
+	}
+	for _, test := range tests {
+		check := Check{Type: "kernel_modules", KernelModules: &KernelModulesCheck{Modules: []string{"cramfs"}, Rules: test.rules}}
+		_, findings, err := runCheckAgainst(t, handler, check)
+		if test.error {
+			if err == nil || !strings.Contains(err.Error(), "could not be listed") {
+				t.Errorf("%v: expected the missing module list to fail the check, got %v", test.rules, err)
+			}
+			continue
+		}
+		if err != nil || len(findings) != 0 {
+			t.Errorf("%v: expected the check to pass without the module list, got %v %v", test.rules, findings, err)
+		}
+	}
+}
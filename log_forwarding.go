@@ -0,0 +1,741 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultReachabilityTimeout = 5 * time.Second
+
+// logForwardingScript prints the state of the forwarding daemons followed
+// by their configuration files
+const logForwardingScript = `for s in rsyslog syslog-ng systemd-journal-upload; do
+  printf '==>active %s %s\n' "$s" "$(systemctl is-active "$s" 2>/dev/null)"
+done
+for f in /etc/rsyslog.conf /etc/rsyslog.d/*.conf /etc/syslog-ng/syslog-ng.conf /etc/syslog-ng/conf.d/*.conf /etc/systemd/journal-upload.conf /etc/systemd/journal-upload.conf.d/*.conf; do
+  [ -f "$f" ] && [ -r "$f" ] && { printf '==>file %s\n' "$f"; cat "$f"; echo; }
+done`
+
+// LogForwardingCheck holds the central logging policy
+type LogForwardingCheck struct {
+	// Collectors are the approved targets as host or host:port
+	Collectors []string `json:"collectors,omitempty" yaml:"collectors,omitempty"`
+
+	// Protocols allowed, e.g. tcp, relp or https. All are allowed if empty.
+	Protocols  []string `json:"protocols,omitempty" yaml:"protocols,omitempty"`
+	RequireTLS bool     `json:"require_tls,omitempty" yaml:"require_tls,omitempty"`
+
+	// Facilities that must be forwarded to an approved collector
+	Facilities []string `json:"facilities,omitempty" yaml:"facilities,omitempty"`
+
+	// TestReachability connects to each TCP collector from the host through
+	// the SSH connection
+	TestReachability bool   `json:"test_reachability,omitempty" yaml:"test_reachability,omitempty"`
+	Timeout          string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// ForwardingTarget is a remote logging destination. Facilities holds the
+// forwarded facilities, "*" for all and "!name" for an exclusion; it is
+// empty when a filter could not be interpreted.
+type ForwardingTarget struct {
+	Daemon     string
+	File       string
+	Host       string
+	Port       string
+	Protocol   string
+	TLS        bool
+	Facilities []string
+}
+
+// Address returns host:port
+func (t ForwardingTarget) Address() string {
+	return net.JoinHostPort(t.Host, t.Port)
+}
+
+// Forwards reports whether the target receives the facility
+func (t ForwardingTarget) Forwards(facility string) bool {
+	if contains(t.Facilities, "!"+facility) {
+		return false
+	}
+	return contains(t.Facilities, "*") || contains(t.Facilities, facility)
+}
+
+// LogForwarding is the collected forwarding configuration of a host
+type LogForwarding struct {
+	// Active maps each daemon to its systemctl state, empty if unknown
+	Active  map[string]string
+	Targets []ForwardingTarget
+}
+
+// ParseLogForwarding parses the output of logForwardingScript run with the
+// section marker
+func ParseLogForwarding(output string, marker string) LogForwarding {
+	state := LogForwarding{Active: map[string]string{}}
+	for _, line := range strings.Split(output, "\n") {
+		if rest, ok := strings.CutPrefix(line, marker+"active "); ok {
+			name, active, _ := strings.Cut(rest, " ")
+			state.Active[name] = strings.TrimSpace(active)
+		}
+	}
+	for _, file := range ParseFileListing(output, marker) {
+		switch {
+		case strings.HasPrefix(file.Path, "/etc/rsyslog"):
+			state.Targets = append(state.Targets, ParseRsyslog(file.Path, file.Content)...)
+		case strings.HasPrefix(file.Path, "/etc/syslog-ng"):
+			state.Targets = append(state.Targets, ParseSyslogNG(file.Path, file.Content)...)
+		case strings.HasPrefix(file.Path, "/etc/systemd/journal-upload"):
+			state.Targets = append(state.Targets, ParseJournalUpload(file.Path, file.Content)...)
+		}
+	}
+	return state
+}
+
+// Running reports whether a daemon is active. An unknown state, e.g. on a
+// host without systemd, counts as running.
+func (s LogForwarding) Running(daemon string) bool {
+	active := s.Active[daemon]
+	return active == "" || active == "active"
+}
+
+var (
+	rsyslogParamRe   = regexp.MustCompile(`(?i)([a-z.]+)\s*=\s*"([^"]*)"`)
+	quotedStringRe   = regexp.MustCompile(`"([^"]*)"|'([^']*)'`)
+	syslogSelectorRe = regexp.MustCompile(`^[a-z0-9*,]+\.[a-z!=*]+(;[a-z0-9*,]+\.[a-z!=*]+)*$`)
+)
+
+// parseSyslogSelector returns the facilities of a selector such as
+// "auth,authpriv.*;kern.none"
+func parseSyslogSelector(selector string) []string {
+	facilities := []string{}
+	for _, part := range strings.Split(selector, ";") {
+		names, priority, ok := strings.Cut(part, ".")
+		if !ok {
+			continue
+		}
+		for _, name := range strings.Split(names, ",") {
+			if priority == "none" {
+				facilities = append(facilities, "!"+name)
+			} else {
+				facilities = append(facilities, name)
+			}
+		}
+	}
+	return facilities
+}
+
+// rsyslogFacilityCompareRe matches a comparison of $syslogfacility-text
+// with a string or an array of strings
+var rsyslogFacilityCompareRe = regexp.MustCompile(`\$syslogfacility-text\s*(==|!=|<>)\s*(\[[^\]]*\]|"[^"]*"|'[^']*')`)
+
+// rsyslogConditionFacilities returns the facilities an "if" condition
+// selects, or nil if it does not compare $syslogfacility-text. Equality
+// selects the named facilities and inequality all others; conditions it
+// cannot interpret select none.
+func rsyslogConditionFacilities(condition string) []string {
+	if !strings.Contains(condition, "syslogfacility-text") {
+		return nil
+	}
+	matches := rsyslogFacilityCompareRe.FindAllStringSubmatch(condition, -1)
+	if len(matches) != strings.Count(condition, "syslogfacility-text") {
+		return []string{}
+	}
+	selected, excluded := []string{}, []string{"*"}
+	for _, match := range matches {
+		for _, quoted := range quotedStringRe.FindAllStringSubmatch(match[2], -1) {
+			if match[1] == "==" {
+				selected = append(selected, quoted[1]+quoted[2])
+			} else {
+				excluded = append(excluded, "!"+quoted[1]+quoted[2])
+			}
+		}
+	}
+	if len(selected) > 0 {
+		return intersectFacilities(selected, excluded)
+	}
+	return excluded
+}
+
+// intersectFacilities returns the facilities selected by both lists. A nil
+// list selects everything.
+func intersectFacilities(a []string, b []string) []string {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if !contains(a, "*") {
+		a, b = b, a
+	}
+	if contains(a, "*") && contains(b, "*") {
+		return union(a, b)
+	}
+	// a is all facilities but its exclusions, b lists facilities
+	result := []string{}
+	for _, facility := range b {
+		if !strings.HasPrefix(facility, "!") && (contains(a, "*") && !contains(a, "!"+facility) || contains(a, facility)) {
+			result = append(result, facility)
+		}
+	}
+	return result
+}
+
+// negateFacilities returns the facilities a list does not select, as an
+// else branch receives them
+func negateFacilities(facilities []string) []string {
+	if facilities == nil {
+		return nil
+	}
+	if !contains(facilities, "*") {
+		negated := []string{"*"}
+		for _, facility := range facilities {
+			negated = append(negated, "!"+facility)
+		}
+		return negated
+	}
+	negated := []string{}
+	for _, facility := range facilities {
+		if name, ok := strings.CutPrefix(facility, "!"); ok {
+			negated = append(negated, name)
+		}
+	}
+	return negated
+}
+
+// rsyslogBlock is an open "{" block. Facilities are those an if or else
+// branch selects and Rest those left for a following else branch, nil for
+// blocks such as ruleset() that do not filter.
+type rsyslogBlock struct {
+	Kind       string
+	Facilities []string
+	Rest       []string
+}
+
+// rsyslogStatements joins lines until parentheses balance, so that
+// multi-line action() and global() statements are read whole
+func rsyslogStatements(content string) []string {
+	statements := []string{}
+	current := ""
+	depth := 0
+	for _, line := range joinContinuations(content) {
+		trimmed := strings.TrimSpace(line)
+		if current == "" && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+		current += " " + trimmed
+		depth += strings.Count(trimmed, "(") - strings.Count(trimmed, ")")
+		if depth <= 0 {
+			statements = append(statements, strings.TrimSpace(current))
+			current = ""
+			depth = 0
+		}
+	}
+	if current != "" {
+		statements = append(statements, strings.TrimSpace(current))
+	}
+	return statements
+}
+
+// rsyslogParamName normalises a parameter name, as rsyslog accepts both
+// StreamDriverMode and StreamDriver.Mode in any case
+func rsyslogParamName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), ".", "")
+}
+
+// splitHostPort splits host:port, [v6]:port or a bare host
+func splitHostPort(address string, port string) (string, string) {
+	if host, p, err := net.SplitHostPort(address); err == nil {
+		return host, p
+	}
+	return strings.Trim(address, "[]"), port
+}
+
+// ParseRsyslog returns the forwarding targets in an rsyslog configuration,
+// in both the legacy "@@host:port" and the action(type="omfwd") syntax
+func ParseRsyslog(file string, content string) []ForwardingTarget {
+	targets := []ForwardingTarget{}
+	driver, driverMode := "", ""
+	blocks := []rsyslogBlock{}
+	// closed is the last block closed, which an else branch continues
+	var closed *rsyslogBlock
+
+	for _, statement := range rsyslogStatements(content) {
+		// Track the facilities selected by enclosing if and else blocks
+		for strings.HasPrefix(statement, "}") {
+			if len(blocks) > 0 {
+				last := blocks[len(blocks)-1]
+				closed = nil
+				if last.Kind == "if" || last.Kind == "else" {
+					closed = &last
+				}
+				blocks = blocks[:len(blocks)-1]
+			}
+			statement = strings.TrimSpace(statement[1:])
+		}
+		if statement == "" {
+			continue
+		}
+
+		lower := strings.ToLower(statement)
+		switch {
+		case strings.HasPrefix(lower, "$defaultnetstreamdriver "):
+			driver = strings.ToLower(strings.TrimSpace(statement[len("$defaultnetstreamdriver "):]))
+			continue
+		case strings.HasPrefix(lower, "$actionsendstreamdrivermode "):
+			driverMode = strings.TrimSpace(statement[len("$actionsendstreamdrivermode "):])
+			continue
+		case strings.HasPrefix(lower, "global("):
+			for _, param := range rsyslogParamRe.FindAllStringSubmatch(statement, -1) {
+				if rsyslogParamName(param[1]) == "defaultnetstreamdriver" {
+					driver = strings.ToLower(param[2])
+				}
+			}
+			continue
+		}
+
+		prefix := statement
+		index := strings.Index(lower, "action(")
+		if index >= 0 {
+			prefix = strings.TrimSpace(statement[:index])
+		}
+		lowerPrefix := strings.ToLower(prefix)
+
+		// The condition of this statement, continuing an if chain for else
+		var condition, rest []string
+		switch {
+		case strings.HasPrefix(lowerPrefix, "if "):
+			condition = rsyslogConditionFacilities(prefix)
+			rest = negateFacilities(condition)
+		case strings.HasPrefix(lowerPrefix, "else if "):
+			base := []string(nil)
+			if closed != nil {
+				base = closed.Rest
+			}
+			own := rsyslogConditionFacilities(prefix)
+			condition = intersectFacilities(base, own)
+			rest = intersectFacilities(base, negateFacilities(own))
+		case strings.HasPrefix(lowerPrefix, "else"):
+			if closed != nil {
+				condition = closed.Rest
+			}
+		}
+		if strings.HasSuffix(statement, "{") {
+			kind, _, _ := strings.Cut(strings.Fields(lowerPrefix + " {")[0], "(")
+			blocks = append(blocks, rsyslogBlock{Kind: kind, Facilities: condition, Rest: rest})
+			if index < 0 {
+				continue
+			}
+			condition = nil
+		}
+
+		var facilities []string
+		for _, block := range blocks {
+			facilities = intersectFacilities(facilities, block.Facilities)
+		}
+		facilities = intersectFacilities(facilities, condition)
+		if fields := strings.Fields(lowerPrefix); len(fields) > 0 && syslogSelectorRe.MatchString(fields[0]) {
+			facilities = intersectFacilities(facilities, parseSyslogSelector(fields[0]))
+		}
+		if facilities == nil {
+			facilities = []string{"*"}
+		}
+
+		if index >= 0 {
+			params := map[string]string{}
+			for _, param := range rsyslogParamRe.FindAllStringSubmatch(statement[index:], -1) {
+				params[rsyslogParamName(param[1])] = param[2]
+			}
+			target := ForwardingTarget{Daemon: "rsyslog", File: file, Host: strings.Trim(params["target"], "[]"), Facilities: facilities}
+			switch strings.ToLower(params["type"]) {
+			case "omfwd":
+				target.Protocol = strings.ToLower(params["protocol"])
+				if target.Protocol == "" {
+					target.Protocol = "udp"
+				}
+				streamDriver := strings.ToLower(params["streamdriver"])
+				if streamDriver == "" {
+					streamDriver = strings.ToLower(params["streamdrivername"])
+				}
+				if streamDriver == "" {
+					streamDriver = driver
+				}
+				target.TLS = target.Protocol == "tcp" && params["streamdrivermode"] == "1" && (streamDriver == "gtls" || streamDriver == "ossl")
+			case "omrelp":
+				target.Protocol = "relp"
+				target.TLS = strings.EqualFold(params["tls"], "on")
+			default:
+				continue
+			}
+			target.Port = params["port"]
+			if target.Port == "" {
+				target.Port = "514"
+			}
+			if target.Host != "" {
+				targets = append(targets, target)
+			}
+			continue
+		}
+
+		// Legacy actions: "selector @@host:port;template" or ":omrelp:host:port"
+		fields := strings.Fields(statement)
+		if len(fields) < 2 || !syslogSelectorRe.MatchString(strings.ToLower(fields[0])) {
+			continue
+		}
+		action, _, _ := strings.Cut(fields[1], ";")
+		target := ForwardingTarget{Daemon: "rsyslog", File: file, Facilities: facilities}
+		switch {
+		case strings.HasPrefix(action, "@@"):
+			target.Protocol = "tcp"
+			action = action[2:]
+			target.TLS = driverMode == "1" && (driver == "gtls" || driver == "ossl")
+		case strings.HasPrefix(action, "@"):
+			target.Protocol = "udp"
+			action = action[1:]
+		case strings.HasPrefix(action, ":omrelp:"):
+			target.Protocol = "relp"
+			action = strings.TrimPrefix(action, ":omrelp:")
+		default:
+			continue
+		}
+		// Options such as "(o,z9)" precede the address
+		if strings.HasPrefix(action, "(") {
+			if end := strings.Index(action, ")"); end >= 0 {
+				action = action[end+1:]
+			}
+		}
+		target.Host, target.Port = splitHostPort(action, "514")
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// balancedEnd returns the index of the bracket closing the one at open
+func balancedEnd(text string, open int) int {
+	opening, closing := text[open], byte(')')
+	if opening == '{' {
+		closing = '}'
+	}
+	depth := 0
+	quoted := false
+	for i := open; i < len(text); i++ {
+		switch {
+		case text[i] == '"':
+			quoted = !quoted
+		case quoted:
+		case text[i] == opening:
+			depth++
+		case text[i] == closing:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(text)
+}
+
+var (
+	syslogNGBlockRe     = regexp.MustCompile(`\b(destination|filter|log)\s*([A-Za-z0-9_]*)\s*\{`)
+	syslogNGDriverRe    = regexp.MustCompile(`\b(network|syslog|tcp6?|udp6?)\s*\(`)
+	syslogNGTransportRe = regexp.MustCompile(`transport\s*\(\s*"?([a-z-]+)"?\s*\)`)
+	syslogNGPortRe      = regexp.MustCompile(`\bport\s*\(\s*(\d+)\s*\)`)
+	syslogNGFacilityRe  = regexp.MustCompile(`\bfacility\s*\(([^)]*)\)`)
+	syslogNGRefRe       = regexp.MustCompile(`\b(filter|destination)\s*\(\s*([A-Za-z0-9_]+)\s*\)`)
+)
+
+// stripHashComments removes "#" comments outside of double quotes
+func stripHashComments(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		quoted := false
+		for j := 0; j < len(line); j++ {
+			if line[j] == '"' {
+				quoted = !quoted
+			} else if line[j] == '#' && !quoted {
+				lines[i] = line[:j]
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParseSyslogNG returns the network destinations of a syslog-ng
+// configuration that are used by a log path. The facilities of a
+// destination are those selected by facility() in the filters of its log
+// paths, or all when a log path has no filter.
+func ParseSyslogNG(file string, content string) []ForwardingTarget {
+	content = stripHashComments(content)
+	destinations := map[string][]ForwardingTarget{}
+	order := []string{}
+	filters := map[string][]string{}
+	logs := []string{}
+
+	for _, match := range syslogNGBlockRe.FindAllStringSubmatchIndex(content, -1) {
+		kind, name := content[match[2]:match[3]], content[match[4]:match[5]]
+		open := match[1] - 1
+		body := content[open+1 : balancedEnd(content, open)]
+		switch kind {
+		case "destination":
+			order = append(order, name)
+			for _, driver := range syslogNGDriverRe.FindAllStringSubmatchIndex(body, -1) {
+				driverName := body[driver[2]:driver[3]]
+				start := driver[1] - 1
+				args := body[start+1 : balancedEnd(body, start)]
+				words := strings.Fields(strings.ReplaceAll(args, "(", " "))
+				if len(words) == 0 {
+					continue
+				}
+				target := ForwardingTarget{Daemon: "syslog-ng", File: file, Host: strings.Trim(words[0], `"`)}
+
+				transport := ""
+				if m := syslogNGTransportRe.FindStringSubmatch(args); m != nil {
+					transport = m[1]
+				}
+				switch driverName {
+				case "tcp", "tcp6":
+					target.Protocol = "tcp"
+				case "udp", "udp6":
+					target.Protocol = "udp"
+				case "syslog":
+					target.Protocol = "tcp"
+				case "network":
+					target.Protocol = "udp"
+				}
+				if transport == "tls" {
+					target.Protocol, target.TLS = "tcp", true
+				} else if transport != "" {
+					target.Protocol = transport
+				}
+				if target.Protocol == "tcp" && strings.Contains(args, "tls(") {
+					target.TLS = true
+				}
+				target.Port = "514"
+				if driverName == "syslog" {
+					target.Port = "601"
+					if target.TLS {
+						target.Port = "6514"
+					}
+				}
+				if m := syslogNGPortRe.FindStringSubmatch(args); m != nil {
+					target.Port = m[1]
+				}
+				destinations[name] = append(destinations[name], target)
+			}
+		case "filter":
+			facilities := []string{}
+			for _, m := range syslogNGFacilityRe.FindAllStringSubmatch(body, -1) {
+				for _, facility := range strings.FieldsFunc(m[1], func(r rune) bool { return r == ',' || r == ' ' }) {
+					facilities = append(facilities, facility)
+				}
+			}
+			filters[name] = facilities
+		case "log":
+			logs = append(logs, body)
+		}
+	}
+
+	facilities := map[string][]string{}
+	for _, log := range logs {
+		used := []string{}
+		selected := []string{}
+		filtered := false
+		for _, ref := range syslogNGRefRe.FindAllStringSubmatch(log, -1) {
+			if ref[1] == "destination" {
+				used = append(used, ref[2])
+				continue
+			}
+			filtered = true
+			selected = union(selected, filters[ref[2]])
+		}
+		if !filtered {
+			selected = []string{"*"}
+		}
+		for _, name := range used {
+			facilities[name] = union(facilities[name], selected)
+		}
+	}
+
+	targets := []ForwardingTarget{}
+	for _, name := range order {
+		selected, used := facilities[name]
+		if !used {
+			continue
+		}
+		for _, target := range destinations[name] {
+			target.Facilities = selected
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// ParseJournalUpload returns the URL target of systemd-journal-upload
+func ParseJournalUpload(file string, content string) []ForwardingTarget {
+	doc, err := ParseConfig(FormatSystemd, file, content, ConfigParseOptions{}, nil)
+	if err != nil {
+		return nil
+	}
+	value, ok := doc.Get("Upload", "URL")
+	if !ok || value == "" {
+		return nil
+	}
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Hostname() == "" {
+		return nil
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "19532"
+	}
+	return []ForwardingTarget{{
+		Daemon:     "systemd-journal-upload",
+		File:       file,
+		Host:       parsed.Hostname(),
+		Port:       port,
+		Protocol:   parsed.Scheme,
+		TLS:        parsed.Scheme == "https",
+		Facilities: []string{"*"},
+	}}
+}
+
+// Approved reports whether the target is one of the approved collectors
+func (c LogForwardingCheck) Approved(target ForwardingTarget) bool {
+	if len(c.Collectors) == 0 {
+		return true
+	}
+	for _, collector := range c.Collectors {
+		host, port := splitHostPort(collector, "")
+		if strings.EqualFold(host, target.Host) && (port == "" || port == target.Port) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compliant reports whether the target meets the collector, protocol and TLS
+// policy, with the reasons it does not
+func (c LogForwardingCheck) Compliant(target ForwardingTarget) []string {
+	problems := []string{}
+	if !c.Approved(target) {
+		problems = append(problems, "it is not an approved collector")
+	}
+	if len(c.Protocols) > 0 && !contains(c.Protocols, target.Protocol) {
+		problems = append(problems, fmt.Sprintf("protocol %s is not allowed", target.Protocol))
+	}
+	if c.RequireTLS && !target.TLS {
+		problems = append(problems, "it is not protected by TLS")
+	}
+	return problems
+}
+
+func runLogForwardingCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	settings := LogForwardingCheck{}
+	if check.LogForwarding != nil {
+		settings = *check.LogForwarding
+	}
+	timeout := defaultReachabilityTimeout
+	if parsed, err := time.ParseDuration(settings.Timeout); err == nil && parsed > 0 {
+		timeout = parsed
+	}
+
+	marker := newSectionMarker()
+	output, _, err := RunSessionCommand(client, withSectionMarker(logForwardingScript, marker))
+	if err != nil {
+		return nil, nil, err
+	}
+	state := ParseLogForwarding(output, marker)
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	obs := newObservation(
+		checkTitle(check, "Log Forwarding"),
+		fmt.Sprintf("Read the rsyslog, syslog-ng and journal-upload configuration on %s.", target),
+		checkProps(check),
+		[]*Evidence{},
+		"All OK.",
+	)
+	findings := []*Finding{}
+	addFinding := func(title string, description string, remarks string, props ...*Property) {
+		findings = append(findings, newFinding(obs, title, description, remarks, append(props, checkProps(check)...)))
+	}
+
+	compliant := []ForwardingTarget{}
+	for _, forward := range state.Targets {
+		evidence := &Evidence{
+			Title: fmt.Sprintf("%s to %s", forward.Daemon, forward.Address()),
+			Description: fmt.Sprintf("%s in %s, protocol %s, TLS %t, facilities %s.",
+				forward.Daemon, forward.File, forward.Protocol, forward.TLS, strings.Join(forward.Facilities, ",")),
+		}
+		obs.RelevantEvidence = append(obs.RelevantEvidence, evidence)
+		if !state.Running(forward.Daemon) {
+			evidence.Description += fmt.Sprintf(" Ignored as %s is %s.", forward.Daemon, state.Active[forward.Daemon])
+			continue
+		}
+
+		props := []*Property{
+			{Name: "Daemon", Value: forward.Daemon},
+			{Name: "Collector", Value: forward.Address()},
+			{Name: "Path", Value: forward.File},
+		}
+		if problems := settings.Compliant(forward); len(problems) > 0 {
+			addFinding("Log Forwarding Target Not Compliant",
+				fmt.Sprintf("%s on %s forwards to %s, but %s.", forward.Daemon, target, forward.Address(), strings.Join(problems, ", and ")),
+				"Forward logs only to approved collectors using an allowed protocol, with TLS where required.",
+				props...)
+			continue
+		}
+
+		if settings.TestReachability {
+			if forward.Protocol == "udp" {
+				evidence.Description += " Reachability was not tested over UDP."
+			} else if conn, err := DialThrough(client, forward.Address(), timeout); err != nil {
+				addFinding("Log Collector Unreachable",
+					fmt.Sprintf("%s could not reach its log collector: %v.", target, err),
+					"Check the network path and firewall rules between the host and the collector.",
+					props...)
+				continue
+			} else {
+				conn.Close()
+				evidence.Description += " The collector is reachable."
+			}
+		}
+		compliant = append(compliant, forward)
+	}
+
+	if len(compliant) == 0 && len(findings) == 0 {
+		addFinding("Logs Not Forwarded",
+			fmt.Sprintf("No active remote log forwarding was found on %s.", target),
+			"Configure rsyslog, syslog-ng or systemd-journal-upload to forward logs to the central collector.")
+	}
+	if len(compliant) > 0 {
+		for _, facility := range settings.Facilities {
+			forwarded := false
+			for _, forward := range compliant {
+				if forward.Forwards(facility) {
+					forwarded = true
+				}
+			}
+			if !forwarded {
+				addFinding("Log Facility Not Forwarded",
+					fmt.Sprintf("The %s facility is not forwarded to an approved collector from %s.", facility, target),
+					fmt.Sprintf("Include %s in the selector or filter of the forwarding rule.", facility),
+					&Property{Name: "Facility", Value: facility})
+			}
+		}
+	}
+
+	if len(findings) > 0 {
+		obs.Remarks = fmt.Sprintf("%d log forwarding problems were found.", len(findings))
+	}
+	return []*Observation{obs}, findings, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseLogForwarding(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "log_forwarding.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwarding := ParseLogForwarding(string(content), sectionMarker)
+	if !forwarding.Running("rsyslog") || forwarding.Running("syslog-ng") {
+		t.Errorf("unexpected active daemons %v", forwarding.Active)
+	}
+	want := []string{
+		"logs.example.com:514",
+		"siem.example.com:6514",
+		"relp.example.com:2514",
+		"10.1.2.3:601",
+		"10.1.2.4:514",
+		"journal.example.com:19532",
+	}
+	addresses := []string{}
+	for _, target := range forwarding.Targets {
+		addresses = append(addresses, target.Address())
+	}
+	if !slices.Equal(addresses, want) {
+		t.Errorf("expected targets %v, got %v", want, addresses)
+	}
+}
+
+func TestParseRsyslogFacilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		forwards []string
+		skips    []string
+	}{
+		{
+			name:     "legacy selector",
+			content:  "auth,authpriv.* @@siem:514\n",
+			forwards: []string{"auth", "authpriv"},
+			skips:    []string{"mail", "kern"},
+		},
+		{
+			name:     "selector exclusion",
+			content:  "mail.none;*.info @@siem:514\n",
+			forwards: []string{"auth", "kern"},
+			skips:    []string{"mail"},
+		},
+		{
+			name:     "one-line if",
+			content:  "if $syslogfacility-text == 'auth' then action(type=\"omfwd\" target=\"siem\")\n",
+			forwards: []string{"auth"},
+			skips:    []string{"mail"},
+		},
+		{
+			name: "nested if",
+			content: `if $syslogfacility-text == ["auth", "authpriv"] then {
+	if $syslogfacility-text == "mail" then {
+		action(type="omfwd" target="siem")
+	}
+}
+`,
+			skips: []string{"auth", "authpriv", "mail"},
+		},
+		{
+			name: "nested if narrows",
+			content: `if $syslogfacility-text == ["auth", "authpriv"] then {
+	if $msg contains "sudo" then {
+		if $syslogfacility-text != "authpriv" then {
+			action(type="omfwd" target="siem")
+		}
+	}
+}
+`,
+			forwards: []string{"auth"},
+			skips:    []string{"authpriv", "mail"},
+		},
+		{
+			name: "negation",
+			content: `if $syslogfacility-text != "mail" then {
+	action(type="omfwd" target="siem")
+}
+`,
+			forwards: []string{"auth", "kern"},
+			skips:    []string{"mail"},
+		},
+		{
+			name: "else branch",
+			content: `if $syslogfacility-text == "mail" then {
+	action(type="omfile" file="/var/log/mail")
+} else if $syslogfacility-text == "cron" then {
+	action(type="omfile" file="/var/log/cron")
+} else {
+	action(type="omfwd" target="siem")
+}
+`,
+			forwards: []string{"auth", "kern"},
+			skips:    []string{"mail", "cron"},
+		},
+		{
+			name: "ruleset",
+			content: `ruleset(name="remote") {
+	if $syslogfacility-text == "auth" then {
+		action(type="omfile" file="/var/log/auth")
+	}
+	action(type="omfwd" target="siem")
+}
+`,
+			forwards: []string{"auth", "mail"},
+		},
+		{
+			name: "ruleset closes the if chain",
+			content: `if $syslogfacility-text == "auth" then {
+	action(type="omfile" file="/var/log/auth")
+}
+ruleset(name="remote") {
+	action(type="omfile" file="/var/log/remote")
+}
+if $syslogfacility-text == "kern" then {
+	action(type="omfwd" target="siem")
+}
+`,
+			forwards: []string{"kern"},
+			skips:    []string{"auth", "mail"},
+		},
+		{
+			name: "uninterpretable condition",
+			content: `if re_match($syslogfacility-text, "^auth") then {
+	action(type="omfwd" target="siem")
+}
+`,
+			skips: []string{"auth", "mail"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			targets := ParseRsyslog("/etc/rsyslog.conf", test.content)
+			if len(targets) != 1 {
+				t.Fatalf("expected one target, got %+v", targets)
+			}
+			for _, facility := range test.forwards {
+				if !targets[0].Forwards(facility) {
+					t.Errorf("expected %s to be forwarded by %v", facility, targets[0].Facilities)
+				}
+			}
+			for _, facility := range test.skips {
+				if targets[0].Forwards(facility) {
+					t.Errorf("expected %s not to be forwarded by %v", facility, targets[0].Facilities)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRsyslogStreamDriverParameters(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		tls     bool
+	}{
+		{"plain", `action(type="omfwd" target="siem" port="6514" protocol="tcp" StreamDriver="gtls" StreamDriverMode="1" StreamDriverAuthMode="x509/name")`, true},
+		{"dotted", `action(type="omfwd" target="siem" port="6514" protocol="tcp" StreamDriver.Name="ossl" StreamDriver.Mode="1" StreamDriver.AuthMode="x509/name")`, true},
+		{"dotted global driver", "global(DefaultNetstreamDriver=\"gtls\")\n" + `action(type="omfwd" target="siem" protocol="tcp" streamdriver.mode="1")`, true},
+		{"dotted mode off", `action(type="omfwd" target="siem" protocol="tcp" StreamDriver="gtls" StreamDriver.Mode="0")`, false},
+	}
+	for _, test := range tests {
+		targets := ParseRsyslog("/etc/rsyslog.d/50-forward.conf", test.content)
+		if len(targets) != 1 || targets[0].TLS != test.tls {
+			t.Errorf("%s: expected one target with TLS %t, got %+v", test.name, test.tls, targets)
+		}
+	}
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"os"
+	"strings"
+
 	"golang.org/x/crypto/ssh"
 
 	"time"
 
 	. "github.com/compliance-framework/assessment-runtime/provider"
-	"github.com/google/uuid"
 	"gopkg.in/yaml.v2"
 )
 
@@ -23,22 +27,78 @@ type SSHConfig struct {
 	Host     string  `json:"host" yaml:"host"`
 	Command  string  `json:"command" yaml:"command"`
 	Port     string  `json:"port,omitempty" yaml:"port,omitempty"`
+	Timeout  string  `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Checks   []Check `json:"checks,omitempty" yaml:"checks,omitempty"`
+
+	// CommandTimeout bounds each check, and Retries is how often a failed
+	// connection attempt or a check on a dropped connection is retried
+	CommandTimeout string `json:"command_timeout,omitempty" yaml:"command_timeout,omitempty"`
+	Retries        int    `json:"retries,omitempty" yaml:"retries,omitempty"`
+
+	// Credentials are tried in order after Username and Password. A user is
+	// no longer tried once AuthFailureBudget authentication failures were
+	// counted for it within AuthFailureWindow, unlimited when zero.
+	Credentials       []Credential `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+	AuthFailureBudget int          `json:"auth_failure_budget,omitempty" yaml:"auth_failure_budget,omitempty"`
+	AuthFailureWindow string       `json:"auth_failure_window,omitempty" yaml:"auth_failure_window,omitempty"`
+
+	// Ownership and HostGroups route Findings to their owners
+	Ownership  *Ownership  `json:"ownership,omitempty" yaml:"ownership,omitempty"`
+	HostGroups []HostGroup `json:"host_groups,omitempty" yaml:"host_groups,omitempty"`
+
+	// Export sends the Findings to an issue tracker
+	Export *IssueExport `json:"export,omitempty" yaml:"export,omitempty"`
+
+	// Trace writes a redacted protocol trace of the connections
+	Trace *TraceConfig `json:"trace,omitempty" yaml:"trace,omitempty"`
 }
 
-func (p *SSHCommandProvider) Evaluate(input *EvaluateInput) (*EvaluateResult, error) {
+// defaultTimeout is used when no connection timeout is configured
+const defaultTimeout = 10 * time.Second
+
+// defaultCommandTimeout is used when no check timeout is configured
+const defaultCommandTimeout = 10 * time.Minute
+
+// ConnectTimeout returns the configured connection timeout
+func (c SSHConfig) ConnectTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(c.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return defaultTimeout
+}
+
+// CheckTimeout returns the configured check timeout
+func (c SSHConfig) CheckTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(c.CommandTimeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return defaultCommandTimeout
+}
+
+// LoadConfig parses the YAML configuration passed by the runtime
+func LoadConfig(yamlString string) (SSHConfig, error) {
 	var ssh_config SSHConfig
+	if err := yaml.Unmarshal([]byte(yamlString), &ssh_config); err != nil {
+		return ssh_config, fmt.Errorf("Error unmarshalling YAML: %v\n", err)
+	}
+	if err := ssh_config.validate(); err != nil {
+		return ssh_config, err
+	}
+	return ssh_config, nil
+}
 
+func (p *SSHCommandProvider) Evaluate(input *EvaluateInput) (*EvaluateResult, error) {
 	yamlString, ok := input.Configuration["yaml"]
 	log.Printf("yamlString: %s", yamlString)
-
-    err := yaml.Unmarshal([]byte(yamlString), &ssh_config)
-    if err != nil {
-        return nil, fmt.Errorf("Error unmarshalling YAML: %v\n", err)
-    }
 	if !ok {
 		return nil, fmt.Errorf("yaml parameter is missing")
 	}
 
+	ssh_config, err := LoadConfig(yamlString)
+	if err != nil {
+		return nil, err
+	}
+
 	username := ssh_config.Username
 	host := ssh_config.Host
 	command := ssh_config.Command
@@ -66,158 +126,342 @@ func (p *SSHCommandProvider) Evaluate(input *EvaluateInput) (*EvaluateResult, er
 }
 
 func (p SSHCommandProvider) Execute(input *ExecuteInput) (*ExecuteResult, error) {
-	var ssh_config SSHConfig
-	start_time := time.Now().Format(time.RFC3339)
-
 	yamlString, ok := input.Configuration["yaml"]
 	if !ok {
 		return nil, fmt.Errorf("yaml parameter is missing")
 	}
 
-    err := yaml.Unmarshal([]byte(yamlString), &ssh_config)
-    if err != nil {
-        return nil, fmt.Errorf("Error unmarshalling YAML: %v\n", err)
-    }
+	ssh_config, err := LoadConfig(yamlString)
+	if err != nil {
+		return nil, err
+	}
 
-	username := ssh_config.Username
-	host := ssh_config.Host
-	command := ssh_config.Command
+	// A target that cannot be assessed is reported in the result, so the
+	// plugin keeps serving the other targets
+	start_time := time.Now().Format(time.RFC3339)
+	result, err := RunAssessment(defaultPool, ssh_config, nil)
+	if err != nil {
+		log.Printf("Failed to run assessment: %v", err)
+		return assessmentFailedResult(ssh_config, start_time, err), nil
+	}
+	return result, nil
+}
+
+// assessmentFailedResult reports a target which could not be assessed, for
+// example because it is unreachable or rejected the credentials
+func assessmentFailedResult(ssh_config SSHConfig, start_time string, err error) *ExecuteResult {
 	port := ssh_config.Port
 	if port == "" {
-		port = "22" // default to 22 if no port supplied
+		port = "22"
+	}
+	return &ExecuteResult{
+		Status: ExecutionStatus_FAILURE,
+		Logs: []*LogEntry{{
+			Title:       "SSH Assessment Failed",
+			Description: fmt.Sprintf("The host %s could not be assessed: %v", net.JoinHostPort(ssh_config.Host, port), err),
+			Start:       start_time,
+			End:         time.Now().Format(time.RFC3339),
+		}},
+	}
+}
+
+// defaultPool holds the connections of the plugin between executions
+var defaultPool = NewConnectionPool(PoolOptions{})
+
+// RunAssessment connects to the target through the pool and runs its
+// checks. selected limits the run to the checks with those ids, where
+// "command" selects the top-level command.
+func RunAssessment(pool *ConnectionPool, ssh_config SSHConfig, selected []string) (*ExecuteResult, error) {
+	start_time := time.Now().Format(time.RFC3339)
+
+	if ssh_config.Port == "" {
+		ssh_config.Port = "22" // default to 22 if no port supplied
 	}
 
-	var obs *Observation
-	var fndngs *Finding
+	checks, err := SelectChecks(ssh_config, selected)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &targetConnection{pool: pool, config: ssh_config}
+	if err := conn.connect(); errors.Is(err, errCredentialSuspended) {
+		return credentialSuspendedResult(ssh_config, start_time), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.close(false)
+	ssh_config = conn.config
 
 	observations := []*Observation{}
 	findings := []*Finding{}
+	logs := []*LogEntry{}
 
-	obs_id := uuid.New().String()
-	ssh_target_command := fmt.Sprintf("ssh -p %s %s@%s %s", port, username, host, command)
-
-	// Run the command and get the output
-	output, exit_code, err := RunCommand(ssh_config)
-	if err != nil {
-		log.Fatalf("Failed to run command: %v", err)
-	}
-
-	if (exit_code != 0) {
-		// observation and finding
-		obs = &Observation{
-			Id:               obs_id,
-			Title:            "SSH Command Did Not Succeed",
-			Description:      fmt.Sprintf("The command: %s did not succeed.", ssh_target_command),
-			Collected:        time.Now().Format(time.RFC3339),
-			Expires:          time.Now().AddDate(0, 1, 0).Format(time.RFC3339), // Add one month for the expiration
-			Links:            []*Link{},
-			Props:            []*Property{
-				{
-					Name:  "Command",
-					Value: fmt.Sprintf("%s", ssh_target_command),
-				},
-			},
-			RelevantEvidence: []*Evidence{
-				{
-					Description: fmt.Sprintf("The command returned an exit code of %d for the command: %s", exit_code, ssh_target_command),
-				},
-			},
-			Remarks:          fmt.Sprintf("The command: '%s' should return a zero exit code.", ssh_target_command),
-		}
-		fndngs = &Finding{
-			Id:                  uuid.New().String(),
-			Title:               "SSH Command Failure",
-			Description:         fmt.Sprintf("The command %s did not succeed, and produced output: %s.", ssh_target_command, output),
-			Remarks:             fmt.Sprintf("Correct the command %s.", ssh_target_command),
-			RelatedObservations: []string{obs_id},
+	// A failed check is logged and the remaining checks still run, so that
+	// the result holds everything that could be collected
+	for _, check := range checks {
+		check_start := time.Now().Format(time.RFC3339)
+		obs, fndngs, err := conn.runCheck(check)
+		if err != nil {
+			log.Printf("Failed to run check %s: %v", checkName(check), err)
+			logs = append(logs, &LogEntry{
+				Title:       "SSH Check Failed",
+				Description: fmt.Sprintf("The check %s could not be run: %v", checkName(check), err),
+				Start:       check_start,
+				End:         time.Now().Format(time.RFC3339),
+			})
+			continue
 		}
-		observations = append(observations, obs)
-		findings = append(findings, fndngs)
-	} else {
-		// observation only
-		obs = &Observation{
-			Id:          obs_id,
-			Title:       "SSH Command Succeeded",
-			Description: fmt.Sprintf("The command: %s succeeded.", ssh_target_command),
-			Collected:   time.Now().Format(time.RFC3339),
-			Expires:     time.Now().AddDate(0, 1, 0).Format(time.RFC3339), // Add one month for the expiration
-			Links:       []*Link{},
-			Props: []*Property{
-				{
-					Name:  "Command",
-					Value: fmt.Sprintf("%s", ssh_target_command),
-				},
-			},
-			RelevantEvidence: []*Evidence{
-				{
-					Description: fmt.Sprintf("The command returned an exit code of %d for the command: %s", exit_code, ssh_target_command),
-				},
-			},
-			Remarks: "All OK.",
+		applyRouting(fndngs, ssh_config.RoutingProps(check))
+		observations = append(observations, obs...)
+		findings = append(findings, fndngs...)
+	}
+
+	if ssh_config.Export != nil {
+		target := fmt.Sprintf("%s@%s:%s", ssh_config.Username, ssh_config.Host, ssh_config.Port)
+		if err := ssh_config.Export.Export(target, findings, observations); err != nil {
+			log.Printf("Failed to export findings: %v", err)
 		}
-		observations = append(observations, obs)
 	}
 
-	// Log that the check has successfully run
+	// Log whether the checks have successfully run
+	status := ExecutionStatus_SUCCESS
+	description := "SSH command check has run successfully"
+	if len(logs) > 0 {
+		status = ExecutionStatus_FAILURE
+		description = fmt.Sprintf("%d of %d SSH checks could not be run", len(logs), len(checks))
+	}
 	logEntry := &LogEntry{
 		Title:       "SSH Command Check",
-		Description: "SSH command check has run successfully",
+		Description: description,
 		Start:       start_time,
 		End:         time.Now().Format(time.RFC3339),
 	}
 
 	// Return the result
 	return &ExecuteResult{
-		Status:       ExecutionStatus_SUCCESS,
+		Status:       status,
 		Observations: observations,
 		Findings:     findings,
-		Logs:         []*LogEntry{logEntry},
+		Logs:         append([]*LogEntry{logEntry}, logs...),
 	}, nil
 }
 
-// RunCommand executes a command on the remote server over SSH and returns the output
-func RunCommand(config SSHConfig) (string, int, error) {
+// credentialSuspendedResult reports a target which was not assessed
+// because all of its credentials exhausted their authentication budget
+func credentialSuspendedResult(ssh_config SSHConfig, start_time string) *ExecuteResult {
+	users := []string{}
+	for _, credential := range ssh_config.CredentialList() {
+		users = append(users, credential.Username)
+	}
+	target := net.JoinHostPort(ssh_config.Host, ssh_config.Port)
+	description := fmt.Sprintf("The host %s was not assessed: the authentication failure budget of %s is exhausted.", target, strings.Join(users, ", "))
+	obs := newObservation(
+		"SSH Credential Suspended",
+		description,
+		[]*Property{
+			{Name: "Host", Value: target},
+			{Name: "Status", Value: "credential suspended"},
+			{Name: "Users", Value: strings.Join(users, ", ")},
+		},
+		nil,
+		fmt.Sprintf("Check the credentials for %s and reset the lockout counter before the next run.", target),
+	)
+	return &ExecuteResult{
+		Status:       ExecutionStatus_FAILURE,
+		Observations: []*Observation{obs},
+		Logs: []*LogEntry{{
+			Title:       "SSH Credential Suspended",
+			Description: description,
+			Start:       start_time,
+			End:         time.Now().Format(time.RFC3339),
+		}},
+	}
+}
+
+// SelectChecks returns the checks of the configuration with the selected
+// ids, all of them when none are selected
+func SelectChecks(ssh_config SSHConfig, selected []string) ([]Check, error) {
+	// The top-level command is run as the first check, followed by any
+	// additional checks listed in the configuration.
+	checks := []Check{}
+	if ssh_config.Command != "" && (len(selected) == 0 || contains(selected, "command")) {
+		checks = append(checks, Check{Command: ssh_config.Command})
+	}
+	for _, check := range ssh_config.Checks {
+		if len(selected) == 0 || contains(selected, check.Id) {
+			checks = append(checks, check)
+		}
+	}
+	if len(selected) > 0 && len(checks) != len(selected) {
+		return nil, fmt.Errorf("unknown or duplicate check ids in %s", strings.Join(selected, ", "))
+	}
+	return checks, nil
+}
+
+// Dial establishes an SSH connection to the configured host
+func Dial(config SSHConfig) (*ssh.Client, error) {
+	tracer, err := OpenTracer(config)
+	if err != nil {
+		log.Printf("Failed to trace %s: %v", config.Host, err)
+	}
+
 	// Define the SSH client configuration
 	sshConfig := &ssh.ClientConfig{
 		User: config.Username,
 		Auth: []ssh.AuthMethod{
-		    ssh.Password(config.Password),
+			tracer.Auth(config.Username, config.Password),
 		},
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // For simplicity, ignore host key verification
 	}
+	if tracer != nil {
+		sshConfig.BannerCallback = func(message string) error {
+			tracer.Printf("auth: server banner, %d bytes", len(message))
+			return nil
+		}
+	}
+
+	// Establish the SSH connection. The timeout covers the handshake as
+	// well, so that a host which accepts the connection and then stalls
+	// does not hang the run.
+	address := net.JoinHostPort(config.Host, config.Port)
+	timeout := config.ConnectTimeout()
+	tracer.Printf("dialing %s as %s, timeout %s", address, config.Username, timeout)
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		tracer.Printf("dial failed: %v", err)
+		tracer.Close()
+		return nil, fmt.Errorf("failed to dial: %v", err)
+	}
+	tracer.Printf("connected from %s", conn.LocalAddr())
+	conn.SetDeadline(time.Now().Add(timeout))
+	c, chans, reqs, err := ssh.NewClientConn(tracer.Wrap(conn), address, sshConfig)
+	if err != nil {
+		tracer.Printf("handshake failed: %v", err)
+		tracer.Close()
+		conn.Close()
+		return nil, fmt.Errorf("failed to dial: %v", err)
+	}
+	conn.SetDeadline(time.Time{})
+	tracer.Printf("authenticated as %s, server version %q", config.Username, c.ServerVersion())
+	client := ssh.NewClient(c, chans, reqs)
+	tracer.attach(client)
+	return client, nil
+}
 
-	// Establish the SSH connection
-	address := fmt.Sprintf("%s:%s", config.Host, config.Port)
-	client, err := ssh.Dial("tcp", address, sshConfig)
+// RunCommand executes a command on the remote server over SSH and returns the output
+func RunCommand(config SSHConfig) (string, int, error) {
+	client, err := Dial(config)
 	if err != nil {
-		return "", -1, fmt.Errorf("failed to dial: %v", err)
+		return "", -1, err
 	}
 	defer client.Close()
 
+	return RunSessionCommand(client, config.Command)
+}
+
+// RunSessionCommand executes a command in a new session on an established
+// connection and returns the combined output and exit code
+func RunSessionCommand(client *ssh.Client, command string) (string, int, error) {
+	return runSessionCommand(client, command, false)
+}
+
+// RunSensitiveCommand is RunSessionCommand for commands whose output may
+// hold secrets, which are traced by length whatever the payload limit
+func RunSensitiveCommand(client *ssh.Client, command string) (string, int, error) {
+	return runSessionCommand(client, command, true)
+}
+
+func runSessionCommand(client *ssh.Client, command string, sensitive bool) (string, int, error) {
+	tracer := tracerFor(client)
+	channel := tracer.Channel()
+	payload := tracer.Payload
+	if sensitive {
+		payload = payloadLength
+	}
+
 	// Create a session for the command execution
 	session, err := client.NewSession()
 	if err != nil {
+		tracer.Printf("channel %d: session open failed: %v", channel, err)
 		return "", -1, fmt.Errorf("failed to create session: %v", err)
 	}
 	defer session.Close()
 
 	// Execute the command and capture the output
-	output, err := session.CombinedOutput(config.Command)
+	tracer.Printf("channel %d: exec %s", channel, payload(command))
+	output, err := session.CombinedOutput(command)
 	exit_code := -1
 	if err != nil {
 		if exitErr, ok := err.(*ssh.ExitError); ok {
-		    exit_code = exitErr.ExitStatus()
+			exit_code = exitErr.ExitStatus()
 		} else {
+			tracer.Printf("channel %d: failed after output %s: %v", channel, payload(string(output)), err)
 			return "", -1, fmt.Errorf("failed to execute command: %v", err)
 		}
 	} else {
 		exit_code = 0
 	}
+	tracer.Printf("channel %d: exit status %d, output %s", channel, exit_code, payload(string(output)))
 
 	return string(output), exit_code, nil
 }
 
+// DialThrough opens a TCP connection from the remote host through the SSH
+// connection, giving up after the timeout
+func DialThrough(client *ssh.Client, address string, timeout time.Duration) (net.Conn, error) {
+	type dialed struct {
+		conn net.Conn
+		err  error
+	}
+	tracer := tracerFor(client)
+	channel := tracer.Channel()
+	tracer.Printf("channel %d: direct-tcpip to %s", channel, address)
+	result := make(chan dialed, 1)
+	go func() {
+		conn, err := client.Dial("tcp", address)
+		if err != nil {
+			tracer.Printf("channel %d: direct-tcpip failed: %v", channel, err)
+		}
+		result <- dialed{conn, err}
+	}()
+	select {
+	case r := <-result:
+		if r.err != nil {
+			return nil, fmt.Errorf("failed to connect to %s through the SSH connection: %v", address, r.err)
+		}
+		return r.conn, nil
+	case <-time.After(timeout):
+		// Close a connection that completes after the caller gave up
+		go func() {
+			if r := <-result; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("timed out connecting to %s after %s", address, timeout)
+	}
+}
+
+// ReadRemoteFile returns the contents of a file on the remote server. A
+// missing or unreadable file is reported as not found rather than an error.
+func ReadRemoteFile(client *ssh.Client, path string) (string, bool, error) {
+	output, exit_code, err := RunSessionCommand(client, fmt.Sprintf("cat %s 2>/dev/null", shellQuote(path)))
+	if err != nil {
+		return "", false, err
+	}
+	if exit_code != 0 {
+		return "", false, nil
+	}
+	return output, true, nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import-inspec" {
+		os.Exit(ImportInSpecCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "daemon" {
+		os.Exit(DaemonCommand(os.Args[2:]))
+	}
+
 	Register(&SSHCommandProvider{
 		message: "Azure CLI provider completed",
 	})
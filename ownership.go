@@ -0,0 +1,116 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+)
+
+// Ownership routes Findings to the team responsible for fixing them
+type Ownership struct {
+	Team          string `json:"team,omitempty" yaml:"team,omitempty"`
+	Contact       string `json:"contact,omitempty" yaml:"contact,omitempty"`
+	TicketProject string `json:"ticket_project,omitempty" yaml:"ticket_project,omitempty"`
+}
+
+// HostGroup assigns ownership to the hosts matching any of its globs
+type HostGroup struct {
+	Name      string     `json:"name" yaml:"name"`
+	Hosts     []string   `json:"hosts" yaml:"hosts"`
+	Ownership *Ownership `json:"ownership,omitempty" yaml:"ownership,omitempty"`
+}
+
+// Matches reports whether the host belongs to the group
+func (g HostGroup) Matches(host string) bool {
+	for _, pattern := range g.Hosts {
+		if matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(host)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// merge returns the ownership with the fields set in other taking precedence
+func (o Ownership) merge(other *Ownership) Ownership {
+	if other == nil {
+		return o
+	}
+	if other.Team != "" {
+		o.Team = other.Team
+	}
+	if other.Contact != "" {
+		o.Contact = other.Contact
+	}
+	if other.TicketProject != "" {
+		o.TicketProject = other.TicketProject
+	}
+	return o
+}
+
+// Props returns the ownership as Finding properties
+func (o Ownership) Props() []*Property {
+	props := []*Property{}
+	if o.Team != "" {
+		props = append(props, &Property{Name: "Team", Value: o.Team})
+	}
+	if o.Contact != "" {
+		props = append(props, &Property{Name: "Contact", Value: o.Contact})
+	}
+	if o.TicketProject != "" {
+		props = append(props, &Property{Name: "TicketProject", Value: o.TicketProject})
+	}
+	return props
+}
+
+// HostGroupsFor returns the names of the groups the host belongs to
+func (c SSHConfig) HostGroupsFor(host string) []string {
+	groups := []string{}
+	for _, group := range c.HostGroups {
+		if group.Matches(host) {
+			groups = append(groups, group.Name)
+		}
+	}
+	return groups
+}
+
+// OwnershipFor resolves the owner of a check's Findings. The configuration
+// default is overridden by matching host groups in order, then by the check.
+func (c SSHConfig) OwnershipFor(check Check) Ownership {
+	ownership := Ownership{}.merge(c.Ownership)
+	for _, group := range c.HostGroups {
+		if group.Matches(c.Host) {
+			ownership = ownership.merge(group.Ownership)
+		}
+	}
+	return ownership.merge(check.Ownership)
+}
+
+// RoutingProps returns the ownership, host group and severity properties
+// for the Findings of a check
+func (c SSHConfig) RoutingProps(check Check) []*Property {
+	props := c.OwnershipFor(check).Props()
+	if groups := c.HostGroupsFor(c.Host); len(groups) > 0 {
+		props = append(props, &Property{Name: "HostGroup", Value: strings.Join(groups, ",")})
+	}
+	if check.Severity != "" {
+		props = append(props, &Property{Name: "Severity", Value: strings.ToLower(check.Severity)})
+	}
+	return props
+}
+
+// applyRouting adds the routing properties to Findings, keeping properties
+// the Finding already has, such as the severity of a vulnerability. Checks
+// may share a property slice between Findings, so each gets a copy.
+func applyRouting(findings []*Finding, props []*Property) {
+	for _, finding := range findings {
+		routed := append([]*Property{}, finding.Props...)
+		for _, prop := range props {
+			if findingProp(finding, prop.Name) != "" {
+				continue
+			}
+			routed = append(routed, &Property{Name: prop.Name, Value: prop.Value})
+		}
+		finding.Props = routed
+	}
+}
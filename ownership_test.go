@@ -0,0 +1,84 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+)
+
+func TestHostGroupMatches(t *testing.T) {
+	group := HostGroup{Name: "prod", Hosts: []string{"*.prod.example.com", "db-?"}}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"web-01.prod.example.com", true},
+		{"WEB-01.PROD.example.com", true},
+		{"db-1", true},
+		{"db-10", false},
+		{"web-01.staging.example.com", false},
+	}
+	for _, test := range tests {
+		if matched := group.Matches(test.host); matched != test.want {
+			t.Errorf("%s: expected %t, got %t", test.host, test.want, matched)
+		}
+	}
+}
+
+func TestOwnershipFor(t *testing.T) {
+	config := SSHConfig{
+		Host:      "web-01.prod.example.com",
+		Ownership: &Ownership{Team: "platform", Contact: "platform@example.com", TicketProject: "PLAT"},
+		HostGroups: []HostGroup{
+			{Name: "prod", Hosts: []string{"*.prod.example.com"}, Ownership: &Ownership{Contact: "oncall@example.com"}},
+			{Name: "web", Hosts: []string{"web-*"}, Ownership: &Ownership{Team: "web", TicketProject: "WEB"}},
+			{Name: "db", Hosts: []string{"db-*"}, Ownership: &Ownership{Team: "dba"}},
+			{Name: "all", Hosts: []string{"*"}},
+		},
+	}
+	tests := []struct {
+		name  string
+		check Check
+		want  Ownership
+	}{
+		{"groups in order", Check{}, Ownership{Team: "web", Contact: "oncall@example.com", TicketProject: "WEB"}},
+		{"check overrides", Check{Ownership: &Ownership{TicketProject: "SEC"}}, Ownership{Team: "web", Contact: "oncall@example.com", TicketProject: "SEC"}},
+	}
+	for _, test := range tests {
+		if ownership := config.OwnershipFor(test.check); ownership != test.want {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.want, ownership)
+		}
+	}
+	if groups := config.HostGroupsFor(config.Host); !slices.Equal(groups, []string{"prod", "web", "all"}) {
+		t.Errorf("unexpected host groups %v", groups)
+	}
+	if ownership := (SSHConfig{Host: "db-1"}).OwnershipFor(Check{}); ownership != (Ownership{}) {
+		t.Errorf("expected no ownership without configuration, got %+v", ownership)
+	}
+}
+
+func TestApplyRouting(t *testing.T) {
+	config := SSHConfig{
+		Host:       "db-1",
+		Ownership:  &Ownership{Team: "dba"},
+		HostGroups: []HostGroup{{Name: "db", Hosts: []string{"db-*"}}},
+	}
+	shared := []*Property{{Name: "Check", Value: "sshd"}}
+	findings := []*Finding{{Title: "a", Props: shared}, {Title: "b", Props: shared}}
+	applyRouting(findings, config.RoutingProps(Check{}))
+
+	want := []string{"Check=sshd", "Team=dba", "HostGroup=db"}
+	for _, finding := range findings {
+		props := []string{}
+		for _, prop := range finding.Props {
+			props = append(props, prop.Name+"="+prop.Value)
+		}
+		if !slices.Equal(props, want) {
+			t.Errorf("%s: expected %v, got %v", finding.Title, want, props)
+		}
+	}
+	if len(shared) != 1 || findings[0].Props[1] == findings[1].Props[1] {
+		t.Error("expected each finding to get its own routing properties")
+	}
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultPAMStacks are the password and authentication stacks read when none
+// are configured, covering Debian and Red Hat derived distributions
+var defaultPAMStacks = []string{
+	"/etc/pam.d/common-password",
+	"/etc/pam.d/common-auth",
+	"/etc/pam.d/system-auth",
+	"/etc/pam.d/password-auth",
+}
+
+// passwordPolicyFiles hold the settings the PAM modules and shadow read
+// besides the stacks, in the order they are listed as read
+var passwordPolicyFiles = []struct {
+	Name string
+	Path string
+}{
+	{"pwquality", "/etc/security/pwquality.conf"},
+	{"faillock", "/etc/security/faillock.conf"},
+	{"login.defs", "/etc/login.defs"},
+}
+
+// pwqualityDropIns are read by libpwquality after pwquality.conf
+const pwqualityDropIns = "/etc/security/pwquality.conf.d/*.conf"
+
+// PAMCheck configures the password policy check. Requirements left at zero
+// are not evaluated.
+type PAMCheck struct {
+	Stacks []string `json:"stacks,omitempty" yaml:"stacks,omitempty"`
+
+	MinLength           int      `json:"min_length,omitempty" yaml:"min_length,omitempty"`
+	MinClasses          int      `json:"min_classes,omitempty" yaml:"min_classes,omitempty"`
+	MinRemember         int      `json:"min_remember,omitempty" yaml:"min_remember,omitempty"`
+	MaxLockoutThreshold int      `json:"max_lockout_threshold,omitempty" yaml:"max_lockout_threshold,omitempty"`
+	MinUnlockTime       int      `json:"min_unlock_time,omitempty" yaml:"min_unlock_time,omitempty"`
+	MaxPasswordDays     int      `json:"max_password_days,omitempty" yaml:"max_password_days,omitempty"`
+	HashAlgorithms      []string `json:"hash_algorithms,omitempty" yaml:"hash_algorithms,omitempty"`
+}
+
+// PAMRule is a single line of a PAM stack
+type PAMRule struct {
+	File    string
+	Type    string
+	Control string
+	Module  string
+	Args    map[string]string
+}
+
+// PasswordPolicy is the effective password policy assembled from PAM stacks,
+// pwquality.conf, faillock.conf and login.defs. Zero values are unset.
+type PasswordPolicy struct {
+	MinLength     int
+	MinClasses    int
+	Remember      int
+	LockoutDeny   int
+	UnlockTime    int
+	HashAlgorithm string
+	MaxDays       int
+	MinDays       int
+	WarnAge       int
+
+	// Sources records the file and setting each value was taken from
+	Sources map[string]string
+}
+
+// ParsePAMStack parses a PAM configuration file. Includes are returned
+// separately so the caller can load them.
+func ParsePAMStack(file string, content string) ([]PAMRule, []string) {
+	rules := []PAMRule{}
+	includes := []string{}
+	for _, line := range joinContinuations(content) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Debian style includes
+		if strings.HasPrefix(line, "@include") {
+			includes = append(includes, strings.TrimSpace(strings.TrimPrefix(line, "@include")))
+			continue
+		}
+
+		fields := pamFields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		rule := PAMRule{
+			File:    file,
+			Type:    strings.TrimPrefix(fields[0], "-"),
+			Control: fields[1],
+			Module:  path.Base(fields[2]),
+			Args:    map[string]string{},
+		}
+		if rule.Control == "include" || rule.Control == "substack" {
+			includes = append(includes, fields[2])
+			continue
+		}
+		for _, arg := range fields[3:] {
+			key, value, _ := strings.Cut(arg, "=")
+			rule.Args[key] = value
+		}
+		rules = append(rules, rule)
+	}
+	return rules, includes
+}
+
+// pamFields splits a PAM line into fields, keeping bracketed controls such
+// as [success=1 default=ignore] together
+func pamFields(line string) []string {
+	fields := []string{}
+	current := strings.Builder{}
+	depth := 0
+	for _, r := range line {
+		switch {
+		case r == '[':
+			depth++
+			current.WriteRune(r)
+		case r == ']' && depth > 0:
+			depth--
+			current.WriteRune(r)
+		case (r == ' ' || r == '\t') && depth == 0:
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
+
+// joinContinuations joins lines ending in a backslash
+func joinContinuations(content string) []string {
+	lines := []string{}
+	current := ""
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		lines = append(lines, current+line)
+		current = ""
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// ParseKeyValues parses "key = value" files such as pwquality.conf and
+// faillock.conf. Keys without a value are recorded with an empty value.
+func ParseKeyValues(content string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return values
+}
+
+// ParseLoginDefs parses whitespace separated "KEY value" lines
+func ParseLoginDefs(content string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		values[fields[0]] = fields[1]
+	}
+	return values
+}
+
+// hashAlgorithms are the pam_unix arguments selecting a password hash
+var hashAlgorithms = []string{"yescrypt", "sha512", "sha256", "blowfish", "gost_yescrypt", "bigcrypt", "md5"}
+
+// BuildPasswordPolicy assembles the effective policy. Arguments given to PAM
+// modules take precedence over their configuration files. pwquality holds
+// pwquality.conf merged with its drop-in files.
+func BuildPasswordPolicy(rules []PAMRule, pwquality map[string]string, faillock map[string]string, loginDefs map[string]string) PasswordPolicy {
+	policy := PasswordPolicy{Sources: map[string]string{}}
+
+	applyInt := func(field string, source string, value string, target *int) {
+		if n, err := strconv.Atoi(value); err == nil {
+			*target = n
+			policy.Sources[field] = source
+		}
+	}
+	// An unlock_time of never keeps accounts locked, as does 0
+	applyUnlockTime := func(source string, value string) {
+		if strings.EqualFold(value, "never") {
+			value = "0"
+		}
+		applyInt("unlock_time", source, value, &policy.UnlockTime)
+	}
+
+	// Configuration files first, so module arguments override them
+	if v, ok := loginDefs["PASS_MIN_LEN"]; ok {
+		applyInt("min_length", "login.defs PASS_MIN_LEN", v, &policy.MinLength)
+	}
+	if v, ok := loginDefs["PASS_MAX_DAYS"]; ok {
+		applyInt("max_days", "login.defs PASS_MAX_DAYS", v, &policy.MaxDays)
+	}
+	if v, ok := loginDefs["PASS_MIN_DAYS"]; ok {
+		applyInt("min_days", "login.defs PASS_MIN_DAYS", v, &policy.MinDays)
+	}
+	if v, ok := loginDefs["PASS_WARN_AGE"]; ok {
+		applyInt("warn_age", "login.defs PASS_WARN_AGE", v, &policy.WarnAge)
+	}
+	if v, ok := loginDefs["ENCRYPT_METHOD"]; ok {
+		policy.HashAlgorithm = strings.ToLower(v)
+		policy.Sources["hash_algorithm"] = "login.defs ENCRYPT_METHOD"
+	}
+
+	pwqualityUsed := false
+	cracklibUsed := false
+	faillockUsed := false
+	for _, rule := range rules {
+		switch rule.Module {
+		case "pam_pwquality.so":
+			pwqualityUsed = true
+		case "pam_cracklib.so":
+			cracklibUsed = true
+		case "pam_faillock.so":
+			faillockUsed = true
+		}
+	}
+	// Module defaults apply when a module is in use but not configured.
+	// pam_cracklib is configured by its arguments only.
+	if cracklibUsed {
+		applyInt("min_length", "pam_cracklib default minlen", "9", &policy.MinLength)
+	}
+	if pwqualityUsed {
+		applyInt("min_length", "pam_pwquality default minlen", "8", &policy.MinLength)
+		if v, ok := pwquality["minlen"]; ok {
+			applyInt("min_length", "pwquality.conf minlen", v, &policy.MinLength)
+		}
+		if v, ok := pwquality["minclass"]; ok {
+			applyInt("min_classes", "pwquality.conf minclass", v, &policy.MinClasses)
+		}
+	}
+	if faillockUsed {
+		applyInt("lockout_deny", "pam_faillock default deny", "3", &policy.LockoutDeny)
+		applyInt("unlock_time", "pam_faillock default unlock_time", "600", &policy.UnlockTime)
+		if v, ok := faillock["deny"]; ok {
+			applyInt("lockout_deny", "faillock.conf deny", v, &policy.LockoutDeny)
+		}
+		if v, ok := faillock["unlock_time"]; ok {
+			applyUnlockTime("faillock.conf unlock_time", v)
+		}
+	}
+
+	for _, rule := range rules {
+		source := fmt.Sprintf("%s %s", rule.File, rule.Module)
+		switch rule.Module {
+		case "pam_pwquality.so", "pam_cracklib.so":
+			if v, ok := rule.Args["minlen"]; ok {
+				applyInt("min_length", source+" minlen", v, &policy.MinLength)
+			}
+			if v, ok := rule.Args["minclass"]; ok {
+				applyInt("min_classes", source+" minclass", v, &policy.MinClasses)
+			}
+		case "pam_faillock.so", "pam_tally2.so":
+			if v, ok := rule.Args["deny"]; ok {
+				applyInt("lockout_deny", source+" deny", v, &policy.LockoutDeny)
+			}
+			if v, ok := rule.Args["unlock_time"]; ok {
+				applyUnlockTime(source+" unlock_time", v)
+			}
+		case "pam_pwhistory.so":
+			if v, ok := rule.Args["remember"]; ok {
+				applyInt("remember", source+" remember", v, &policy.Remember)
+			}
+		case "pam_unix.so":
+			if rule.Type != "password" {
+				continue
+			}
+			if v, ok := rule.Args["remember"]; ok && policy.Remember == 0 {
+				applyInt("remember", source+" remember", v, &policy.Remember)
+			}
+			if v, ok := rule.Args["minlen"]; ok && policy.MinLength == 0 {
+				applyInt("min_length", source+" minlen", v, &policy.MinLength)
+			}
+			for _, algorithm := range hashAlgorithms {
+				if _, ok := rule.Args[algorithm]; ok {
+					policy.HashAlgorithm = algorithm
+					policy.Sources["hash_algorithm"] = source + " " + algorithm
+					break
+				}
+			}
+		}
+	}
+	return policy
+}
+
+// Evaluate returns a description of each requirement the policy violates
+func (c PAMCheck) Evaluate(policy PasswordPolicy) []string {
+	violations := []string{}
+	if c.MinLength > 0 && policy.MinLength < c.MinLength {
+		violations = append(violations, fmt.Sprintf("minimum password length is %d, required at least %d", policy.MinLength, c.MinLength))
+	}
+	if c.MinClasses > 0 && policy.MinClasses < c.MinClasses {
+		violations = append(violations, fmt.Sprintf("minimum character classes is %d, required at least %d", policy.MinClasses, c.MinClasses))
+	}
+	if c.MinRemember > 0 && policy.Remember < c.MinRemember {
+		violations = append(violations, fmt.Sprintf("password history remembers %d passwords, required at least %d", policy.Remember, c.MinRemember))
+	}
+	if c.MaxLockoutThreshold > 0 && (policy.LockoutDeny == 0 || policy.LockoutDeny > c.MaxLockoutThreshold) {
+		if policy.LockoutDeny == 0 {
+			violations = append(violations, fmt.Sprintf("account lockout is not configured, required after at most %d failures", c.MaxLockoutThreshold))
+		} else {
+			violations = append(violations, fmt.Sprintf("account lockout is after %d failures, required after at most %d", policy.LockoutDeny, c.MaxLockoutThreshold))
+		}
+	}
+	// An unlock_time of 0 means accounts stay locked until an administrator unlocks them
+	if c.MinUnlockTime > 0 && policy.LockoutDeny > 0 && policy.UnlockTime != 0 && policy.UnlockTime < c.MinUnlockTime {
+		violations = append(violations, fmt.Sprintf("locked accounts unlock after %d seconds, required at least %d", policy.UnlockTime, c.MinUnlockTime))
+	}
+	if c.MaxPasswordDays > 0 && (policy.MaxDays <= 0 || policy.MaxDays > c.MaxPasswordDays) {
+		violations = append(violations, fmt.Sprintf("maximum password age is %d days, required at most %d", policy.MaxDays, c.MaxPasswordDays))
+	}
+	if len(c.HashAlgorithms) > 0 {
+		allowed := false
+		for _, algorithm := range c.HashAlgorithms {
+			if strings.EqualFold(algorithm, policy.HashAlgorithm) {
+				allowed = true
+			}
+		}
+		if !allowed {
+			violations = append(violations, fmt.Sprintf("password hash algorithm is %q, required one of %s", policy.HashAlgorithm, strings.Join(c.HashAlgorithms, ", ")))
+		}
+	}
+	return violations
+}
+
+// loadPAMStacks reads the configured stacks and the files they include
+func loadPAMStacks(client *ssh.Client, stacks []string) ([]PAMRule, []string, error) {
+	rules := []PAMRule{}
+	loaded := []string{}
+	seen := map[string]bool{}
+	queue := append([]string{}, stacks...)
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		if !strings.HasPrefix(file, "/") {
+			file = path.Join("/etc/pam.d", file)
+		}
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+
+		content, found, err := ReadRemoteFile(client, file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !found {
+			continue
+		}
+		loaded = append(loaded, file)
+		fileRules, includes := ParsePAMStack(file, content)
+		rules = append(rules, fileRules...)
+		queue = append(queue, includes...)
+	}
+	return rules, loaded, nil
+}
+
+func runPAMCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	settings := PAMCheck{}
+	if check.PAM != nil {
+		settings = *check.PAM
+	}
+	stacks := settings.Stacks
+	if len(stacks) == 0 {
+		stacks = defaultPAMStacks
+	}
+
+	rules, loaded, err := loadPAMStacks(client, stacks)
+	if err != nil {
+		return nil, nil, err
+	}
+	configs := map[string]map[string]string{}
+	for _, file := range passwordPolicyFiles {
+		content, found, err := ReadRemoteFile(client, file.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if found {
+			loaded = append(loaded, file.Path)
+		}
+		if file.Name == "login.defs" {
+			configs[file.Name] = ParseLoginDefs(content)
+		} else {
+			configs[file.Name] = ParseKeyValues(content)
+		}
+	}
+	// Drop-in files are read after pwquality.conf in lexical order, the
+	// shell's glob order, and override it
+	dropIns, err := RemoteFileLoader(client)(pwqualityDropIns)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range dropIns {
+		loaded = append(loaded, file.Path)
+		for key, value := range ParseKeyValues(file.Content) {
+			configs["pwquality"][key] = value
+		}
+	}
+
+	policy := BuildPasswordPolicy(rules, configs["pwquality"], configs["faillock"], configs["login.defs"])
+	violations := settings.Evaluate(policy)
+
+	props := append([]*Property{
+		{Name: "MinLength", Value: strconv.Itoa(policy.MinLength)},
+		{Name: "MinClasses", Value: strconv.Itoa(policy.MinClasses)},
+		{Name: "Remember", Value: strconv.Itoa(policy.Remember)},
+		{Name: "LockoutDeny", Value: strconv.Itoa(policy.LockoutDeny)},
+		{Name: "UnlockTime", Value: strconv.Itoa(policy.UnlockTime)},
+		{Name: "HashAlgorithm", Value: policy.HashAlgorithm},
+		{Name: "MaxDays", Value: strconv.Itoa(policy.MaxDays)},
+	}, checkProps(check)...)
+
+	fields := make([]string, 0, len(policy.Sources))
+	for field := range policy.Sources {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	evidence := []*Evidence{
+		{
+			Title:       "Files read",
+			Description: strings.Join(loaded, ", "),
+		},
+	}
+	for _, field := range fields {
+		evidence = append(evidence, &Evidence{
+			Title:       field,
+			Description: fmt.Sprintf("Taken from %s", policy.Sources[field]),
+		})
+	}
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	remarks := "All OK."
+	if len(violations) > 0 {
+		remarks = fmt.Sprintf("The password policy violates %d requirements.", len(violations))
+	}
+	obs := newObservation(
+		checkTitle(check, "Password Policy"),
+		fmt.Sprintf("The password policy of %s was assembled from PAM and login.defs.", target),
+		props,
+		evidence,
+		remarks,
+	)
+
+	findings := []*Finding{}
+	for _, violation := range violations {
+		findings = append(findings, newFinding(
+			obs,
+			checkTitle(check, "Password Policy Violation"),
+			fmt.Sprintf("On %s the %s.", target, violation),
+			"Update the PAM configuration, pwquality.conf, faillock.conf or login.defs to meet the password policy.",
+			props,
+		))
+	}
+	return []*Observation{obs}, findings, nil
+}
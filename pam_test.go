@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParsePAMStack(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "pam.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, includes := ParsePAMStack("/etc/pam.d/system-auth", string(content))
+	if !slices.Equal(includes, []string{"common-account"}) {
+		t.Errorf("unexpected includes %v", includes)
+	}
+	tests := []struct {
+		index   int
+		typ     string
+		control string
+		module  string
+		args    map[string]string
+	}{
+		{1, "auth", "required", "pam_faillock.so", map[string]string{"preauth": "", "silent": "", "audit": "", "deny": "5", "unlock_time": "900"}},
+		{2, "auth", "[success=1 default=bad]", "pam_unix.so", map[string]string{"nullok": "", "try_first_pass": ""}},
+		{4, "password", "sufficient", "pam_unix.so", map[string]string{"sha512": "", "shadow": "", "remember": "5", "use_authtok": ""}},
+		{5, "session", "optional", "pam_systemd.so", map[string]string{}},
+	}
+	if len(rules) != 6 {
+		t.Fatalf("expected 6 rules, got %d", len(rules))
+	}
+	for _, test := range tests {
+		rule := rules[test.index]
+		if rule.Type != test.typ || rule.Control != test.control || rule.Module != test.module {
+			t.Errorf("rule %d: unexpected %+v", test.index, rule)
+		}
+		if len(rule.Args) != len(test.args) {
+			t.Errorf("rule %d: expected args %v, got %v", test.index, test.args, rule.Args)
+		}
+		for key, value := range test.args {
+			if rule.Args[key] != value {
+				t.Errorf("rule %d: expected %s=%q, got %q", test.index, key, value, rule.Args[key])
+			}
+		}
+	}
+}
+
+func TestParsePAMStackIncludesAndContinuations(t *testing.T) {
+	content := "auth include system-auth\npassword substack /etc/pam.d/pw\npassword required \\\n  pam_pwhistory.so remember=24\n"
+	rules, includes := ParsePAMStack("/etc/pam.d/sshd", content)
+	if !slices.Equal(includes, []string{"system-auth", "/etc/pam.d/pw"}) {
+		t.Errorf("unexpected includes %v", includes)
+	}
+	if len(rules) != 1 || rules[0].Module != "pam_pwhistory.so" || rules[0].Args["remember"] != "24" {
+		t.Errorf("expected the continued line to be joined, got %+v", rules)
+	}
+}
+
+func TestBuildPasswordPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		stack     string
+		pwquality string
+		faillock  string
+		loginDefs string
+		want      PasswordPolicy
+	}{
+		{
+			name:      "module arguments override files",
+			stack:     "password requisite pam_pwquality.so minlen=14\npassword sufficient pam_unix.so yescrypt remember=5",
+			pwquality: "minlen = 10\nminclass = 3",
+			loginDefs: "PASS_MAX_DAYS 90\nENCRYPT_METHOD SHA512",
+			want:      PasswordPolicy{MinLength: 14, MinClasses: 3, Remember: 5, HashAlgorithm: "yescrypt", MaxDays: 90},
+		},
+		{
+			name:  "pwquality defaults",
+			stack: "password requisite pam_pwquality.so",
+			want:  PasswordPolicy{MinLength: 8},
+		},
+		{
+			name:      "cracklib ignores pwquality.conf",
+			stack:     "password requisite pam_cracklib.so minclass=2",
+			pwquality: "minlen = 20\nminclass = 4",
+			want:      PasswordPolicy{MinLength: 9, MinClasses: 2},
+		},
+		{
+			name:     "faillock.conf",
+			stack:    "auth required pam_faillock.so preauth",
+			faillock: "deny = 4\nunlock_time = 1800",
+			want:     PasswordPolicy{LockoutDeny: 4, UnlockTime: 1800},
+		},
+		{
+			name:     "faillock never unlocks",
+			stack:    "auth required pam_faillock.so preauth",
+			faillock: "unlock_time = never",
+			want:     PasswordPolicy{LockoutDeny: 3, UnlockTime: 0},
+		},
+		{
+			name:  "faillock argument never unlocks",
+			stack: "auth required pam_faillock.so preauth deny=5 unlock_time=never",
+			want:  PasswordPolicy{LockoutDeny: 5, UnlockTime: 0},
+		},
+		{
+			name:  "faillock defaults",
+			stack: "auth required pam_faillock.so preauth",
+			want:  PasswordPolicy{LockoutDeny: 3, UnlockTime: 600},
+		},
+		{
+			name:      "files of unused modules",
+			stack:     "password sufficient pam_unix.so sha512 minlen=6",
+			pwquality: "minlen = 20",
+			faillock:  "deny = 3",
+			want:      PasswordPolicy{MinLength: 6, HashAlgorithm: "sha512"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, _ := ParsePAMStack("/etc/pam.d/test", test.stack)
+			policy := BuildPasswordPolicy(rules, ParseKeyValues(test.pwquality), ParseKeyValues(test.faillock), ParseLoginDefs(test.loginDefs))
+			policy.Sources = nil
+			if policy.MinLength != test.want.MinLength || policy.MinClasses != test.want.MinClasses ||
+				policy.Remember != test.want.Remember || policy.LockoutDeny != test.want.LockoutDeny ||
+				policy.UnlockTime != test.want.UnlockTime || policy.HashAlgorithm != test.want.HashAlgorithm ||
+				policy.MaxDays != test.want.MaxDays {
+				t.Errorf("expected %+v, got %+v", test.want, policy)
+			}
+		})
+	}
+}
+
+func TestPAMCheckEvaluate(t *testing.T) {
+	check := PAMCheck{MinLength: 14, MaxLockoutThreshold: 5, MinUnlockTime: 900, HashAlgorithms: []string{"yescrypt", "sha512"}}
+	tests := []struct {
+		name       string
+		policy     PasswordPolicy
+		violations []string
+	}{
+		{"compliant", PasswordPolicy{MinLength: 14, LockoutDeny: 5, UnlockTime: 900, HashAlgorithm: "sha512"}, nil},
+		{"never unlocks", PasswordPolicy{MinLength: 14, LockoutDeny: 3, UnlockTime: 0, HashAlgorithm: "yescrypt"}, nil},
+		{"short unlock time", PasswordPolicy{MinLength: 14, LockoutDeny: 3, UnlockTime: 600, HashAlgorithm: "yescrypt"}, []string{"unlock after 600 seconds"}},
+		{"no lockout", PasswordPolicy{MinLength: 8, HashAlgorithm: "md5"}, []string{"minimum password length is 8", "lockout is not configured", `hash algorithm is "md5"`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations := check.Evaluate(test.policy)
+			if len(violations) != len(test.violations) {
+				t.Fatalf("expected %d violations, got %v", len(test.violations), violations)
+			}
+			for i, want := range test.violations {
+				if !strings.Contains(violations[i], want) {
+					t.Errorf("expected %q in %q", want, violations[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPAMCheckReadsPWQualityDropIns(t *testing.T) {
+	files := map[string]string{
+		"/etc/pam.d/common-password":                 "password requisite pam_pwquality.so\n",
+		"/etc/security/pwquality.conf":               "minlen = 8\nminclass = 2\n",
+		"/etc/security/pwquality.conf.d/10-cis.conf": "minlen = 12\n",
+		"/etc/security/pwquality.conf.d/90-ops.conf": "minlen = 14\n",
+		"/etc/security/faillock.conf":                "deny = 5\n",
+		"/etc/login.defs":                            "PASS_MAX_DAYS 90\n",
+	}
+	check := Check{Id: "pam", Type: "pam", PAM: &PAMCheck{MinLength: 14, MinClasses: 3}}
+	observations, findings, err := runCheckAgainst(t, remoteFilesHandler(files, nil), check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || !strings.Contains(findings[0].Description, "minimum character classes is 2") {
+		t.Fatalf("expected only the character classes to be violated, got %v", findings)
+	}
+	// The files are listed in the order they are read, the same on every run
+	read := observations[0].RelevantEvidence[0].Description
+	want := "/etc/pam.d/common-password, /etc/security/pwquality.conf, /etc/security/faillock.conf, /etc/login.defs, " +
+		"/etc/security/pwquality.conf.d/10-cis.conf, /etc/security/pwquality.conf.d/90-ops.conf"
+	if read != want {
+		t.Errorf("expected the files read\n%s\ngot\n%s", want, read)
+	}
+}
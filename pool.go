@@ -0,0 +1,372 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultIdleTimeout = time.Minute
+	defaultMaxPerHost  = 4
+	keepaliveTimeout   = 5 * time.Second
+)
+
+// PoolOptions limit the connections of a pool. MaxConcurrent bounds the
+// assessments running at once across all hosts, unlimited when zero, and
+// MaxPerHost those running against a single host.
+type PoolOptions struct {
+	MaxConcurrent int           `json:"max_concurrent,omitempty" yaml:"max_concurrent,omitempty"`
+	MaxPerHost    int           `json:"max_per_host,omitempty" yaml:"max_per_host,omitempty"`
+	IdleTimeout   time.Duration `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"`
+}
+
+// ConnectionPool shares SSH connections between assessments of the same
+// target and enforces the concurrency limits. Idle connections are closed
+// after the idle timeout.
+type ConnectionPool struct {
+	options PoolOptions
+	global  chan struct{}
+	auth    *authBudget
+
+	mu    sync.Mutex
+	conns map[string]*pooledConn
+	hosts map[string]chan struct{}
+	stop  chan struct{}
+}
+
+// pooledConn is a shared connection. A broken connection is no longer
+// handed out and is closed by its last user.
+type pooledConn struct {
+	client   *ssh.Client
+	users    int
+	lastUsed time.Time
+	broken   bool
+}
+
+// NewConnectionPool creates a pool and starts closing idle connections
+func NewConnectionPool(options PoolOptions) *ConnectionPool {
+	if options.MaxPerHost <= 0 {
+		options.MaxPerHost = defaultMaxPerHost
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = defaultIdleTimeout
+	}
+	p := &ConnectionPool{
+		options: options,
+		auth:    newAuthBudget(),
+		conns:   map[string]*pooledConn{},
+		hosts:   map[string]chan struct{}{},
+		stop:    make(chan struct{}),
+	}
+	if options.MaxConcurrent > 0 {
+		p.global = make(chan struct{}, options.MaxConcurrent)
+	}
+	go p.reap()
+	return p
+}
+
+// poolKey identifies connections that may be shared: the same user, target
+// and credentials
+func poolKey(config SSHConfig) string {
+	sum := sha256.Sum256([]byte(config.Password))
+	return fmt.Sprintf("%s@%s#%s", config.Username, net.JoinHostPort(config.Host, config.Port), hex.EncodeToString(sum[:8]))
+}
+
+// hostSlots returns the semaphore limiting assessments of a host
+func (p *ConnectionPool) hostSlots(host string) chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	slots, ok := p.hosts[host]
+	if !ok {
+		slots = make(chan struct{}, p.options.MaxPerHost)
+		p.hosts[host] = slots
+	}
+	return slots
+}
+
+// Acquire waits for a free slot and returns a connection to the target,
+// reusing a pooled one if it is still alive. release must be called once
+// the connection is no longer used. The host slot is taken first, so jobs
+// queued on a busy host do not hold global slots other hosts could use.
+// Dialing fails with errCredentialSuspended once the user has exhausted
+// its authentication failure budget.
+func (p *ConnectionPool) Acquire(config SSHConfig) (*ssh.Client, func(), error) {
+	slots := p.hostSlots(net.JoinHostPort(config.Host, config.Port))
+	slots <- struct{}{}
+	if p.global != nil {
+		p.global <- struct{}{}
+	}
+	freeSlots := func() {
+		<-slots
+		if p.global != nil {
+			<-p.global
+		}
+	}
+
+	key := poolKey(config)
+	conn, err := p.connection(key, config)
+	if err != nil {
+		freeSlots()
+		return nil, nil, err
+	}
+	release := func() {
+		p.mu.Lock()
+		conn.users--
+		conn.lastUsed = time.Now()
+		closing := conn.broken && conn.users == 0
+		p.mu.Unlock()
+		if closing {
+			conn.client.Close()
+		}
+		freeSlots()
+	}
+	return conn.client, release, nil
+}
+
+// retire stops handing out a connection and reports whether it is unused
+// and may be closed. The caller holds p.mu.
+func (p *ConnectionPool) retire(key string, conn *pooledConn) bool {
+	if p.conns[key] == conn {
+		delete(p.conns, key)
+	}
+	conn.broken = true
+	return conn.users == 0
+}
+
+// connection returns a live pooled connection for the key, dialing a new
+// one if there is none
+func (p *ConnectionPool) connection(key string, config SSHConfig) (*pooledConn, error) {
+	p.mu.Lock()
+	conn, ok := p.conns[key]
+	if ok {
+		conn.users++
+	}
+	p.mu.Unlock()
+
+	if ok {
+		if alive(conn.client) {
+			return conn, nil
+		}
+		p.mu.Lock()
+		conn.users--
+		unused := p.retire(key, conn)
+		p.mu.Unlock()
+		if unused {
+			conn.client.Close()
+		}
+	}
+
+	// Only a login counts against the authentication failure budget, so the
+	// attempt is reserved around the dial
+	if !p.auth.reserve(config.Username, config.AuthFailureBudget, config.AuthWindow()) {
+		return nil, errCredentialSuspended
+	}
+	client, err := Dial(config)
+	p.auth.settle(config.Username, err != nil && isAuthFailure(err))
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Another assessment may have connected in the meantime
+	if existing, ok := p.conns[key]; ok {
+		client.Close()
+		existing.users++
+		return existing, nil
+	}
+	conn = &pooledConn{client: client, users: 1, lastUsed: time.Now()}
+	p.conns[key] = conn
+	return conn, nil
+}
+
+// alive sends a keepalive request to check a pooled connection
+func alive(client *ssh.Client) bool {
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		tracerFor(client).Printf("global request keepalive@openssh.com: %v", err)
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		return err == nil
+	case <-time.After(keepaliveTimeout):
+		return false
+	}
+}
+
+// reap closes connections idle for longer than the idle timeout
+func (p *ConnectionPool) reap() {
+	ticker := time.NewTicker(p.options.IdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			for key, conn := range p.conns {
+				if conn.users == 0 && now.Sub(conn.lastUsed) > p.options.IdleTimeout {
+					conn.client.Close()
+					delete(p.conns, key)
+				}
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// Close closes all pooled connections and stops the idle reaper
+func (p *ConnectionPool) Close() {
+	close(p.stop)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, conn := range p.conns {
+		conn.client.Close()
+		delete(p.conns, key)
+	}
+}
+
+// Discard removes a broken connection from the pool, so that the next
+// assessment of the target dials a new one. Other assessments may still
+// share the client, so it is closed when its last user releases it.
+func (p *ConnectionPool) Discard(config SSHConfig, client *ssh.Client) {
+	key := poolKey(config)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if conn, ok := p.conns[key]; ok && conn.client == client {
+		p.retire(key, conn)
+	}
+}
+
+// retryBackoff is the delay before the first retry, growing linearly with
+// each further attempt
+var retryBackoff = time.Second
+
+// errCheckTimeout is returned for a check exceeding the command timeout
+var errCheckTimeout = errors.New("check timed out")
+
+// targetConnection is the pooled connection of an assessment. It reconnects
+// when the connection drops and retries as configured.
+type targetConnection struct {
+	pool    *ConnectionPool
+	config  SSHConfig
+	client  *ssh.Client
+	release func()
+}
+
+// connect acquires a connection from the pool, retrying failed attempts.
+// Rejected credentials are not retried, so as not to burn their budget.
+func (c *targetConnection) connect() error {
+	var err error
+	for attempt := 0; attempt <= c.config.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * retryBackoff)
+		}
+		err = c.acquire()
+		if err == nil || errors.Is(err, errAuthFailed) || errors.Is(err, errCredentialSuspended) {
+			return err
+		}
+	}
+	return err
+}
+
+// acquire tries the credentials of the target in order, skipping those
+// whose authentication failure budget is exhausted
+func (c *targetConnection) acquire() error {
+	var err error
+	suspended := 0
+	credentials := c.config.CredentialList()
+	for _, credential := range credentials {
+		config := c.config
+		config.Username, config.Password = credential.Username, credential.Password
+		client, release, dialErr := c.pool.Acquire(config)
+		if dialErr == nil {
+			c.config, c.client, c.release = config, client, release
+			return nil
+		}
+		if errors.Is(dialErr, errCredentialSuspended) {
+			suspended++
+			continue
+		}
+		if !isAuthFailure(dialErr) {
+			return dialErr
+		}
+		err = fmt.Errorf("%w for %s: %v", errAuthFailed, credential.Username, dialErr)
+	}
+	if suspended == len(credentials) {
+		return fmt.Errorf("%w: the authentication failure budget is exhausted", errCredentialSuspended)
+	}
+	return err
+}
+
+// close hands the connection back to the pool, discarding it if broken
+func (c *targetConnection) close(broken bool) {
+	if c.client == nil {
+		return
+	}
+	if broken {
+		c.pool.Discard(c.config, c.client)
+	}
+	c.release()
+	c.client, c.release = nil, nil
+}
+
+// runCheck runs a check within the command timeout. A timed out check
+// leaves its session behind, so the connection is discarded. A check that
+// failed because the connection dropped is retried on a new connection.
+func (c *targetConnection) runCheck(check Check) ([]*Observation, []*Finding, error) {
+	for attempt := 0; ; attempt++ {
+		if c.client == nil {
+			if err := c.connect(); err != nil {
+				return nil, nil, fmt.Errorf("failed to reconnect: %v", err)
+			}
+		}
+		obs, fndngs, err := runCheckTimeout(c.client, c.config, check)
+		if err == nil {
+			return obs, fndngs, nil
+		}
+		if errors.Is(err, errCheckTimeout) {
+			c.close(true)
+			return nil, nil, err
+		}
+		if alive(c.client) {
+			return nil, nil, err
+		}
+		c.close(true)
+		if attempt >= c.config.Retries {
+			return nil, nil, err
+		}
+		log.Printf("Connection to %s dropped, retrying check %s: %v", net.JoinHostPort(c.config.Host, c.config.Port), checkName(check), err)
+	}
+}
+
+// runCheckTimeout runs a check, giving up after the command timeout
+func runCheckTimeout(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	type checkResult struct {
+		obs    []*Observation
+		fndngs []*Finding
+		err    error
+	}
+	result := make(chan checkResult, 1)
+	go func() {
+		obs, fndngs, err := RunCheck(client, config, check)
+		result <- checkResult{obs, fndngs, err}
+	}()
+	timeout := config.CheckTimeout()
+	select {
+	case r := <-result:
+		return r.obs, r.fndngs, r.err
+	case <-time.After(timeout):
+		return nil, nil, fmt.Errorf("%w after %s", errCheckTimeout, timeout)
+	}
+}
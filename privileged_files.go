@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultPrivilegedFilesDepth   = 20
+	defaultPrivilegedFilesTimeout = 5 * time.Minute
+
+	// exitTimedOut is the exit code of timeout(1) when the command timed out
+	exitTimedOut = 124
+
+	// exitNoTimeout and exitNoPrintf report a host lacking timeout(1) or a
+	// find supporting -printf, as on busybox or BSD systems
+	exitNoTimeout = 127
+	exitNoPrintf  = 126
+)
+
+// Kinds of privileged file
+const (
+	PrivilegedSUID          = "suid"
+	PrivilegedSGID          = "sgid"
+	PrivilegedWorldWritable = "world_writable"
+	PrivilegedNoStickyDir   = "world_writable_dir_without_sticky"
+)
+
+// PrivilegedFilesCheck configures the SUID/SGID and world-writable file
+// inventory. The walk stays on the filesystems of the configured paths.
+type PrivilegedFilesCheck struct {
+	Paths    []string `json:"paths,omitempty" yaml:"paths,omitempty"`
+	MaxDepth int      `json:"max_depth,omitempty" yaml:"max_depth,omitempty"`
+	Timeout  string   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// Allowlist holds glob patterns of files which are expected, optionally
+	// restricted to a kind as "kind:pattern"
+	Allowlist []string `json:"allowlist,omitempty" yaml:"allowlist,omitempty"`
+
+	// BaselineDir is a local directory holding one baseline per host. A
+	// missing baseline is created from the first run.
+	BaselineDir    string `json:"baseline_dir,omitempty" yaml:"baseline_dir,omitempty"`
+	UpdateBaseline bool   `json:"update_baseline,omitempty" yaml:"update_baseline,omitempty"`
+}
+
+// PrivilegedFile is an entry of the privileged file inventory
+type PrivilegedFile struct {
+	Path  string `json:"path"`
+	Kind  string `json:"kind"`
+	Mode  string `json:"mode"`
+	Owner string `json:"owner"`
+}
+
+func (f PrivilegedFile) key() string {
+	return f.Kind + ":" + f.Path
+}
+
+// command builds the bounded find command, checking first that the host
+// has the tools it needs
+func (c PrivilegedFilesCheck) command() string {
+	paths := c.Paths
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = shellQuote(p)
+	}
+	depth := c.MaxDepth
+	if depth <= 0 {
+		depth = defaultPrivilegedFilesDepth
+	}
+	timeout := defaultPrivilegedFilesTimeout
+	if parsed, err := time.ParseDuration(c.Timeout); err == nil && parsed > 0 {
+		timeout = parsed
+	}
+	// timeout(1) takes whole seconds here, and 0 disables it
+	seconds := max(1, int(math.Ceil(timeout.Seconds())))
+	return fmt.Sprintf(
+		`command -v timeout >/dev/null 2>&1 || exit %d; find / -maxdepth 0 -printf '' >/dev/null 2>&1 || exit %d; `+
+			`timeout %d find %s -xdev -maxdepth %d \( \( -type f \( -perm -4000 -o -perm -2000 -o -perm -0002 \) \) -o \( -type d -perm -0002 ! -perm -1000 \) \) -printf '%%m %%u %%y %%p\n' 2>/dev/null`,
+		exitNoTimeout, exitNoPrintf, seconds, strings.Join(quoted, " "), depth,
+	)
+}
+
+// ParsePrivilegedFiles parses the find output into inventory entries. A file
+// may appear once per kind, e.g. both SUID and world writable.
+func ParsePrivilegedFiles(output string) []PrivilegedFile {
+	files := []PrivilegedFile{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 4 {
+			continue
+		}
+		mode, err := strconv.ParseUint(fields[0], 8, 32)
+		if err != nil {
+			continue
+		}
+		entry := PrivilegedFile{Path: fields[3], Mode: fields[0], Owner: fields[1]}
+		if fields[2] == "d" {
+			entry.Kind = PrivilegedNoStickyDir
+			files = append(files, entry)
+			continue
+		}
+		for bit, kind := range map[uint64]string{0o4000: PrivilegedSUID, 0o2000: PrivilegedSGID, 0o0002: PrivilegedWorldWritable} {
+			if mode&bit != 0 {
+				entry.Kind = kind
+				files = append(files, entry)
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].key() < files[j].key() })
+	return files
+}
+
+// Allowed reports whether the file matches the allowlist
+func (c PrivilegedFilesCheck) Allowed(file PrivilegedFile) bool {
+	for _, entry := range c.Allowlist {
+		pattern := entry
+		if kind, rest, ok := strings.Cut(entry, ":"); ok && !strings.Contains(kind, "/") {
+			if kind != file.Kind {
+				continue
+			}
+			pattern = rest
+		}
+		if matched, _ := path.Match(pattern, file.Path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// baselinePath returns the local baseline file for a host and the walked
+// paths and depth, so that checks with different scopes on the same host
+// keep their own baselines
+func (c PrivilegedFilesCheck) baselinePath(config SSHConfig) string {
+	paths := append([]string{}, c.Paths...)
+	sort.Strings(paths)
+	scope := sha256.Sum256([]byte(fmt.Sprintf("%q %d", paths, c.MaxDepth)))
+	name := strings.NewReplacer("/", "_", ":", "_").Replace(fmt.Sprintf("%s_%s", config.Host, config.Port))
+	return filepath.Join(c.BaselineDir, fmt.Sprintf("%s_%x.json", name, scope[:6]))
+}
+
+// compareBaseline loads the host's baseline and returns the entries added
+// and removed since. It creates the baseline if there is none.
+func (c PrivilegedFilesCheck) compareBaseline(config SSHConfig, files []PrivilegedFile) ([]PrivilegedFile, []PrivilegedFile, bool, error) {
+	baselinePath := c.baselinePath(config)
+	data, err := os.ReadFile(baselinePath)
+	if os.IsNotExist(err) || (err == nil && c.UpdateBaseline) {
+		return nil, nil, false, c.writeBaseline(baselinePath, files)
+	}
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to read baseline: %v", err)
+	}
+	baseline := []PrivilegedFile{}
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, nil, false, fmt.Errorf("failed to parse baseline %s: %v", baselinePath, err)
+	}
+
+	known := map[string]bool{}
+	for _, file := range baseline {
+		known[file.key()] = true
+	}
+	current := map[string]bool{}
+	added := []PrivilegedFile{}
+	for _, file := range files {
+		current[file.key()] = true
+		if !known[file.key()] {
+			added = append(added, file)
+		}
+	}
+	removed := []PrivilegedFile{}
+	for _, file := range baseline {
+		if !current[file.key()] {
+			removed = append(removed, file)
+		}
+	}
+	return added, removed, true, nil
+}
+
+func (c PrivilegedFilesCheck) writeBaseline(baselinePath string, files []PrivilegedFile) error {
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(baselinePath), 0o755); err != nil {
+		return fmt.Errorf("failed to create baseline directory: %v", err)
+	}
+	if err := os.WriteFile(baselinePath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write baseline: %v", err)
+	}
+	return nil
+}
+
+func runPrivilegedFilesCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	settings := PrivilegedFilesCheck{}
+	if check.PrivilegedFiles != nil {
+		settings = *check.PrivilegedFiles
+	}
+
+	// find exits non-zero on unreadable directories, so only a timeout or a
+	// failure without any output is treated specially
+	output, exit_code, err := RunSessionCommand(client, settings.command())
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case exit_code == exitNoTimeout && output == "":
+		return nil, nil, fmt.Errorf("the host has no timeout command")
+	case exit_code == exitNoPrintf && output == "":
+		return nil, nil, fmt.Errorf("the find command of the host does not support -printf")
+	case exit_code != 0 && exit_code != exitTimedOut && strings.TrimSpace(output) == "":
+		return nil, nil, fmt.Errorf("the file walk failed with exit code %d and no output", exit_code)
+	}
+	files := ParsePrivilegedFiles(output)
+
+	isNew := map[string]bool{}
+	var added, removed []PrivilegedFile
+	compared := false
+	// A partial walk would make the baseline comparison misleading
+	if settings.BaselineDir != "" && exit_code != exitTimedOut {
+		added, removed, compared, err = settings.compareBaseline(config, files)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, file := range added {
+			isNew[file.key()] = true
+		}
+	}
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	counts := map[string]int{}
+	for _, file := range files {
+		counts[file.Kind]++
+	}
+	props := append([]*Property{
+		{Name: "SUID", Value: strconv.Itoa(counts[PrivilegedSUID])},
+		{Name: "SGID", Value: strconv.Itoa(counts[PrivilegedSGID])},
+		{Name: "WorldWritableFiles", Value: strconv.Itoa(counts[PrivilegedWorldWritable])},
+		{Name: "WorldWritableDirsWithoutSticky", Value: strconv.Itoa(counts[PrivilegedNoStickyDir])},
+		{Name: "Complete", Value: strconv.FormatBool(exit_code != exitTimedOut)},
+	}, checkProps(check)...)
+
+	evidence := []*Evidence{}
+	for _, file := range files {
+		evidence = append(evidence, &Evidence{
+			Title:       fmt.Sprintf("%s %s", file.Kind, file.Path),
+			Description: fmt.Sprintf("mode %s owner %s", file.Mode, file.Owner),
+		})
+	}
+	for _, file := range removed {
+		evidence = append(evidence, &Evidence{
+			Title:       fmt.Sprintf("%s %s", file.Kind, file.Path),
+			Description: "No longer present since the baseline.",
+		})
+	}
+
+	remarks := "All OK."
+	if exit_code == exitTimedOut {
+		remarks = "The walk timed out, so the inventory is incomplete."
+	} else if compared && (len(added) > 0 || len(removed) > 0) {
+		remarks = fmt.Sprintf("%d entries added and %d removed since the baseline.", len(added), len(removed))
+	}
+	obs := newObservation(
+		checkTitle(check, "Privileged File Inventory"),
+		fmt.Sprintf("Found %d SUID/SGID and world writable entries on %s.", len(files), target),
+		props,
+		evidence,
+		remarks,
+	)
+
+	titles := map[string]string{
+		PrivilegedSUID:          "Unapproved SUID Binary",
+		PrivilegedSGID:          "Unapproved SGID Binary",
+		PrivilegedWorldWritable: "World Writable File",
+		PrivilegedNoStickyDir:   "World Writable Directory Without Sticky Bit",
+	}
+	findings := []*Finding{}
+	for _, file := range files {
+		if settings.Allowed(file) {
+			continue
+		}
+		baseline := "unknown"
+		if compared {
+			baseline = "known"
+			if isNew[file.key()] {
+				baseline = "new"
+			}
+		}
+		findings = append(findings, newFinding(
+			obs,
+			titles[file.Kind],
+			fmt.Sprintf("%s on %s has mode %s, is owned by %s and is not on the allowlist.", file.Path, target, file.Mode, file.Owner),
+			"Remove the permission, or add the file to the allowlist if it is expected.",
+			append([]*Property{
+				{Name: "Path", Value: file.Path},
+				{Name: "Kind", Value: file.Kind},
+				{Name: "Baseline", Value: baseline},
+			}, checkProps(check)...),
+		))
+	}
+	return []*Observation{obs}, findings, nil
+}
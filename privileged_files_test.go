@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParsePrivilegedFiles(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "privileged_files.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := ParsePrivilegedFiles(string(content))
+	want := []PrivilegedFile{
+		{Path: "/usr/bin/odd name with spaces", Kind: PrivilegedSGID, Mode: "6755", Owner: "root"},
+		{Path: "/usr/bin/wall", Kind: PrivilegedSGID, Mode: "2755", Owner: "root"},
+		{Path: "/usr/bin/odd name with spaces", Kind: PrivilegedSUID, Mode: "6755", Owner: "root"},
+		{Path: "/usr/bin/passwd", Kind: PrivilegedSUID, Mode: "4755", Owner: "root"},
+		{Path: "/var/www/html/config.php", Kind: PrivilegedWorldWritable, Mode: "666", Owner: "www-data"},
+		{Path: "/srv/shared", Kind: PrivilegedNoStickyDir, Mode: "777", Owner: "root"},
+	}
+	for _, file := range want {
+		if !slices.Contains(files, file) {
+			t.Errorf("expected %+v in %+v", file, files)
+		}
+	}
+	if len(files) != len(want) {
+		t.Errorf("expected %d entries, got %d", len(want), len(files))
+	}
+}
+
+func TestPrivilegedFilesAllowed(t *testing.T) {
+	check := PrivilegedFilesCheck{Allowlist: []string{"suid:/usr/bin/*", "/opt/app/bin/helper"}}
+	tests := []struct {
+		file    PrivilegedFile
+		allowed bool
+	}{
+		{PrivilegedFile{Path: "/usr/bin/passwd", Kind: PrivilegedSUID}, true},
+		{PrivilegedFile{Path: "/usr/bin/wall", Kind: PrivilegedSGID}, false},
+		{PrivilegedFile{Path: "/usr/bin/sub/tool", Kind: PrivilegedSUID}, false},
+		{PrivilegedFile{Path: "/opt/app/bin/helper", Kind: PrivilegedWorldWritable}, true},
+	}
+	for _, test := range tests {
+		if allowed := check.Allowed(test.file); allowed != test.allowed {
+			t.Errorf("%s %s: expected allowed %t", test.file.Kind, test.file.Path, test.allowed)
+		}
+	}
+}
+
+func TestPrivilegedFilesCommandTimeout(t *testing.T) {
+	tests := []struct {
+		timeout string
+		want    string
+	}{
+		{"", "timeout 300 find '/'"},
+		{"90s", "timeout 90 find '/'"},
+		{"500ms", "timeout 1 find '/'"},
+		{"1500ms", "timeout 2 find '/'"},
+	}
+	for _, test := range tests {
+		command := PrivilegedFilesCheck{Timeout: test.timeout}.command()
+		if !strings.Contains(command, test.want) {
+			t.Errorf("%q: expected %q in %s", test.timeout, test.want, command)
+		}
+	}
+}
+
+func TestPrivilegedFilesBaselinePerScope(t *testing.T) {
+	config := SSHConfig{Host: "db1", Port: "22"}
+	root := PrivilegedFilesCheck{Paths: []string{"/"}}
+	home := PrivilegedFilesCheck{Paths: []string{"/home"}}
+	reordered := PrivilegedFilesCheck{Paths: []string{"/home", "/"}}
+	both := PrivilegedFilesCheck{Paths: []string{"/", "/home"}}
+	if root.baselinePath(config) == home.baselinePath(config) {
+		t.Error("expected checks of different paths to keep their own baselines")
+	}
+	if reordered.baselinePath(config) != both.baselinePath(config) {
+		t.Error("expected the order of the paths not to matter")
+	}
+
+	dir := t.TempDir()
+	root.BaselineDir, home.BaselineDir = dir, dir
+	suid := PrivilegedFile{Path: "/usr/bin/passwd", Kind: PrivilegedSUID, Mode: "4755", Owner: "root"}
+	writable := PrivilegedFile{Path: "/home/shared/x", Kind: PrivilegedWorldWritable, Mode: "666", Owner: "bob"}
+	for i := 0; i < 2; i++ {
+		added, removed, compared, err := root.compareBaseline(config, []PrivilegedFile{suid})
+		if err != nil || compared != (i > 0) || len(added) != 0 || len(removed) != 0 {
+			t.Fatalf("run %d of /: unexpected drift %v %v %t %v", i, added, removed, compared, err)
+		}
+		added, removed, compared, err = home.compareBaseline(config, []PrivilegedFile{writable})
+		if err != nil || compared != (i > 0) || len(added) != 0 || len(removed) != 0 {
+			t.Fatalf("run %d of /home: unexpected drift %v %v %t %v", i, added, removed, compared, err)
+		}
+	}
+
+	added, removed, _, err := root.compareBaseline(config, []PrivilegedFile{writable})
+	if err != nil || !slices.Equal(added, []PrivilegedFile{writable}) || !slices.Equal(removed, []PrivilegedFile{suid}) {
+		t.Errorf("expected the drift to be reported, got %v %v %v", added, removed, err)
+	}
+}
+
+func TestPrivilegedFilesFailsWithoutOutput(t *testing.T) {
+	tests := []struct {
+		exit  int
+		error string
+	}{
+		{exitNoTimeout, "no timeout command"},
+		{exitNoPrintf, "does not support -printf"},
+		{1, "exit code 1 and no output"},
+	}
+	for _, test := range tests {
+		handler := func(command string) (string, int) { return "", test.exit }
+		_, _, err := runCheckAgainst(t, handler, Check{Id: "suid", Type: "privileged_files"})
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("exit %d: expected %q, got %v", test.exit, test.error, err)
+		}
+	}
+
+	// Unreadable directories make find exit non-zero after its output
+	handler := func(command string) (string, int) { return "4755 root f /usr/bin/passwd\n", 1 }
+	observations, findings, err := runCheckAgainst(t, handler, Check{Id: "suid", Type: "privileged_files"})
+	if err != nil || len(observations) != 1 || len(findings) != 1 {
+		t.Errorf("expected the partial inventory to be reported, got %v %v", findings, err)
+	}
+}
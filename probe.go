@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	msgKexInit = 20
+
+	// maxPacketLength bounds the packet read from an unauthenticated server
+	maxPacketLength = 35000
+)
+
+// KexInit lists the algorithms a server offers in its SSH_MSG_KEXINIT
+type KexInit struct {
+	KexAlgorithms           []string
+	HostKeyAlgorithms       []string
+	CiphersClientServer     []string
+	CiphersServerClient     []string
+	MACsClientServer        []string
+	MACsServerClient        []string
+	CompressionClientServer []string
+	CompressionServerClient []string
+	FirstKexFollows         bool
+}
+
+// ProbeKexInit connects to an SSH server without authenticating and returns
+// its version banner and the algorithms it offers for key exchange
+func ProbeKexInit(address string, timeout time.Duration) (string, *KexInit, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write([]byte("SSH-2.0-ssh-cf-plugin\r\n")); err != nil {
+		return "", nil, fmt.Errorf("failed to send version: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	banner, err := readBanner(reader)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// The server sends its KEXINIT straight after the version exchange
+	// without waiting for ours
+	payload, err := readPacket(reader)
+	if err != nil {
+		return banner, nil, err
+	}
+	kexInit, err := ParseKexInit(payload)
+	if err != nil {
+		return banner, nil, err
+	}
+	return banner, kexInit, nil
+}
+
+// readBanner reads the server identification string, skipping any lines
+// the server sends before it
+func readBanner(reader *bufio.Reader) (string, error) {
+	for i := 0; i < 20; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("failed to read version: %v", err)
+		}
+		if len(line) > 255 {
+			return "", fmt.Errorf("version line too long")
+		}
+		if strings.HasPrefix(line, "SSH-") {
+			return strings.TrimRight(line, "\r\n"), nil
+		}
+	}
+	return "", fmt.Errorf("no SSH version received")
+}
+
+// readPacket reads an unencrypted binary packet and returns its payload
+func readPacket(reader io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read packet: %v", err)
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length < 2 || length > maxPacketLength {
+		return nil, fmt.Errorf("invalid packet length %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(reader, packet); err != nil {
+		return nil, fmt.Errorf("failed to read packet: %v", err)
+	}
+	padding := int(packet[0])
+	if padding >= len(packet) {
+		return nil, fmt.Errorf("invalid packet padding %d", padding)
+	}
+	return packet[1 : len(packet)-padding], nil
+}
+
+// ParseKexInit parses the payload of an SSH_MSG_KEXINIT message
+func ParseKexInit(payload []byte) (*KexInit, error) {
+	if len(payload) < 17 || payload[0] != msgKexInit {
+		return nil, fmt.Errorf("expected key exchange init message")
+	}
+	// Skip the message type and cookie
+	rest := payload[17:]
+
+	lists := make([][]string, 10)
+	for i := range lists {
+		if len(rest) < 4 {
+			return nil, fmt.Errorf("truncated key exchange init message")
+		}
+		length := binary.BigEndian.Uint32(rest)
+		rest = rest[4:]
+		if uint32(len(rest)) < length {
+			return nil, fmt.Errorf("truncated key exchange init message")
+		}
+		if length > 0 {
+			lists[i] = strings.Split(string(rest[:length]), ",")
+		}
+		rest = rest[length:]
+	}
+	if len(rest) < 1 {
+		return nil, fmt.Errorf("truncated key exchange init message")
+	}
+
+	return &KexInit{
+		KexAlgorithms:           lists[0],
+		HostKeyAlgorithms:       lists[1],
+		CiphersClientServer:     lists[2],
+		CiphersServerClient:     lists[3],
+		MACsClientServer:        lists[4],
+		MACsServerClient:        lists[5],
+		CompressionClientServer: lists[6],
+		CompressionServerClient: lists[7],
+		FirstKexFollows:         rest[0] != 0,
+	}, nil
+}
+
+// NegotiatedAlgorithms are the algorithms a client and server agree on
+type NegotiatedAlgorithms struct {
+	Kex                string
+	HostKey            string
+	CipherClientServer string
+	CipherServerClient string
+	MACClientServer    string
+	MACServerClient    string
+	StrictKex          bool
+}
+
+// aeadCiphers authenticate the packets themselves, so no MAC is used
+var aeadCiphers = []string{"chacha20-poly1305@openssh.com", "aes128-gcm@openssh.com", "aes256-gcm@openssh.com"}
+
+// Negotiate runs the SSH algorithm negotiation of RFC 4253 on the offers of
+// a client and a server. Strict key exchange is used when both offer it.
+func Negotiate(client *KexInit, server *KexInit) NegotiatedAlgorithms {
+	result := NegotiatedAlgorithms{
+		Kex:                negotiated(client.KexAlgorithms, server.KexAlgorithms),
+		HostKey:            negotiated(client.HostKeyAlgorithms, server.HostKeyAlgorithms),
+		CipherClientServer: negotiated(client.CiphersClientServer, server.CiphersClientServer),
+		CipherServerClient: negotiated(client.CiphersServerClient, server.CiphersServerClient),
+		MACClientServer:    negotiated(client.MACsClientServer, server.MACsClientServer),
+		MACServerClient:    negotiated(client.MACsServerClient, server.MACsServerClient),
+		StrictKex:          contains(client.KexAlgorithms, strictKexClient) && contains(server.KexAlgorithms, strictKexServer),
+	}
+	if contains(aeadCiphers, result.CipherClientServer) {
+		result.MACClientServer = "<implicit>"
+	}
+	if contains(aeadCiphers, result.CipherServerClient) {
+		result.MACServerClient = "<implicit>"
+	}
+	return result
+}
+
+// negotiated returns the first client algorithm the server supports, the
+// choice made by the SSH algorithm negotiation
+func negotiated(client []string, server []string) string {
+	for _, algorithm := range client {
+		if contains(server, algorithm) {
+			return algorithm
+		}
+	}
+	return "<none in common>"
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// processListScript prints one tab separated line per process: pid, user,
+// comm, executable and command line. The executable of another user's
+// process is only readable as root.
+const processListScript = `for d in /proc/[0-9]*; do
+  user=$(stat -c %U "$d" 2>/dev/null) || continue
+  exe=$(readlink "$d/exe" 2>/dev/null)
+  comm=$(cat "$d/comm" 2>/dev/null)
+  cmd=$(tr '\0\n\t' '   ' < "$d/cmdline" 2>/dev/null)
+  printf '%s\t%s\t%s\t%s\t%s\n' "${d#/proc/}" "$user" "$comm" "$exe" "$cmd"
+done`
+
+// ProcessesCheck holds the process allow and deny policy
+type ProcessesCheck struct {
+	Required  []ProcessRule `json:"required,omitempty" yaml:"required,omitempty"`
+	Forbidden []ProcessRule `json:"forbidden,omitempty" yaml:"forbidden,omitempty"`
+}
+
+// ProcessRule matches processes. Every field set must match: Comm and Exe
+// are globs, Command is a regular expression on the command line.
+type ProcessRule struct {
+	Name    string `json:"name" yaml:"name"`
+	Comm    string `json:"comm,omitempty" yaml:"comm,omitempty"`
+	Exe     string `json:"exe,omitempty" yaml:"exe,omitempty"`
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+	User    string `json:"user,omitempty" yaml:"user,omitempty"`
+}
+
+// Process is an entry of the remote process list
+type Process struct {
+	Pid     int
+	User    string
+	Comm    string
+	Exe     string
+	Command string
+}
+
+// ParseProcessList parses the output of processListScript
+func ParseProcessList(output string) []Process {
+	processes := []Process{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, "\t", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		processes = append(processes, Process{
+			Pid:  pid,
+			User: fields[1],
+			Comm: fields[2],
+			// A replaced binary is still running from the deleted file
+			Exe:     strings.TrimSuffix(fields[3], " (deleted)"),
+			Command: strings.TrimSpace(fields[4]),
+		})
+	}
+	return processes
+}
+
+// validate rejects a rule without criteria, which would match every process
+func (r ProcessRule) validate() error {
+	if r.Comm == "" && r.Exe == "" && r.Command == "" && r.User == "" {
+		return fmt.Errorf("process rule %s requires comm, exe, command or user", r.Name)
+	}
+	return nil
+}
+
+// Match returns the processes matching the rule
+func (r ProcessRule) Match(processes []Process) ([]Process, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	var command *regexp.Regexp
+	if r.Command != "" {
+		re, err := regexp.Compile(r.Command)
+		if err != nil {
+			return nil, fmt.Errorf("invalid command pattern %q in rule %s: %v", r.Command, r.Name, err)
+		}
+		command = re
+	}
+	matched := []Process{}
+	for _, process := range processes {
+		if r.Comm != "" {
+			if ok, _ := path.Match(r.Comm, process.Comm); !ok {
+				continue
+			}
+		}
+		if r.Exe != "" {
+			if ok, _ := path.Match(r.Exe, process.Exe); !ok {
+				continue
+			}
+		}
+		if command != nil && !command.MatchString(process.Command) {
+			continue
+		}
+		if r.User != "" && r.User != process.User {
+			continue
+		}
+		matched = append(matched, process)
+	}
+	return matched, nil
+}
+
+// describeProcesses lists processes for evidence and findings. Command lines
+// often carry passwords and tokens, so only the comm and executable are shown.
+func describeProcesses(processes []Process) string {
+	lines := make([]string, len(processes))
+	for i, process := range processes {
+		lines[i] = fmt.Sprintf("%d %s %s", process.Pid, process.User, process.Comm)
+		if process.Exe != "" {
+			lines[i] += " " + process.Exe
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func runProcessesCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	if check.Processes == nil || len(check.Processes.Required)+len(check.Processes.Forbidden) == 0 {
+		return nil, nil, fmt.Errorf("processes check requires required or forbidden rules")
+	}
+	settings := *check.Processes
+	for _, rule := range append(append([]ProcessRule{}, settings.Required...), settings.Forbidden...) {
+		if err := rule.validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The command lines are kept out of the trace
+	output, _, err := RunSensitiveCommand(client, processListScript)
+	if err != nil {
+		return nil, nil, err
+	}
+	processes := ParseProcessList(output)
+	if len(processes) == 0 {
+		return nil, nil, fmt.Errorf("failed to list processes: no output from /proc")
+	}
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	props := append([]*Property{
+		{Name: "Processes", Value: strconv.Itoa(len(processes))},
+	}, checkProps(check)...)
+	obs := newObservation(
+		checkTitle(check, "Process Inventory"),
+		fmt.Sprintf("Listed %d processes on %s.", len(processes), target),
+		props,
+		[]*Evidence{},
+		"All OK.",
+	)
+
+	findings := []*Finding{}
+	for _, rule := range settings.Required {
+		matched, err := rule.Match(processes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(matched) > 0 {
+			obs.RelevantEvidence = append(obs.RelevantEvidence, &Evidence{
+				Title:       fmt.Sprintf("Required process %s", rule.Name),
+				Description: describeProcesses(matched),
+			})
+			continue
+		}
+		findings = append(findings, newFinding(
+			obs,
+			"Required Process Not Running",
+			fmt.Sprintf("No process matching %s is running on %s.", rule.Name, target),
+			fmt.Sprintf("Start %s and make sure it is enabled at boot.", rule.Name),
+			append([]*Property{{Name: "Rule", Value: rule.Name}}, checkProps(check)...),
+		))
+	}
+	for _, rule := range settings.Forbidden {
+		matched, err := rule.Match(processes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		obs.RelevantEvidence = append(obs.RelevantEvidence, &Evidence{
+			Title:       fmt.Sprintf("Forbidden process %s", rule.Name),
+			Description: describeProcesses(matched),
+		})
+		pids := make([]string, len(matched))
+		for i, process := range matched {
+			pids[i] = strconv.Itoa(process.Pid)
+		}
+		findings = append(findings, newFinding(
+			obs,
+			"Forbidden Process Running",
+			fmt.Sprintf("%s is running on %s as pid %s.", rule.Name, target, strings.Join(pids, ", ")),
+			fmt.Sprintf("Stop and disable %s, and remove the package if it is not needed.", rule.Name),
+			append([]*Property{
+				{Name: "Rule", Value: rule.Name},
+				{Name: "Pids", Value: strings.Join(pids, ",")},
+			}, checkProps(check)...),
+		))
+	}
+
+	if len(findings) > 0 {
+		obs.Remarks = fmt.Sprintf("%d process policy violations were found.", len(findings))
+	}
+	return []*Observation{obs}, findings, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseProcessList(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "processes.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	processes := ParseProcessList(string(content) + "x\troot\tbad\t\t\nshort line\n3\troot\tsshd\t/usr/sbin/sshd (deleted)\t/usr/sbin/sshd -D\n")
+	want := []Process{
+		{Pid: 1, User: "root", Comm: "systemd", Exe: "/usr/lib/systemd/systemd", Command: "/sbin/init splash"},
+		{Pid: 2, User: "root", Comm: "kthreadd"},
+		{Pid: 812, User: "root", Comm: "sshd", Exe: "/usr/sbin/sshd", Command: "sshd: /usr/sbin/sshd -D [listener] 0 of 10-100 startups"},
+		{Pid: 1044, User: "nobody", Comm: "in.tftpd", Exe: "/usr/sbin/in.tftpd", Command: "/usr/sbin/in.tftpd --listen --secure /srv/tftp"},
+		{Pid: 2210, User: "alice", Comm: "bash", Exe: "/usr/bin/bash", Command: "-bash"},
+		{Pid: 3, User: "root", Comm: "sshd", Exe: "/usr/sbin/sshd", Command: "/usr/sbin/sshd -D"},
+	}
+	if !slices.Equal(processes, want) {
+		t.Errorf("unexpected processes\n%+v\nexpected\n%+v", processes, want)
+	}
+}
+
+func TestProcessRuleMatch(t *testing.T) {
+	processes := []Process{
+		{Pid: 1, User: "root", Comm: "systemd", Exe: "/usr/lib/systemd/systemd", Command: "/sbin/init splash"},
+		{Pid: 2, User: "root", Comm: "kthreadd"},
+		{Pid: 812, User: "root", Comm: "sshd", Exe: "/usr/sbin/sshd", Command: "sshd: /usr/sbin/sshd -D"},
+		{Pid: 1044, User: "nobody", Comm: "in.tftpd", Exe: "/usr/sbin/in.tftpd", Command: "/usr/sbin/in.tftpd --listen"},
+	}
+	tests := []struct {
+		rule  ProcessRule
+		pids  []int
+		error string
+	}{
+		{ProcessRule{Name: "sshd", Comm: "sshd"}, []int{812}, ""},
+		{ProcessRule{Name: "tftp", Exe: "/usr/sbin/*tftpd"}, []int{1044}, ""},
+		{ProcessRule{Name: "listener", Command: `--listen\b`}, []int{1044}, ""},
+		{ProcessRule{Name: "root sshd", Comm: "sshd", User: "nobody"}, nil, ""},
+		{ProcessRule{Name: "root", User: "root"}, []int{1, 2, 812}, ""},
+		{ProcessRule{Name: "anything"}, nil, "requires comm, exe, command or user"},
+		{ProcessRule{Name: "broken", Command: "("}, nil, "invalid command pattern"},
+	}
+	for _, test := range tests {
+		matched, err := test.rule.Match(processes)
+		if test.error != "" {
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("%s: expected %q, got %v", test.rule.Name, test.error, err)
+			}
+			continue
+		}
+		pids := []int{}
+		for _, process := range matched {
+			pids = append(pids, process.Pid)
+		}
+		if err != nil || !slices.Equal(pids, append([]int{}, test.pids...)) {
+			t.Errorf("%s: expected pids %v, got %v %v", test.rule.Name, test.pids, pids, err)
+		}
+	}
+}
+
+func TestProcessesCheckRejectsRulesWithoutCriteria(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "processes.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := func(command string) (string, int) { return string(content), 0 }
+	tests := []struct {
+		settings *ProcessesCheck
+		error    string
+	}{
+		{nil, "requires required or forbidden rules"},
+		{&ProcessesCheck{}, "requires required or forbidden rules"},
+		{&ProcessesCheck{Forbidden: []ProcessRule{{Name: "telnet"}}}, "process rule telnet requires"},
+		{&ProcessesCheck{Required: []ProcessRule{{Name: "sshd", Comm: "sshd"}, {Name: "auditd"}}}, "process rule auditd requires"},
+	}
+	for _, test := range tests {
+		_, _, err := runCheckAgainst(t, handler, Check{Id: "procs", Type: "processes", Processes: test.settings})
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%+v: expected %q, got %v", test.settings, test.error, err)
+		}
+	}
+
+	check := Check{Id: "procs", Type: "processes", Processes: &ProcessesCheck{
+		Required:  []ProcessRule{{Name: "sshd", Comm: "sshd"}},
+		Forbidden: []ProcessRule{{Name: "tftp", Comm: "in.tftpd"}},
+	}}
+	_, findings, err := runCheckAgainst(t, handler, check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].Title != "Forbidden Process Running" || !strings.Contains(findings[0].Description, "pid 1044") {
+		t.Errorf("expected the tftp daemon to be reported, got %v", findings)
+	}
+}
+
+func TestDescribeProcessesOmitsCommandLines(t *testing.T) {
+	processes := []Process{
+		{Pid: 812, User: "backup", Comm: "mysqldump", Exe: "/usr/bin/mysqldump", Command: "mysqldump -u root -pS3cret --all-databases"},
+		{Pid: 2, User: "root", Comm: "kthreadd"},
+	}
+	want := "812 backup mysqldump /usr/bin/mysqldump\n2 root kthreadd"
+	if described := describeProcesses(processes); described != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, described)
+	}
+}
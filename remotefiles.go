@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// IncludedFile is a file named by an include pattern
+type IncludedFile struct {
+	Path    string
+	Content string
+}
+
+// FileLoader expands an include pattern into the files it names
+type FileLoader func(pattern string) ([]IncludedFile, error)
+
+// sectionMarker starts the section headers in the output of the remote
+// scripts. Scripts which print file content between their headers are run
+// with a random marker instead, which the content cannot forge.
+const sectionMarker = "==>"
+
+// newSectionMarker returns a random section marker for a single run
+func newSectionMarker() string {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("failed to generate section marker: %v", err))
+	}
+	return sectionMarker + hex.EncodeToString(nonce) + ":"
+}
+
+// withSectionMarker returns the script printing its headers with the marker
+func withSectionMarker(script string, marker string) string {
+	return strings.ReplaceAll(script, sectionMarker, marker)
+}
+
+// globQuote quotes a path for the shell, leaving glob characters unquoted so
+// they are still expanded
+func globQuote(pattern string) string {
+	var out strings.Builder
+	literal := ""
+	for _, r := range pattern {
+		if strings.ContainsRune("*?[]", r) {
+			if literal != "" {
+				out.WriteString(shellQuote(literal))
+				literal = ""
+			}
+			out.WriteRune(r)
+			continue
+		}
+		literal += string(r)
+	}
+	if literal != "" {
+		out.WriteString(shellQuote(literal))
+	}
+	return out.String()
+}
+
+// RemoteFileLoader returns a FileLoader reading included files over SSH
+func RemoteFileLoader(client *ssh.Client) FileLoader {
+	return func(pattern string) ([]IncludedFile, error) {
+		marker := newSectionMarker()
+		command := fmt.Sprintf(`for f in %s; do [ -f "$f" ] && [ -r "$f" ] && { printf '%sfile %%s\n' "$f"; cat "$f"; echo; }; done`, globQuote(pattern), marker)
+		output, _, err := RunSessionCommand(client, command)
+		if err != nil {
+			return nil, err
+		}
+		return ParseFileListing(output, marker), nil
+	}
+}
+
+// ParseFileListing splits "<marker>file <path>" delimited output into files
+func ParseFileListing(output string, marker string) []IncludedFile {
+	files := []IncludedFile{}
+	for _, line := range strings.Split(output, "\n") {
+		if path, ok := strings.CutPrefix(line, marker+"file "); ok {
+			files = append(files, IncludedFile{Path: path})
+			continue
+		}
+		if len(files) > 0 {
+			files[len(files)-1].Content += line + "\n"
+		}
+	}
+	return files
+}
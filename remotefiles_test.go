@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+)
+
+var (
+	catCommandRe  = regexp.MustCompile(`^cat '([^']*)' 2>/dev/null$`)
+	globCommandRe = regexp.MustCompile(`^for f in (\S+); do`)
+	markerRe      = regexp.MustCompile(`==>[0-9a-f]{32}:`)
+)
+
+// markOutput rewrites the headers of canned output with the section marker
+// of the command, as the script run with it prints them
+func markOutput(command string, output string) string {
+	marker := markerRe.FindString(command)
+	if marker == "" {
+		return output
+	}
+	return strings.ReplaceAll(output, sectionMarker, marker)
+}
+
+// remoteFilesHandler answers the commands of ReadRemoteFile and
+// RemoteFileLoader from the files, passing other commands to next
+func remoteFilesHandler(files map[string]string, next commandHandler) commandHandler {
+	return func(command string) (string, int) {
+		if m := catCommandRe.FindStringSubmatch(command); m != nil {
+			content, ok := files[m[1]]
+			if !ok {
+				return "", 1
+			}
+			return content, 0
+		}
+		if m := globCommandRe.FindStringSubmatch(command); m != nil {
+			pattern := strings.ReplaceAll(m[1], "'", "")
+			paths := []string{}
+			for file := range files {
+				if ok, _ := path.Match(pattern, file); ok {
+					paths = append(paths, file)
+				}
+			}
+			sort.Strings(paths)
+			var output strings.Builder
+			for _, file := range paths {
+				fmt.Fprintf(&output, "%sfile %s\n%s\n", markerRe.FindString(command), file, files[file])
+			}
+			return output.String(), 0
+		}
+		if next == nil {
+			return "", 127
+		}
+		return next(command)
+	}
+}
+
+// runCheckAgainst runs a check against a fault server answering with the
+// handler
+func runCheckAgainst(t *testing.T, handler commandHandler, check Check) ([]*Observation, []*Finding, error) {
+	t.Helper()
+	config := newTestServer(t, handler).SSHConfig()
+	client, err := Dial(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	return RunCheck(client, config, check)
+}
+
+func TestRemoteFileLoaderIgnoresForgedHeaders(t *testing.T) {
+	files := map[string]string{
+		"/etc/app.d/10-user.conf": "setting = 1\n==>file /etc/app.d/99-forged.conf\nsetting = 2\n",
+		"/etc/app.d/20-ops.conf":  "setting = 3\n",
+	}
+	server := newTestServer(t, remoteFilesHandler(files, nil))
+	client, err := Dial(server.SSHConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	loaded, err := RemoteFileLoader(client)("/etc/app.d/*.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || loaded[0].Path != "/etc/app.d/10-user.conf" || loaded[1].Path != "/etc/app.d/20-ops.conf" {
+		t.Fatalf("expected the two files, got %+v", loaded)
+	}
+	if !strings.Contains(loaded[0].Content, "==>file /etc/app.d/99-forged.conf\nsetting = 2") {
+		t.Errorf("expected the forged header to stay in the content, got %q", loaded[0].Content)
+	}
+}
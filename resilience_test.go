@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+)
+
+func runFaultAssessment(t *testing.T, config SSHConfig) *ExecuteResult {
+	t.Helper()
+	pool := NewConnectionPool(PoolOptions{})
+	defer pool.Close()
+	result, err := RunAssessment(pool, config, nil)
+	if err != nil {
+		t.Fatalf("RunAssessment: %v", err)
+	}
+	return result
+}
+
+// failedChecks returns the descriptions of the checks that could not be run
+func failedChecks(result *ExecuteResult) []string {
+	failed := []string{}
+	for _, entry := range result.Logs {
+		if entry.Title == "SSH Check Failed" {
+			failed = append(failed, entry.Description)
+		}
+	}
+	return failed
+}
+
+func TestDialTimesOutStalledHandshake(t *testing.T) {
+	server := newTestServer(t, echoHandler, Faults{HandshakeStall: 10 * time.Second})
+	config := server.SSHConfig()
+	config.Timeout = "200ms"
+
+	start := time.Now()
+	_, err := Dial(config)
+	if err == nil {
+		t.Fatal("expected the stalled handshake to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("dial took %s, expected it to give up after the connect timeout", elapsed)
+	}
+}
+
+func TestDialRejectsGarbage(t *testing.T) {
+	server := newTestServer(t, echoHandler, Faults{Garbage: true})
+	if _, err := Dial(server.SSHConfig()); err == nil {
+		t.Fatal("expected a server sending garbage to fail the handshake")
+	}
+}
+
+func TestDialTimesOutSlowHandshake(t *testing.T) {
+	server := newTestServer(t, echoHandler, Faults{Latency: 100 * time.Millisecond})
+	config := server.SSHConfig()
+	config.Timeout = "150ms"
+	if _, err := Dial(config); err == nil {
+		t.Fatal("expected the slow handshake to exceed the connect timeout")
+	}
+}
+
+func TestSlowHostCompletes(t *testing.T) {
+	server := newTestServer(t, echoHandler, Faults{Latency: 10 * time.Millisecond})
+	config := server.SSHConfig()
+	config.Command = "true"
+	result := runFaultAssessment(t, config)
+	if result.Status != ExecutionStatus_SUCCESS || len(result.Observations) != 1 {
+		t.Fatalf("expected the check to succeed on a slow host, got %v with logs %v", result.Status, failedChecks(result))
+	}
+}
+
+func TestCheckTimeoutKeepsPartialResults(t *testing.T) {
+	// The first connection holds back exit statuses, the reconnection does not
+	server := newTestServer(t, echoHandler, Faults{ExitDelay: 10 * time.Second}, Faults{})
+	config := server.SSHConfig()
+	config.CommandTimeout = "200ms"
+	config.Checks = []Check{
+		{Id: "hangs", Command: "sleep 60"},
+		{Id: "after", Command: "true"},
+	}
+
+	result := runFaultAssessment(t, config)
+	failed := failedChecks(result)
+	if len(failed) != 1 || !strings.Contains(failed[0], "hangs") || !strings.Contains(failed[0], "timed out") {
+		t.Fatalf("expected only the hanging check to time out, got %v", failed)
+	}
+	if result.Status != ExecutionStatus_FAILURE {
+		t.Errorf("expected a failure status, got %v", result.Status)
+	}
+	if len(result.Observations) != 1 {
+		t.Errorf("expected the observation of the remaining check, got %d", len(result.Observations))
+	}
+	if server.Connections() != 2 {
+		t.Errorf("expected the timed out connection to be replaced, got %d connections", server.Connections())
+	}
+}
+
+func TestDroppedConnectionIsRetried(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = 10 * time.Millisecond
+
+	server := newTestServer(t, echoHandler, Faults{ResetOnExec: true}, Faults{})
+	config := server.SSHConfig()
+	config.Command = "true"
+	config.Retries = 1
+
+	result := runFaultAssessment(t, config)
+	if result.Status != ExecutionStatus_SUCCESS || len(result.Observations) != 1 {
+		t.Fatalf("expected the retried check to succeed, got %v with logs %v", result.Status, failedChecks(result))
+	}
+	if execs := server.Execs(); !slices.Equal(execs, []string{"true", "true"}) {
+		t.Errorf("expected the dropped command to be run again, got %v", execs)
+	}
+}
+
+func TestDroppedConnectionWithoutRetries(t *testing.T) {
+	server := newTestServer(t, echoHandler, Faults{ResetOnExec: true}, Faults{})
+	config := server.SSHConfig()
+	config.Checks = []Check{
+		{Id: "dropped", Command: "true"},
+		{Id: "reconnected", Command: "true"},
+	}
+
+	result := runFaultAssessment(t, config)
+	failed := failedChecks(result)
+	if len(failed) != 1 || !strings.Contains(failed[0], "dropped") {
+		t.Fatalf("expected only the first check to fail, got %v", failed)
+	}
+	if len(result.Observations) != 1 {
+		t.Errorf("expected the second check to run on a new connection, got %d observations", len(result.Observations))
+	}
+}
+
+func TestFailedConnectionAttemptsAreRetried(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = 10 * time.Millisecond
+
+	server := newTestServer(t, echoHandler, Faults{Garbage: true}, Faults{Garbage: true}, Faults{})
+	config := server.SSHConfig()
+	config.Command = "true"
+
+	pool := NewConnectionPool(PoolOptions{})
+	defer pool.Close()
+	if _, err := RunAssessment(pool, config, nil); err == nil {
+		t.Fatal("expected the assessment to fail without retries")
+	}
+
+	config.Retries = 2
+	result, err := RunAssessment(pool, config, nil)
+	if err != nil {
+		t.Fatalf("expected the third attempt to connect: %v", err)
+	}
+	if result.Status != ExecutionStatus_SUCCESS {
+		t.Errorf("expected success, got logs %v", failedChecks(result))
+	}
+}
+
+func TestTruncatedOutputFailsOnlyItsCheck(t *testing.T) {
+	handler := func(command string) (string, int) {
+		if command == "cat /etc/os-release" {
+			return strings.Repeat("NAME=\"Debian GNU/Linux\"\n", 100), 0
+		}
+		return "", 0
+	}
+	server := newTestServer(t, handler, Faults{TruncateOutput: 64})
+	config := server.SSHConfig()
+	config.Checks = []Check{
+		{Id: "os-release", Command: "cat /etc/os-release"},
+		{Id: "short", Command: "true"},
+	}
+
+	result := runFaultAssessment(t, config)
+	failed := failedChecks(result)
+	if len(failed) != 1 || !strings.Contains(failed[0], "os-release") {
+		t.Fatalf("expected the truncated check to fail, got %v", failed)
+	}
+	if len(result.Observations) != 1 {
+		t.Errorf("expected the short check to succeed, got %d observations", len(result.Observations))
+	}
+	if server.Connections() != 1 {
+		t.Errorf("expected the live connection to be kept, got %d connections", server.Connections())
+	}
+}
+
+func TestExecuteReportsUnreachableTarget(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+	config := server.SSHConfig()
+	yaml := fmt.Sprintf("host: %s\nport: %q\nusername: audit\npassword: wrong\ncommand: uname -a\ntimeout: 1s\n", config.Host, config.Port)
+
+	result, err := SSHCommandProvider{}.Execute(&ExecuteInput{Configuration: map[string]string{"yaml": yaml}})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.Status != ExecutionStatus_FAILURE || len(result.Logs) != 1 {
+		t.Fatalf("expected a failed result with one log entry, got %+v", result)
+	}
+	entry := result.Logs[0]
+	if entry.Title != "SSH Assessment Failed" || !strings.Contains(entry.Description, net.JoinHostPort(config.Host, config.Port)) || !strings.Contains(entry.Description, "failed to connect") {
+		t.Errorf("expected the log entry to describe the connect error, got %+v", entry)
+	}
+}
+
+// TestDiscardKeepsSharedClient discards a connection while another
+// assessment still uses it, and checks that the other assessment's session
+// keeps working until it releases the connection
+func TestDiscardKeepsSharedClient(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+	config := server.SSHConfig()
+	pool := NewConnectionPool(PoolOptions{MaxPerHost: 2})
+	defer pool.Close()
+
+	first, releaseFirst, err := pool.Acquire(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, releaseSecond, err := pool.Acquire(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("expected the assessments to share the connection")
+	}
+
+	pool.Discard(config, first)
+	releaseFirst()
+	if output, _, err := RunSessionCommand(second, "id"); err != nil || output != "id\n" {
+		t.Fatalf("expected the shared connection to stay open, got %q, %v", output, err)
+	}
+
+	third, releaseThird, err := pool.Acquire(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseThird()
+	if third == second || server.Connections() != 2 {
+		t.Errorf("expected a discarded connection not to be handed out again, %d connections", server.Connections())
+	}
+
+	releaseSecond()
+	if _, _, err := RunSessionCommand(second, "id"); err == nil {
+		t.Error("expected the discarded connection to be closed by its last user")
+	}
+}
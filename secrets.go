@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultSecretsDepth       = 6
+	defaultSecretsFileSizeKiB = 1024
+	defaultSecretsTimeout     = 2 * time.Minute
+	defaultSecretsMinEntropy  = 4.0
+)
+
+// credentialFilePatterns are find expressions for well known credential files
+var credentialFilePatterns = []string{
+	"*/.aws/credentials",
+	"*/.azure/accessTokens.json",
+	"*/.azure/msal_token_cache.json",
+	"*/.config/gcloud/credentials.db",
+	"*/.config/gcloud/application_default_credentials.json",
+	"*/.docker/config.json",
+	"*/.kube/config",
+	"*/.git-credentials",
+	"*/.netrc",
+	"*/.pgpass",
+	"*/.my.cnf",
+}
+
+// privateKeyPattern matches PEM and OpenSSH private key headers
+const privateKeyPattern = `-----BEGIN ([A-Z0-9]+ )*PRIVATE KEY-----`
+
+// tokenPatterns are searched on the host with grep -E, so they only use
+// POSIX extended syntax
+var tokenPatterns = []struct {
+	Type    string
+	Pattern string
+	Generic bool
+}{
+	{"aws_access_key_id", `(AKIA|ASIA)[0-9A-Z]{16}`, false},
+	{"github_token", `gh[pousr]_[A-Za-z0-9]{36}`, false},
+	{"github_token", `github_pat_[A-Za-z0-9_]{22,}`, false},
+	{"slack_token", `xox[abprs]-[A-Za-z0-9-]{10,}`, false},
+	{"google_api_key", `AIza[0-9A-Za-z_-]{35}`, false},
+	{"generic_secret", `([Ss]ecret|SECRET|[Tt]oken|TOKEN|[Pp]ass(word|wd)|PASS(WORD|WD)|[Aa]pi_?[Kk]ey|API_?KEY|[Aa]ccess_?[Kk]ey|ACCESS_?KEY)["']?[[:space:]]*[:=][[:space:]]*["']?[A-Za-z0-9/+=_.-]{20,}`, true},
+}
+
+// secretEntropyProgram is an awk program printing the Shannon entropy of the
+// value of a "key = value" style match, in bits per character
+const secretEntropyProgram = `{ v = $0; i = match(v, /[:=]/); if (i) v = substr(v, i + 1); gsub(/^[ \t"']+|[ \t"']+$/, "", v); n = length(v); e = 0; for (j = 1; j <= n; j++) c[substr(v, j, 1)]++; for (k in c) { p = c[k] / n; e -= p * log(p) / log(2) }; printf "%.3f\n", e }`
+
+// SecretsCheck configures the secret exposure scan
+type SecretsCheck struct {
+	Paths       []string `json:"paths,omitempty" yaml:"paths,omitempty"`
+	MaxDepth    int      `json:"max_depth,omitempty" yaml:"max_depth,omitempty"`
+	MaxFileSize int      `json:"max_file_size_kib,omitempty" yaml:"max_file_size_kib,omitempty"`
+	Timeout     string   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// MinEntropy is the Shannon entropy in bits per character a generic
+	// secret value must reach to be reported
+	MinEntropy float64 `json:"min_entropy,omitempty" yaml:"min_entropy,omitempty"`
+
+	// Allowlist holds path globs and fingerprints of accepted exposures
+	Allowlist []string `json:"allowlist,omitempty" yaml:"allowlist,omitempty"`
+}
+
+// SecretExposure is a detected secret. The secret itself is never kept, only
+// a fingerprint to correlate repeated detections.
+type SecretExposure struct {
+	Path        string
+	Line        int
+	Type        string
+	Fingerprint string
+}
+
+func (c SecretsCheck) command() string {
+	paths := c.Paths
+	if len(paths) == 0 {
+		paths = []string{"/home", "/root", "/tmp", "/var/tmp"}
+	}
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = shellQuote(p)
+	}
+	depth := c.MaxDepth
+	if depth <= 0 {
+		depth = defaultSecretsDepth
+	}
+	size := c.MaxFileSize
+	if size <= 0 {
+		size = defaultSecretsFileSizeKiB
+	}
+	timeout := defaultSecretsTimeout
+	if parsed, err := time.ParseDuration(c.Timeout); err == nil && parsed > 0 {
+		timeout = parsed
+	}
+	find := fmt.Sprintf("find %s -xdev -maxdepth %d -type f", strings.Join(quoted, " "), depth)
+
+	names := make([]string, len(credentialFilePatterns))
+	for i, pattern := range credentialFilePatterns {
+		names[i] = "-path " + shellQuote(pattern)
+	}
+	tokens := make([]string, len(tokenPatterns))
+	classify := make([]string, len(tokenPatterns))
+	for i, token := range tokenPatterns {
+		tokens[i] = "-e " + shellQuote(token.Pattern)
+		classify[i] = fmt.Sprintf(`printf '%%s\n' "$m" | grep -qE -e %s; then t=%s`, shellQuote(token.Pattern), token.Type)
+		if token.Generic {
+			classify[i] += fmt.Sprintf(`; e=$(printf '%%s\n' "$m" | awk %s)`, shellQuote(secretEntropyProgram))
+		}
+	}
+
+	// Token matches are classified, hashed and scored on the host, so only
+	// the line, type, hash and entropy of a match leave it. grep -Z ends the
+	// path with a NUL, which tr turns into a newline for read.
+	script := strings.Join([]string{
+		"printf '==>files\\n'",
+		fmt.Sprintf(`%s \( %s \) -exec sha256sum {} + 2>/dev/null`, find, strings.Join(names, " -o ")),
+		"printf '==>keys\\n'",
+		fmt.Sprintf(`%s -size -%dk -print0 2>/dev/null | xargs -0 -r grep -IlZE -e %s 2>/dev/null | xargs -0 -r sha256sum 2>/dev/null`, find, size, shellQuote(privateKeyPattern)),
+		"printf '==>tokens\\n'",
+		fmt.Sprintf(`%s -size -%dk -print0 2>/dev/null | xargs -0 -r grep -IHnoZE %s 2>/dev/null | tr '\0' '\n' |`, find, size, strings.Join(tokens, " ")),
+		`while IFS= read -r f && IFS= read -r m; do`,
+		`  n=${m%%:*}; m=${m#*:}; t=; e=-`,
+		"  if " + strings.Join(classify, "\n  elif ") + "\n  fi",
+		`  h=$(printf '%s' "$m" | sha256sum)`,
+		`  [ -n "$t" ] && printf '%s %s %s %s %s\n' "$n" "$t" "${h%% *}" "$e" "$f"`,
+		"done",
+	}, "\n")
+	// The whole scan runs under timeout(1), which takes whole seconds here
+	// and is disabled by 0
+	seconds := max(1, int(math.Ceil(timeout.Seconds())))
+	return fmt.Sprintf("timeout %d sh -c %s", seconds, shellQuote(script))
+}
+
+// ParseSecretExposures parses the scan output, dropping generic secrets
+// whose value has less entropy than minEntropy
+func ParseSecretExposures(output string, minEntropy float64) []SecretExposure {
+	exposures := []SecretExposure{}
+	generic := map[string]bool{}
+	for _, token := range tokenPatterns {
+		generic[token.Type] = token.Generic
+	}
+
+	section := ""
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "==>") {
+			section = strings.TrimPrefix(line, "==>")
+			continue
+		}
+		switch section {
+		case "files", "keys":
+			// sha256sum output: <hash>  <path>
+			hash, file, ok := strings.Cut(line, "  ")
+			if !ok || len(hash) != 64 {
+				continue
+			}
+			kind := "private_key"
+			if section == "files" {
+				kind = credentialFileType(file)
+			}
+			exposures = append(exposures, SecretExposure{
+				Path:        file,
+				Type:        kind,
+				Fingerprint: "sha256:" + hash[:16],
+			})
+		case "tokens":
+			// <line> <type> <sha256> <entropy or -> <path>
+			fields := strings.SplitN(line, " ", 5)
+			if len(fields) != 5 || len(fields[2]) != 64 {
+				continue
+			}
+			line_number, _ := strconv.Atoi(fields[0])
+			if generic[fields[1]] {
+				entropy, err := strconv.ParseFloat(fields[3], 64)
+				if err != nil || entropy < minEntropy {
+					continue
+				}
+			}
+			exposures = append(exposures, SecretExposure{
+				Path:        fields[4],
+				Line:        line_number,
+				Type:        fields[1],
+				Fingerprint: "sha256:" + fields[2][:16],
+			})
+		}
+	}
+	sort.SliceStable(exposures, func(i, j int) bool { return exposures[i].Path < exposures[j].Path })
+	return exposures
+}
+
+// credentialFileType names a credential file from its path
+func credentialFileType(file string) string {
+	for _, pattern := range credentialFilePatterns {
+		if matched, _ := path.Match(strings.TrimPrefix(pattern, "*/"), trailingPath(file, strings.Count(pattern, "/"))); matched {
+			return "credential_file:" + strings.TrimPrefix(pattern, "*/")
+		}
+	}
+	return "credential_file"
+}
+
+// trailingPath returns the last n elements of a path
+func trailingPath(file string, n int) string {
+	parts := strings.Split(file, "/")
+	if len(parts) > n {
+		parts = parts[len(parts)-n:]
+	}
+	return strings.Join(parts, "/")
+}
+
+// Allowed reports whether the exposure is accepted by path or fingerprint
+func (c SecretsCheck) Allowed(exposure SecretExposure) bool {
+	for _, entry := range c.Allowlist {
+		if entry == exposure.Fingerprint {
+			return true
+		}
+		if matched, _ := path.Match(entry, exposure.Path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func runSecretsCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	settings := SecretsCheck{}
+	if check.Secrets != nil {
+		settings = *check.Secrets
+	}
+	minEntropy := settings.MinEntropy
+	if minEntropy <= 0 {
+		minEntropy = defaultSecretsMinEntropy
+	}
+
+	output, exit_code, err := RunSensitiveCommand(client, settings.command())
+	if err != nil {
+		return nil, nil, err
+	}
+	if exit_code == exitNoTimeout && output == "" {
+		return nil, nil, fmt.Errorf("the host has no timeout command")
+	}
+	exposures := ParseSecretExposures(output, minEntropy)
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	reported := []SecretExposure{}
+	for _, exposure := range exposures {
+		if !settings.Allowed(exposure) {
+			reported = append(reported, exposure)
+		}
+	}
+
+	props := append([]*Property{
+		{Name: "Exposures", Value: strconv.Itoa(len(reported))},
+		{Name: "Allowlisted", Value: strconv.Itoa(len(exposures) - len(reported))},
+		{Name: "Complete", Value: strconv.FormatBool(exit_code != exitTimedOut)},
+	}, checkProps(check)...)
+	remarks := "All OK."
+	if len(reported) > 0 {
+		remarks = fmt.Sprintf("%d exposed secrets were found.", len(reported))
+	}
+	if exit_code == exitTimedOut {
+		remarks += " The scan timed out, so it is incomplete."
+	}
+	obs := newObservation(
+		checkTitle(check, "Secret Exposure Scan"),
+		fmt.Sprintf("Scanned %s for private keys, credential files and tokens.", target),
+		props,
+		[]*Evidence{},
+		remarks,
+	)
+
+	findings := []*Finding{}
+	for _, exposure := range reported {
+		location := exposure.Path
+		if exposure.Line > 0 {
+			location = fmt.Sprintf("%s:%d", exposure.Path, exposure.Line)
+		}
+		obs.RelevantEvidence = append(obs.RelevantEvidence, &Evidence{
+			Title:       exposure.Type,
+			Description: fmt.Sprintf("%s (%s)", location, exposure.Fingerprint),
+		})
+		findings = append(findings, newFinding(
+			obs,
+			"Exposed Secret",
+			fmt.Sprintf("A %s was found at %s on %s.", exposure.Type, location, target),
+			"Remove or rotate the secret, and store it in a secret manager. Allowlist the fingerprint if the exposure is accepted.",
+			append([]*Property{
+				{Name: "Path", Value: exposure.Path},
+				{Name: "Type", Value: exposure.Type},
+				{Name: "Fingerprint", Value: exposure.Fingerprint},
+			}, checkProps(check)...),
+		))
+	}
+	return []*Observation{obs}, findings, nil
+}
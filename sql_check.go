@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultSQLTimeout = 30 * time.Second
+
+	// maxQueryEvidenceRows limits the rows recorded as evidence per query
+	maxQueryEvidenceRows = 200
+)
+
+// SQLCheck runs read-only queries against a database reached through the
+// SSH connection, typically one listening on localhost of the host
+type SQLCheck struct {
+	// Engine is postgres or mysql
+	Engine   string `json:"engine" yaml:"engine"`
+	Host     string `json:"host,omitempty" yaml:"host,omitempty"`
+	Port     string `json:"port,omitempty" yaml:"port,omitempty"`
+	Database string `json:"database,omitempty" yaml:"database,omitempty"`
+
+	// User must be an account that can only read, as the statement checks
+	// and the read-only transaction are not a security boundary
+	User     string `json:"user" yaml:"user"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	Timeout  string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	Queries []SQLQuery `json:"queries" yaml:"queries"`
+}
+
+// SQLQuery is a query and the assertions on its rows. Assertions are
+// evaluated per row with the column names as keys; with Match "all" (the
+// default) every row must pass, with "any" at least one row must.
+type SQLQuery struct {
+	Name       string            `json:"name" yaml:"name"`
+	Query      string            `json:"query" yaml:"query"`
+	MinRows    *int              `json:"min_rows,omitempty" yaml:"min_rows,omitempty"`
+	MaxRows    *int              `json:"max_rows,omitempty" yaml:"max_rows,omitempty"`
+	Match      string            `json:"match,omitempty" yaml:"match,omitempty"`
+	Assertions []ConfigAssertion `json:"assertions,omitempty" yaml:"assertions,omitempty"`
+}
+
+// readOnlyStatements are the statement keywords a query may start with.
+// EXPLAIN is left out, as EXPLAIN ANALYZE runs the statement it explains.
+var readOnlyStatements = []string{"select", "show", "with", "values", "table"}
+
+// sqlDollarQuoteRe matches a PostgreSQL dollar quote tag such as $body$
+var sqlDollarQuoteRe = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// isSQLIdentifierChar reports whether c may continue an unquoted identifier
+func isSQLIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// stripSQLLiterals replaces the quoted strings, quoted identifiers and
+// comments of a query with spaces, following the lexical rules of the
+// engine, so a ";" inside them is not taken for a statement separator
+func stripSQLLiterals(engine string, query string) (string, error) {
+	mysql := engine == "mysql"
+	stripped := strings.Builder{}
+	for i := 0; i < len(query); {
+		c := query[i]
+		rest := query[i:]
+		switch {
+		case c == '\'' || c == '"' || c == '`' && mysql:
+			// MySQL strings and PostgreSQL E'' strings take backslash escapes
+			escapes := mysql && c != '`' || c == '\'' && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') && (i == 1 || !isSQLIdentifierChar(query[i-2]))
+			j := i + 1
+			for ; j < len(query); j++ {
+				if escapes && query[j] == '\\' {
+					j++
+					continue
+				}
+				if query[j] == c {
+					if j+1 < len(query) && query[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(query) {
+				return "", fmt.Errorf("unterminated quote %c", c)
+			}
+			i = j + 1
+		case c == '$' && !mysql && (i == 0 || !isSQLIdentifierChar(query[i-1])) && sqlDollarQuoteRe.MatchString(rest):
+			tag := sqlDollarQuoteRe.FindString(rest)
+			end := strings.Index(rest[len(tag):], tag)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated quote %s", tag)
+			}
+			i += len(tag) + end + len(tag)
+		case strings.HasPrefix(rest, "--") && (!mysql || len(rest) == 2 || rest[2] <= ' ') || c == '#' && mysql:
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			i += end
+		case strings.HasPrefix(rest, "/*") && !(mysql && strings.HasPrefix(rest, "/*!")):
+			// PostgreSQL comments nest, MySQL comments do not
+			depth, j := 1, i+2
+			for ; j < len(query) && depth > 0; j++ {
+				if strings.HasPrefix(query[j:], "*/") {
+					depth--
+					j++
+				} else if !mysql && strings.HasPrefix(query[j:], "/*") {
+					depth++
+					j++
+				}
+			}
+			if depth > 0 {
+				return "", fmt.Errorf("unterminated comment")
+			}
+			i = j
+		default:
+			stripped.WriteByte(c)
+			i++
+			continue
+		}
+		stripped.WriteByte(' ')
+	}
+	return stripped.String(), nil
+}
+
+// ValidateReadOnly rejects queries that are not a single read statement.
+// Queries also run in a read-only transaction which is rolled back.
+func (q SQLQuery) ValidateReadOnly(engine string) error {
+	query, err := stripSQLLiterals(engine, q.Query)
+	if err != nil {
+		return fmt.Errorf("query %s cannot be parsed: %v", q.Name, err)
+	}
+	query = strings.TrimSpace(query)
+	query = strings.TrimSpace(strings.TrimSuffix(query, ";"))
+	if strings.Contains(query, ";") {
+		return fmt.Errorf("query %s must be a single statement", q.Name)
+	}
+	fields := strings.Fields(strings.ToLower(query))
+	if len(fields) == 0 || !contains(readOnlyStatements, fields[0]) {
+		return fmt.Errorf("query %s must be a SELECT, SHOW or WITH statement", q.Name)
+	}
+	return nil
+}
+
+// SQLRow is a result row as an ordered list of columns, NULLs left out
+type SQLRow []ConfigEntry
+
+// Document returns the row as a configuration document for assertions
+func (r SQLRow) Document() *ConfigDocument {
+	return &ConfigDocument{Format: "sql", Entries: r}
+}
+
+// String formats the row for evidence
+func (r SQLRow) String() string {
+	columns := make([]string, len(r))
+	for i, column := range r {
+		columns[i] = fmt.Sprintf("%s=%s", column.Key, column.Value)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// sqlTunnels maps the tunnel names used as MySQL addresses to tunnels, as
+// the driver only supports dialers registered by network name
+var (
+	sqlTunnels          sync.Map
+	sqlTunnelCount      atomic.Int64
+	registerMySQLTunnel sync.Once
+)
+
+type sqlTunnel struct {
+	client  *ssh.Client
+	timeout time.Duration
+}
+
+// sshDialer implements the PostgreSQL driver dialer interfaces over SSH
+type sshDialer struct {
+	client *ssh.Client
+}
+
+func (d sshDialer) Dial(network string, address string) (net.Conn, error) {
+	return d.DialTimeout(network, address, defaultSQLTimeout)
+}
+
+func (d sshDialer) DialTimeout(network string, address string, timeout time.Duration) (net.Conn, error) {
+	return DialThrough(d.client, address, timeout)
+}
+
+// openSQL opens a database connection through the SSH client. The returned
+// function closes it and releases the tunnel.
+func (c SQLCheck) openSQL(client *ssh.Client, timeout time.Duration) (*sql.DB, func(), error) {
+	host := c.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	switch c.Engine {
+	case "postgres":
+		port := c.Port
+		if port == "" {
+			port = "5432"
+		}
+		database := c.Database
+		if database == "" {
+			database = "postgres"
+		}
+		// The tunnel is already encrypted by SSH
+		dsn := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=disable connect_timeout=%d",
+			pqQuote(host), pqQuote(port), pqQuote(database), pqQuote(c.User), pqQuote(c.Password), pqConnectTimeout(timeout))
+		connector, err := pq.NewConnector(dsn)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to configure postgres connection: %v", err)
+		}
+		connector.Dialer(sshDialer{client})
+		db := sql.OpenDB(connector)
+		return db, func() { db.Close() }, nil
+
+	case "mysql":
+		port := c.Port
+		if port == "" {
+			port = "3306"
+		}
+		registerMySQLTunnel.Do(func() {
+			mysql.RegisterDialContext("ssh", func(ctx context.Context, address string) (net.Conn, error) {
+				name, target, _ := strings.Cut(address, "/")
+				tunnel, ok := sqlTunnels.Load(name)
+				if !ok {
+					return nil, fmt.Errorf("no SSH tunnel %s", name)
+				}
+				return DialThrough(tunnel.(sqlTunnel).client, target, tunnel.(sqlTunnel).timeout)
+			})
+		})
+		name := "tunnel-" + strconv.FormatInt(sqlTunnelCount.Add(1), 10)
+		sqlTunnels.Store(name, sqlTunnel{client, timeout})
+
+		cfg := mysql.NewConfig()
+		cfg.Net = "ssh"
+		cfg.Addr = name + "/" + net.JoinHostPort(host, port)
+		cfg.User = c.User
+		cfg.Passwd = c.Password
+		cfg.DBName = c.Database
+		cfg.Timeout = timeout
+		connector, err := mysql.NewConnector(cfg)
+		if err != nil {
+			sqlTunnels.Delete(name)
+			return nil, nil, fmt.Errorf("failed to configure mysql connection: %v", err)
+		}
+		db := sql.OpenDB(connector)
+		return db, func() {
+			db.Close()
+			sqlTunnels.Delete(name)
+		}, nil
+	}
+	return nil, nil, fmt.Errorf("unknown sql engine %q", c.Engine)
+}
+
+// pqConnectTimeout rounds the timeout up to whole seconds for the
+// connect_timeout of pq, which waits forever at 0
+func pqConnectTimeout(timeout time.Duration) int {
+	return max(1, int(math.Ceil(timeout.Seconds())))
+}
+
+// pqQuote quotes a PostgreSQL connection string value
+func pqQuote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// RunQuery runs a query in a read-only transaction and returns its rows
+func RunQuery(ctx context.Context, db *sql.DB, query string) ([]SQLRow, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin read-only transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run query: %v", err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %v", err)
+	}
+
+	result := []SQLRow{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to read row: %v", err)
+		}
+		row := SQLRow{}
+		for i, value := range values {
+			switch v := value.(type) {
+			case nil:
+				continue
+			case []byte:
+				row = append(row, ConfigEntry{Key: columns[i], Value: string(v)})
+			case time.Time:
+				row = append(row, ConfigEntry{Key: columns[i], Value: v.UTC().Format(time.RFC3339)})
+			default:
+				row = append(row, ConfigEntry{Key: columns[i], Value: fmt.Sprint(v)})
+			}
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %v", err)
+	}
+	return result, nil
+}
+
+// Evaluate returns the failures of the query's row count and assertions
+func (q SQLQuery) Evaluate(rows []SQLRow) ([]string, error) {
+	failures := []string{}
+	if q.MinRows != nil && len(rows) < *q.MinRows {
+		failures = append(failures, fmt.Sprintf("%d rows were returned, fewer than %d", len(rows), *q.MinRows))
+	}
+	if q.MaxRows != nil && len(rows) > *q.MaxRows {
+		failures = append(failures, fmt.Sprintf("%d rows were returned, more than %d", len(rows), *q.MaxRows))
+	}
+
+	for _, assertion := range q.Assertions {
+		passed := 0
+		failed := []string{}
+		for _, row := range rows {
+			ok, reason, err := assertion.Evaluate(row.Document())
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				passed++
+			} else {
+				failed = append(failed, fmt.Sprintf("%s (%s)", reason, row))
+			}
+		}
+		switch q.Match {
+		case "any":
+			if passed == 0 {
+				failures = append(failures, fmt.Sprintf("no row has %s", assertion))
+			}
+		case "", "all":
+			for _, reason := range failed {
+				failures = append(failures, fmt.Sprintf("expected %s, but %s", assertion, reason))
+			}
+		default:
+			return nil, fmt.Errorf("unknown match %q in query %s", q.Match, q.Name)
+		}
+	}
+	return failures, nil
+}
+
+func runSQLCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	if check.SQL == nil || check.SQL.Engine == "" || len(check.SQL.Queries) == 0 {
+		return nil, nil, fmt.Errorf("sql check requires an engine and queries")
+	}
+	settings := *check.SQL
+	for _, query := range settings.Queries {
+		if err := query.ValidateReadOnly(settings.Engine); err != nil {
+			return nil, nil, err
+		}
+	}
+	timeout := defaultSQLTimeout
+	if parsed, err := time.ParseDuration(settings.Timeout); err == nil && parsed > 0 {
+		timeout = parsed
+	}
+
+	db, closeDB, err := settings.openSQL(client, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeDB()
+	db.SetMaxOpenConns(1)
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	props := append([]*Property{
+		{Name: "Engine", Value: settings.Engine},
+		{Name: "Database", Value: settings.Database},
+	}, checkProps(check)...)
+	obs := newObservation(
+		checkTitle(check, "Database Queries"),
+		fmt.Sprintf("Ran %d read-only %s queries on %s through the SSH connection.", len(settings.Queries), settings.Engine, target),
+		props,
+		[]*Evidence{},
+		"All OK.",
+	)
+
+	findings := []*Finding{}
+	for _, query := range settings.Queries {
+		queryProps := append([]*Property{{Name: "Query", Value: query.Name}}, props...)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		rows, err := RunQuery(ctx, db, query.Query)
+		cancel()
+		if err != nil {
+			findings = append(findings, newFinding(obs, "Database Query Failed",
+				fmt.Sprintf("The query %s could not be run on %s: %v.", query.Name, target, err),
+				"Check that the database is running and the check credentials may read the queried data.",
+				queryProps))
+			continue
+		}
+
+		lines := make([]string, len(rows))
+		for i, row := range rows {
+			lines[i] = row.String()
+		}
+		obs.RelevantEvidence = append(obs.RelevantEvidence, &Evidence{
+			Title:       query.Name,
+			Description: truncateLines(strings.Join(lines, "\n"), maxQueryEvidenceRows),
+			Props:       []*Property{{Name: "Rows", Value: strconv.Itoa(len(rows))}},
+		})
+
+		failures, err := query.Evaluate(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(failures) > 0 {
+			findings = append(findings, newFinding(obs, "Database Assertion Failed",
+				fmt.Sprintf("The query %s on %s did not meet its assertions: %s.", query.Name, target, strings.Join(failures, "; ")),
+				"Update the database configuration so the query meets its assertions.",
+				queryProps))
+		}
+	}
+
+	if len(findings) > 0 {
+		obs.Remarks = fmt.Sprintf("%d database problems were found.", len(findings))
+	}
+	return []*Observation{obs}, findings, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLQueryValidateReadOnly(t *testing.T) {
+	tests := []struct {
+		engine string
+		query  string
+		error  string
+	}{
+		{"postgres", "SELECT 1;", ""},
+		{"postgres", "  with t as (select 1) select * from t", ""},
+		{"postgres", "SELECT ';' AS separator", ""},
+		{"postgres", `SELECT "a;b" FROM t WHERE name = 'it''s; fine'`, ""},
+		{"postgres", "SELECT $$;$$, $tag$ ' ; $tag$", ""},
+		{"postgres", "/* leading; comment */ SELECT 1 -- trailing; comment", ""},
+		{"postgres", "SELECT 1 /* nested /* ; */ still ; */", ""},
+		{"postgres", `SELECT E'\'; DROP TABLE t; --'`, ""},
+		{"postgres", `SELECT '\'; DROP TABLE t; --'`, "must be a single statement"},
+		{"postgres", "SELECT $$'$$; DELETE FROM t; SELECT $$'$$", "must be a single statement"},
+		{"postgres", "SELECT 1 --x'\n; DELETE FROM t; --x'", "must be a single statement"},
+		{"postgres", "SELECT 'unterminated", "cannot be parsed"},
+		{"postgres", "SELECT 1 /* unterminated", "cannot be parsed"},
+		{"postgres", "SELECT 1; DELETE FROM t", "must be a single statement"},
+		{"postgres", "EXPLAIN ANALYZE DELETE FROM t", "must be a SELECT"},
+		{"postgres", "DELETE FROM t", "must be a SELECT"},
+		{"postgres", "", "must be a SELECT"},
+		{"mysql", "SHOW VARIABLES LIKE 'ssl%';", ""},
+		{"mysql", "SELECT `a;b`, \"x;y\" # comment; here", ""},
+		{"mysql", `SELECT 'a\'; DELETE FROM t; -- '`, ""},
+		{"mysql", `SELECT '\''; DELETE FROM t; SELECT '`, "cannot be parsed"},
+		{"mysql", "SELECT 1--1; DELETE FROM t", "must be a single statement"},
+		{"mysql", "SELECT 1 /*! ; DELETE FROM t */", "must be a single statement"},
+		{"mysql", "SELECT 1 /* ; */", ""},
+	}
+	for _, test := range tests {
+		err := SQLQuery{Name: "q", Query: test.query}.ValidateReadOnly(test.engine)
+		if test.error == "" && err != nil {
+			t.Errorf("%s %q: expected no error, got %v", test.engine, test.query, err)
+		}
+		if test.error != "" && (err == nil || !strings.Contains(err.Error(), test.error)) {
+			t.Errorf("%s %q: expected %q, got %v", test.engine, test.query, test.error, err)
+		}
+	}
+}
+
+func TestSQLQueryEvaluate(t *testing.T) {
+	rows := []SQLRow{
+		{{Key: "rolname", Value: "postgres"}, {Key: "rolsuper", Value: "true"}},
+		{{Key: "rolname", Value: "backup"}, {Key: "rolsuper", Value: "true"}},
+	}
+	one, three := 1, 3
+	tests := []struct {
+		name  string
+		query SQLQuery
+		want  []string
+		error string
+	}{
+		{"row bounds", SQLQuery{MinRows: &three, MaxRows: &one}, []string{"2 rows were returned, fewer than 3", "2 rows were returned, more than 1"}, ""},
+		{"all rows", SQLQuery{Assertions: []ConfigAssertion{{Key: "rolname", Value: "postgres"}}}, []string{`expected rolname eq postgres, but the value is "backup" (rolname=backup, rolsuper=true)`}, ""},
+		{"any row", SQLQuery{Match: "any", Assertions: []ConfigAssertion{{Key: "rolname", Value: "postgres"}}}, []string{}, ""},
+		{"no row", SQLQuery{Match: "any", Assertions: []ConfigAssertion{{Key: "rolname", Value: "admin"}}}, []string{`no row has rolname eq admin`}, ""},
+		{"null column", SQLQuery{Assertions: []ConfigAssertion{{Key: "rolvaliduntil", Op: "absent"}}}, []string{}, ""},
+		{"unknown match", SQLQuery{Name: "q", Match: "some", Assertions: []ConfigAssertion{{Key: "rolname", Value: "postgres"}}}, nil, "unknown match"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			failures, err := test.query.Evaluate(rows)
+			if test.error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.error) {
+					t.Errorf("expected %q, got %v", test.error, err)
+				}
+				return
+			}
+			if err != nil || strings.Join(failures, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("expected %q, got %q %v", test.want, failures, err)
+			}
+		})
+	}
+}
+
+func TestPQConnectTimeout(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		want    int
+	}{
+		{0, 1},
+		{500 * time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{30 * time.Second, 30},
+	}
+	for _, test := range tests {
+		if got := pqConnectTimeout(test.timeout); got != test.want {
+			t.Errorf("%s: expected %d, got %d", test.timeout, test.want, got)
+		}
+	}
+}
+
+func TestTruncateLines(t *testing.T) {
+	tests := []struct {
+		text string
+		max  int
+		want string
+	}{
+		{"a\nb\n", 2, "a\nb\n"},
+		{"a\nb\nc\n", 2, "a\nb\n... 1 more lines\n"},
+		{"a\nb\nc", 1, "a\n... 2 more lines\n"},
+	}
+	for _, test := range tests {
+		if got := truncateLines(test.text, test.max); got != test.want {
+			t.Errorf("%q: expected %q, got %q", test.text, test.want, got)
+		}
+	}
+}
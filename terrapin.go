@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// strictKexServer is offered by servers implementing the strict key
+	// exchange countermeasure to the Terrapin attack
+	strictKexServer = "kex-strict-s-v00@openssh.com"
+	strictKexClient = "kex-strict-c-v00@openssh.com"
+
+	chaCha20Poly1305 = "chacha20-poly1305@openssh.com"
+)
+
+// openSSHClientOffer is the default offer of an OpenSSH 9 client, against
+// which the algorithms a typical client negotiates are reported
+var openSSHClientOffer = &KexInit{
+	KexAlgorithms: []string{
+		"sntrup761x25519-sha512@openssh.com", "curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group-exchange-sha256", "diffie-hellman-group16-sha512",
+		"diffie-hellman-group18-sha512", "diffie-hellman-group14-sha256",
+		"ext-info-c", strictKexClient,
+	},
+	HostKeyAlgorithms: []string{
+		"ssh-ed25519", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521",
+		"rsa-sha2-512", "rsa-sha2-256",
+	},
+	CiphersClientServer: openSSHClientCiphers,
+	CiphersServerClient: openSSHClientCiphers,
+	MACsClientServer:    openSSHClientMACs,
+	MACsServerClient:    openSSHClientMACs,
+}
+
+var (
+	openSSHClientCiphers = []string{
+		"chacha20-poly1305@openssh.com", "aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+	}
+	openSSHClientMACs = []string{
+		"umac-64-etm@openssh.com", "umac-128-etm@openssh.com", "hmac-sha2-256-etm@openssh.com",
+		"hmac-sha2-512-etm@openssh.com", "hmac-sha1-etm@openssh.com", "umac-64@openssh.com",
+		"umac-128@openssh.com", "hmac-sha2-256", "hmac-sha2-512", "hmac-sha1",
+	}
+)
+
+// TerrapinAssessment records the parts of a server's algorithm offer which
+// make it susceptible to the Terrapin prefix truncation attack (CVE-2023-48795)
+type TerrapinAssessment struct {
+	StrictKex   bool
+	ChaCha20    bool
+	CBCCiphers  []string
+	EtMMACs     []string
+	Susceptible bool
+}
+
+// AssessTerrapin decides whether a server is susceptible to Terrapin. Without
+// strict key exchange, ChaCha20-Poly1305 and CBC ciphers combined with
+// encrypt-then-MAC modes allow sequence numbers to be manipulated.
+func AssessTerrapin(kexInit *KexInit) TerrapinAssessment {
+	assessment := TerrapinAssessment{
+		StrictKex: contains(kexInit.KexAlgorithms, strictKexServer),
+		ChaCha20:  contains(kexInit.CiphersClientServer, chaCha20Poly1305) || contains(kexInit.CiphersServerClient, chaCha20Poly1305),
+	}
+	for _, cipher := range union(kexInit.CiphersClientServer, kexInit.CiphersServerClient) {
+		if strings.HasSuffix(cipher, "-cbc") || strings.HasSuffix(cipher, "-cbc@openssh.com") || cipher == "rijndael-cbc@lysator.liu.se" {
+			assessment.CBCCiphers = append(assessment.CBCCiphers, cipher)
+		}
+	}
+	for _, mac := range union(kexInit.MACsClientServer, kexInit.MACsServerClient) {
+		if strings.HasSuffix(mac, "-etm@openssh.com") {
+			assessment.EtMMACs = append(assessment.EtMMACs, mac)
+		}
+	}
+	cbcEtM := len(assessment.CBCCiphers) > 0 && len(assessment.EtMMACs) > 0
+	assessment.Susceptible = !assessment.StrictKex && (assessment.ChaCha20 || cbcEtM)
+	return assessment
+}
+
+func runTerrapinCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	address := net.JoinHostPort(config.Host, config.Port)
+	banner, kexInit, err := ProbeKexInit(address, config.ConnectTimeout())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to probe key exchange: %v", err)
+	}
+	assessment := AssessTerrapin(kexInit)
+	negotiated := Negotiate(openSSHClientOffer, kexInit)
+
+	props := append([]*Property{
+		{Name: "Banner", Value: banner},
+		{Name: "StrictKex", Value: fmt.Sprintf("%t", assessment.StrictKex)},
+		{Name: "ChaCha20Poly1305", Value: fmt.Sprintf("%t", assessment.ChaCha20)},
+		{Name: "CBCCiphers", Value: strings.Join(assessment.CBCCiphers, ",")},
+		{Name: "EtMMACs", Value: strings.Join(assessment.EtMMACs, ",")},
+		{Name: "NegotiatedCipher", Value: negotiated.CipherClientServer},
+		{Name: "NegotiatedMAC", Value: negotiated.MACClientServer},
+		{Name: "NegotiatedStrictKex", Value: fmt.Sprintf("%t", negotiated.StrictKex)},
+	}, checkProps(check)...)
+	evidence := []*Evidence{
+		{
+			Title:       "Key exchange algorithms",
+			Description: strings.Join(kexInit.KexAlgorithms, ","),
+		},
+		{
+			Title:       "Ciphers",
+			Description: strings.Join(union(kexInit.CiphersClientServer, kexInit.CiphersServerClient), ","),
+		},
+		{
+			Title:       "MACs",
+			Description: strings.Join(union(kexInit.MACsClientServer, kexInit.MACsServerClient), ","),
+		},
+		{
+			Title: "Negotiated with an OpenSSH client",
+			Description: fmt.Sprintf("kex=%s hostkey=%s cipher c2s=%s s2c=%s mac c2s=%s s2c=%s strict kex=%t",
+				negotiated.Kex, negotiated.HostKey,
+				negotiated.CipherClientServer, negotiated.CipherServerClient,
+				negotiated.MACClientServer, negotiated.MACServerClient,
+				negotiated.StrictKex),
+		},
+	}
+
+	if !assessment.Susceptible {
+		remarks := "All OK."
+		if assessment.StrictKex {
+			remarks = "The server supports strict key exchange."
+		}
+		obs := newObservation(
+			checkTitle(check, "SSH Server Not Susceptible To Terrapin"),
+			fmt.Sprintf("The SSH server at %s does not offer a configuration susceptible to the Terrapin attack.", address),
+			props,
+			evidence,
+			remarks,
+		)
+		return []*Observation{obs}, nil, nil
+	}
+
+	modes := []string{}
+	if assessment.ChaCha20 {
+		modes = append(modes, chaCha20Poly1305)
+	}
+	if len(assessment.CBCCiphers) > 0 && len(assessment.EtMMACs) > 0 {
+		modes = append(modes, "CBC ciphers with encrypt-then-MAC")
+	}
+	obs := newObservation(
+		checkTitle(check, "SSH Server Susceptible To Terrapin"),
+		fmt.Sprintf("The SSH server at %s offers %s without strict key exchange.", address, strings.Join(modes, " and ")),
+		props,
+		evidence,
+		"The server should support strict key exchange or stop offering the affected modes.",
+	)
+	fndng := newFinding(
+		obs,
+		checkTitle(check, "CVE-2023-48795: Terrapin prefix truncation attack"),
+		fmt.Sprintf("The SSH server at %s does not support strict key exchange and offers %s, which allows an attacker to truncate the secure channel handshake. An OpenSSH client negotiates the cipher %s with the MAC %s.", address, strings.Join(modes, " and "), negotiated.CipherClientServer, negotiated.MACClientServer),
+		"Upgrade the SSH server to a version supporting strict key exchange, or disable chacha20-poly1305@openssh.com and encrypt-then-MAC algorithms with CBC ciphers.",
+		append([]*Property{{Name: "CVE", Value: "CVE-2023-48795"}}, props...),
+	)
+	return []*Observation{obs}, []*Finding{fndng}, nil
+}
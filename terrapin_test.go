@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// kexInitPayload encodes the ten name-lists of a KEXINIT message
+func kexInitPayload(lists ...string) []byte {
+	payload := append([]byte{msgKexInit}, make([]byte, 16)...)
+	for _, list := range lists {
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(list)))
+		payload = append(payload, list...)
+	}
+	return append(payload, 0, 0, 0, 0, 0)
+}
+
+func TestParseKexInit(t *testing.T) {
+	payload := kexInitPayload(
+		"curve25519-sha256,kex-strict-s-v00@openssh.com", "ssh-ed25519",
+		"aes128-ctr", "aes256-ctr", "hmac-sha2-256", "hmac-sha2-512",
+		"none", "none,zlib@openssh.com", "", "",
+	)
+	kexInit, err := ParseKexInit(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(kexInit.KexAlgorithms, []string{"curve25519-sha256", "kex-strict-s-v00@openssh.com"}) ||
+		!slices.Equal(kexInit.CiphersServerClient, []string{"aes256-ctr"}) ||
+		!slices.Equal(kexInit.CompressionServerClient, []string{"none", "zlib@openssh.com"}) {
+		t.Errorf("unexpected lists %+v", kexInit)
+	}
+
+	for _, truncated := range [][]byte{payload[:10], payload[:40], payload[:len(payload)-5]} {
+		if _, err := ParseKexInit(truncated); err == nil {
+			t.Errorf("expected %d bytes to be rejected", len(truncated))
+		}
+	}
+}
+
+func TestAssessTerrapin(t *testing.T) {
+	tests := []struct {
+		name        string
+		kex         []string
+		ciphers     []string
+		macs        []string
+		susceptible bool
+	}{
+		{"strict kex", []string{"curve25519-sha256", strictKexServer}, []string{chaCha20Poly1305, "aes128-cbc"}, []string{"hmac-sha2-256-etm@openssh.com"}, false},
+		{"chacha20", []string{"curve25519-sha256"}, []string{chaCha20Poly1305, "aes128-ctr"}, []string{"hmac-sha2-256"}, true},
+		{"cbc with etm", []string{"curve25519-sha256"}, []string{"aes128-ctr", "aes256-cbc"}, []string{"hmac-sha2-512-etm@openssh.com"}, true},
+		{"cbc without etm", []string{"curve25519-sha256"}, []string{"aes256-cbc"}, []string{"hmac-sha2-512"}, false},
+		{"etm without cbc", []string{"curve25519-sha256"}, []string{"aes256-gcm@openssh.com"}, []string{"hmac-sha2-512-etm@openssh.com"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assessment := AssessTerrapin(&KexInit{
+				KexAlgorithms:       test.kex,
+				CiphersClientServer: test.ciphers,
+				CiphersServerClient: test.ciphers,
+				MACsClientServer:    test.macs,
+				MACsServerClient:    test.macs,
+			})
+			if assessment.Susceptible != test.susceptible {
+				t.Errorf("expected susceptible %t, got %+v", test.susceptible, assessment)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  KexInit
+		cipher  string
+		mac     string
+		strict  bool
+		kexAlgo string
+	}{
+		{
+			name:    "aead cipher",
+			server:  KexInit{KexAlgorithms: []string{"diffie-hellman-group14-sha256", "curve25519-sha256", strictKexServer}, CiphersClientServer: []string{"aes256-ctr", chaCha20Poly1305}, MACsClientServer: []string{"hmac-sha2-256"}},
+			cipher:  chaCha20Poly1305,
+			mac:     "<implicit>",
+			strict:  true,
+			kexAlgo: "curve25519-sha256",
+		},
+		{
+			name:    "etm mac",
+			server:  KexInit{KexAlgorithms: []string{"diffie-hellman-group14-sha256"}, CiphersClientServer: []string{"aes256-ctr"}, MACsClientServer: []string{"hmac-sha2-256", "hmac-sha2-256-etm@openssh.com"}},
+			cipher:  "aes256-ctr",
+			mac:     "hmac-sha2-256-etm@openssh.com",
+			kexAlgo: "diffie-hellman-group14-sha256",
+		},
+		{
+			name:    "nothing in common",
+			server:  KexInit{KexAlgorithms: []string{"diffie-hellman-group1-sha1"}, CiphersClientServer: []string{"3des-cbc"}, MACsClientServer: []string{"hmac-md5"}},
+			cipher:  "<none in common>",
+			mac:     "<none in common>",
+			kexAlgo: "<none in common>",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := Negotiate(openSSHClientOffer, &test.server)
+			if result.Kex != test.kexAlgo || result.CipherClientServer != test.cipher || result.MACClientServer != test.mac || result.StrictKex != test.strict {
+				t.Errorf("unexpected negotiation %+v", result)
+			}
+		})
+	}
+}
+
+func TestTerrapinCheckProbesServer(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+	check := Check{Id: "terrapin", Type: "terrapin"}
+	observations, findings, err := runTerrapinCheck(nil, server.SSHConfig(), check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// golang.org/x/crypto/ssh servers implement strict key exchange
+	if len(findings) != 0 || len(observations) != 1 {
+		t.Fatalf("expected the server not to be susceptible, got %d findings", len(findings))
+	}
+	negotiated := false
+	for _, evidence := range observations[0].RelevantEvidence {
+		if evidence.Title == "Negotiated with an OpenSSH client" && strings.Contains(evidence.Description, "strict kex=true") {
+			negotiated = true
+		}
+	}
+	if !negotiated {
+		t.Errorf("expected the negotiated algorithms as evidence, got %v", observations[0].RelevantEvidence)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Faults are injected by the test server into a connection
+type Faults struct {
+	// HandshakeStall delays the server version, stalling the handshake
+	HandshakeStall time.Duration
+
+	// Garbage sends random bytes instead of an SSH version
+	Garbage bool
+
+	// Latency delays every write to the client
+	Latency time.Duration
+
+	// ResetOnExec resets the TCP connection when a command is requested
+	ResetOnExec bool
+
+	// TruncateOutput closes the channel after that many bytes of output,
+	// without an exit status
+	TruncateOutput int
+
+	// ExitDelay holds back the exit status once the output is sent
+	ExitDelay time.Duration
+}
+
+// commandHandler returns the output and exit code of a command
+type commandHandler func(command string) (string, int)
+
+// echoHandler succeeds for every command, echoing it
+func echoHandler(command string) (string, int) {
+	return command + "\n", 0
+}
+
+// testServer is an SSH server for tests which runs commands through a
+// handler and injects faults on schedule: the nth connection gets the nth
+// Faults of the schedule, the last one repeating
+type testServer struct {
+	t        testing.TB
+	listener net.Listener
+	config   *ssh.ServerConfig
+	handler  commandHandler
+	schedule []Faults
+	done     chan struct{}
+
+	mu    sync.Mutex
+	conns int
+	execs []string
+}
+
+func newTestServer(t testing.TB, handler commandHandler, schedule ...Faults) *testServer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "audit" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("access denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedule) == 0 {
+		schedule = []Faults{{}}
+	}
+	s := &testServer{
+		t:        t,
+		listener: listener,
+		config:   config,
+		handler:  handler,
+		schedule: schedule,
+		done:     make(chan struct{}),
+	}
+	t.Cleanup(func() {
+		close(s.done)
+		listener.Close()
+	})
+	go s.serve()
+	return s
+}
+
+// SSHConfig returns a configuration targeting the server
+func (s *testServer) SSHConfig() SSHConfig {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return SSHConfig{
+		Username: "audit",
+		Password: "secret",
+		Host:     host,
+		Port:     port,
+		Timeout:  "1s",
+	}
+}
+
+// Connections returns how many connections the server accepted
+func (s *testServer) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// Execs returns the commands requested so far
+func (s *testServer) Execs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.execs...)
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		faults := s.schedule[min(s.conns, len(s.schedule)-1)]
+		s.conns++
+		s.mu.Unlock()
+		go s.handle(&faultConn{Conn: conn, faults: faults}, faults)
+	}
+}
+
+// sleep waits for the duration unless the server is shut down first
+func (s *testServer) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s *testServer) handle(conn *faultConn, faults Faults) {
+	defer conn.Close()
+	if faults.HandshakeStall > 0 && !s.sleep(faults.HandshakeStall) {
+		return
+	}
+	if faults.Garbage {
+		garbage := make([]byte, 1024)
+		rand.Read(garbage)
+		conn.Write(garbage)
+		s.sleep(time.Second)
+		return
+	}
+
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go s.session(conn, channel, requests, faults)
+	}
+}
+
+func (s *testServer) session(conn *faultConn, channel ssh.Channel, requests <-chan *ssh.Request, faults Faults) {
+	defer channel.Close()
+	for request := range requests {
+		if request.Type != "exec" || len(request.Payload) < 4 {
+			request.Reply(false, nil)
+			continue
+		}
+		command := string(request.Payload[4:])
+		s.mu.Lock()
+		s.execs = append(s.execs, command)
+		s.mu.Unlock()
+		if faults.ResetOnExec {
+			conn.Reset()
+			return
+		}
+		request.Reply(true, nil)
+
+		output, exit_code := s.handler(command)
+		if faults.TruncateOutput > 0 && len(output) > faults.TruncateOutput {
+			channel.Write([]byte(output[:faults.TruncateOutput]))
+			return
+		}
+		channel.Write([]byte(output))
+		if faults.ExitDelay > 0 && !s.sleep(faults.ExitDelay) {
+			return
+		}
+		status := binary.BigEndian.AppendUint32(nil, uint32(exit_code))
+		channel.SendRequest("exit-status", false, status)
+		return
+	}
+}
+
+// faultConn is the server side of a connection, delaying writes and able to
+// reset the connection
+type faultConn struct {
+	net.Conn
+	faults Faults
+}
+
+func (c *faultConn) Write(p []byte) (int, error) {
+	if c.faults.Latency > 0 {
+		time.Sleep(c.faults.Latency)
+	}
+	return c.Conn.Write(p)
+}
+
+// Reset closes the connection with a TCP reset rather than a FIN
+func (c *faultConn) Reset() {
+	if tcp, ok := c.Conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	c.Conn.Close()
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	msgDisconnect = 1
+	msgNewKeys    = 21
+	maxVersionLen = 255
+)
+
+// TraceConfig enables a protocol trace per host for diagnosing connection
+// problems. Passwords are never written; commands and their output only up
+// to PayloadLimit bytes, and only their length when it is zero. Commands
+// whose output may hold secrets are always traced by length only.
+type TraceConfig struct {
+	Directory    string `json:"directory" yaml:"directory"`
+	PayloadLimit int    `json:"payload_limit,omitempty" yaml:"payload_limit,omitempty"`
+}
+
+// Tracer writes the trace of a connection. A nil Tracer traces nothing.
+type Tracer struct {
+	id       uint64
+	limit    int
+	channels atomic.Uint64
+
+	mu   sync.Mutex
+	file *os.File
+	kex  map[string]*KexInit
+}
+
+var (
+	// tracers holds the Tracer of each traced connection
+	tracers sync.Map
+
+	traceConnections  atomic.Uint64
+	traceFileUnsafeRe = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+// OpenTracer appends to the trace file of the target, returning nil when
+// tracing is not configured
+func OpenTracer(config SSHConfig) (*Tracer, error) {
+	if config.Trace == nil || config.Trace.Directory == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(config.Trace.Directory, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create trace directory: %v", err)
+	}
+	name := traceFileUnsafeRe.ReplaceAllString(config.Host, "_") + "_" + traceFileUnsafeRe.ReplaceAllString(config.Port, "_") + ".trace"
+	file, err := os.OpenFile(filepath.Join(config.Trace.Directory, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %v", err)
+	}
+	return &Tracer{
+		id:    traceConnections.Add(1),
+		limit: max(config.Trace.PayloadLimit, 0),
+		file:  file,
+		kex:   map[string]*KexInit{},
+	}, nil
+}
+
+// tracerFor returns the Tracer of a connection, nil if it is not traced
+func tracerFor(client *ssh.Client) *Tracer {
+	if tracer, ok := tracers.Load(client); ok {
+		return tracer.(*Tracer)
+	}
+	return nil
+}
+
+// attach traces the connection until the client is closed
+func (t *Tracer) attach(client *ssh.Client) {
+	if t == nil {
+		return
+	}
+	tracers.Store(client, t)
+	go func() {
+		err := client.Wait()
+		t.Printf("connection closed: %v", err)
+		tracers.Delete(client)
+		t.Close()
+	}()
+}
+
+// Printf writes a line to the trace
+func (t *Tracer) Printf(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil {
+		return
+	}
+	fmt.Fprintf(t.file, "%s [conn %d] %s\n", time.Now().Format(time.RFC3339Nano), t.id, fmt.Sprintf(format, args...))
+}
+
+// Payload describes command or output data within the payload limit
+func (t *Tracer) Payload(data string) string {
+	if t == nil || t.limit == 0 {
+		return payloadLength(data)
+	}
+	if len(data) > t.limit {
+		return fmt.Sprintf("%q... <%d bytes>", data[:t.limit], len(data))
+	}
+	return fmt.Sprintf("%q", data)
+}
+
+// payloadLength describes data by its length only
+func payloadLength(data string) string {
+	return fmt.Sprintf("<%d bytes>", len(data))
+}
+
+// Channel numbers the channels opened on the connection
+func (t *Tracer) Channel() uint64 {
+	if t == nil {
+		return 0
+	}
+	return t.channels.Add(1)
+}
+
+// Close closes the trace file
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// Wrap returns the connection tracing the unencrypted part of the
+// handshake: the versions and the key exchange messages in both directions
+func (t *Tracer) Wrap(conn net.Conn) net.Conn {
+	if t == nil {
+		return conn
+	}
+	return &traceConn{
+		Conn: conn,
+		in:   &packetSniffer{tracer: t, side: "server"},
+		out:  &packetSniffer{tracer: t, side: "client"},
+	}
+}
+
+// Auth returns the password authentication method, tracing its attempts
+func (t *Tracer) Auth(user string, password string) ssh.AuthMethod {
+	if t == nil {
+		return ssh.Password(password)
+	}
+	return ssh.PasswordCallback(func() (string, error) {
+		t.Printf("auth: trying password for user %s", user)
+		return password, nil
+	})
+}
+
+// packet traces an unencrypted packet sent by the side
+func (t *Tracer) packet(side string, payload []byte) {
+	switch payload[0] {
+	case msgKexInit:
+		kex, err := ParseKexInit(payload)
+		if err != nil {
+			t.Printf("%s KEXINIT: %v", side, err)
+			return
+		}
+		t.Printf("%s KEXINIT kex=%s hostkey=%s", side, strings.Join(kex.KexAlgorithms, ","), strings.Join(kex.HostKeyAlgorithms, ","))
+		t.Printf("%s KEXINIT ciphers c2s=%s s2c=%s", side, strings.Join(kex.CiphersClientServer, ","), strings.Join(kex.CiphersServerClient, ","))
+		t.Printf("%s KEXINIT macs c2s=%s s2c=%s", side, strings.Join(kex.MACsClientServer, ","), strings.Join(kex.MACsServerClient, ","))
+		t.Printf("%s KEXINIT compression c2s=%s s2c=%s", side, strings.Join(kex.CompressionClientServer, ","), strings.Join(kex.CompressionServerClient, ","))
+		t.mu.Lock()
+		t.kex[side] = kex
+		client, server := t.kex["client"], t.kex["server"]
+		t.mu.Unlock()
+		if client != nil && server != nil {
+			t.Printf("negotiated kex=%s hostkey=%s cipher c2s=%s s2c=%s mac c2s=%s s2c=%s",
+				negotiated(client.KexAlgorithms, server.KexAlgorithms),
+				negotiated(client.HostKeyAlgorithms, server.HostKeyAlgorithms),
+				negotiated(client.CiphersClientServer, server.CiphersClientServer),
+				negotiated(client.CiphersServerClient, server.CiphersServerClient),
+				negotiated(client.MACsClientServer, server.MACsClientServer),
+				negotiated(client.MACsServerClient, server.MACsServerClient),
+			)
+		}
+	case msgNewKeys:
+		t.Printf("%s NEWKEYS, further packets are encrypted", side)
+	case msgDisconnect:
+		if len(payload) < 9 {
+			t.Printf("%s DISCONNECT", side)
+			return
+		}
+		reason := binary.BigEndian.Uint32(payload[1:])
+		length := binary.BigEndian.Uint32(payload[5:])
+		description := payload[9:]
+		if uint32(len(description)) > length {
+			description = description[:length]
+		}
+		t.Printf("%s DISCONNECT reason %d: %q", side, reason, truncate(string(description), maxVersionLen))
+	default:
+		t.Printf("%s message %d, %d bytes", side, payload[0], len(payload))
+	}
+}
+
+// traceConn feeds the bytes read and written to the sniffers
+type traceConn struct {
+	net.Conn
+	in  *packetSniffer
+	out *packetSniffer
+}
+
+func (c *traceConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.in.feed(p[:n])
+	return n, err
+}
+
+func (c *traceConn) Write(p []byte) (int, error) {
+	c.out.feed(p)
+	return c.Conn.Write(p)
+}
+
+// packetSniffer parses the stream of one side up to its NEWKEYS message,
+// after which the packets are encrypted
+type packetSniffer struct {
+	tracer    *Tracer
+	side      string
+	buf       []byte
+	versioned bool
+	done      bool
+}
+
+func (s *packetSniffer) feed(data []byte) {
+	if s.done {
+		return
+	}
+	s.buf = append(s.buf, data...)
+	for !s.done {
+		if !s.versioned {
+			i := bytes.IndexByte(s.buf, '\n')
+			if i < 0 {
+				if len(s.buf) > maxVersionLen {
+					s.stop("no version line")
+				}
+				return
+			}
+			line := strings.TrimRight(string(s.buf[:i]), "\r")
+			s.buf = s.buf[i+1:]
+			if strings.HasPrefix(line, "SSH-") {
+				s.versioned = true
+				s.tracer.Printf("%s version %q", s.side, truncate(line, maxVersionLen))
+			} else {
+				s.tracer.Printf("%s line before its version, %d bytes", s.side, len(line))
+			}
+			continue
+		}
+
+		if len(s.buf) < 5 {
+			return
+		}
+		length := binary.BigEndian.Uint32(s.buf)
+		padding := uint32(s.buf[4])
+		if length < 2 || length > maxPacketLength || padding >= length-1 {
+			s.stop(fmt.Sprintf("unexpected packet length %d", length))
+			return
+		}
+		if uint32(len(s.buf)) < 4+length {
+			return
+		}
+		payload := s.buf[5 : 4+length-padding]
+		s.tracer.packet(s.side, payload)
+		if payload[0] == msgNewKeys {
+			s.done = true
+			s.buf = nil
+			return
+		}
+		s.buf = s.buf[4+length:]
+	}
+}
+
+// stop gives up tracing the packets of the side
+func (s *packetSniffer) stop(reason string) {
+	s.tracer.Printf("%s packets no longer traced: %s", s.side, reason)
+	s.done = true
+	s.buf = nil
+}
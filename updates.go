@@ -0,0 +1,399 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// pendingUpdatesScript queries the package manager from its local metadata,
+// without refreshing it, and collects the reboot-required markers and kernel
+// versions
+const pendingUpdatesScript = `
+printf '==>now %s\n' "$(date +%s)"
+printf '==>boot %s\n' "$(awk '/^btime/{print $2}' /proc/stat 2>/dev/null)"
+if command -v apt-get >/dev/null 2>&1; then
+  printf '==>manager apt\n'
+  printf '==>refreshed %s\n' "$(stat -c %Y /var/lib/apt/periodic/update-success-stamp /var/lib/apt/lists 2>/dev/null | sort -n | tail -1)"
+  printf '==>updates\n'
+  apt-get -s -o Debug::NoLocking=1 upgrade 2>/dev/null | grep '^Inst '
+elif command -v dnf >/dev/null 2>&1 || command -v yum >/dev/null 2>&1; then
+  pm=$(command -v dnf || command -v yum)
+  printf '==>manager %s\n' "$(basename "$pm")"
+  printf '==>refreshed %s\n' "$(stat -c %Y /var/cache/dnf/*/repodata/repomd.xml /var/cache/yum/*/*/*/repomd.xml 2>/dev/null | sort -n | tail -1)"
+  printf '==>updates\n'
+  "$pm" -q -C check-update 2>/dev/null
+  printf '==>security\n'
+  "$pm" -q -C updateinfo list --security 2>/dev/null
+  printf '==>advisories\n'
+  "$pm" -q -C updateinfo info --security 2>/dev/null | grep -E '^ *(Update ID|Issued|Updated) *:'
+elif command -v zypper >/dev/null 2>&1; then
+  printf '==>manager zypper\n'
+  printf '==>refreshed %s\n' "$(stat -c %Y /var/cache/zypp/raw/*/repodata/repomd.xml 2>/dev/null | sort -n | tail -1)"
+  printf '==>updates\n'
+  zypper -q --no-refresh list-updates 2>/dev/null | grep '^v '
+  printf '==>security\n'
+  zypper -q --no-refresh list-patches --category security 2>/dev/null | grep -E '^[^ ]+ +\|'
+fi
+printf '==>reboot\n'
+[ -f /var/run/reboot-required ] && printf 'marker %s\n' "$(stat -c %Y /var/run/reboot-required)"
+command -v needs-restarting >/dev/null 2>&1 && { needs-restarting -r >/dev/null 2>&1; printf 'needs-restarting %s\n' "$?"; }
+printf 'running %s\n' "$(uname -r)"
+for k in /lib/modules/*; do
+  [ -d "$k" ] && printf 'installed %s %s\n' "$(basename "$k")" "$(stat -c %Y "$k")"
+done
+`
+
+// PendingUpdatesCheck configures the pending updates check. Thresholds which
+// are not set only report counts and ages.
+type PendingUpdatesCheck struct {
+	MaxSecurityUpdates   *int   `json:"max_security_updates,omitempty" yaml:"max_security_updates,omitempty"`
+	MaxUpdates           *int   `json:"max_updates,omitempty" yaml:"max_updates,omitempty"`
+	MaxSecurityUpdateAge string `json:"max_security_update_age,omitempty" yaml:"max_security_update_age,omitempty"`
+	MaxRebootPending     string `json:"max_reboot_pending,omitempty" yaml:"max_reboot_pending,omitempty"`
+	MaxMetadataAge       string `json:"max_metadata_age,omitempty" yaml:"max_metadata_age,omitempty"`
+}
+
+// PendingUpdates is the update and reboot state of a host. Times are those
+// of the remote clock.
+type PendingUpdates struct {
+	Manager         string
+	Now             time.Time
+	Boot            time.Time
+	MetadataRefresh time.Time
+	Updates         []string
+	SecurityUpdates []string
+	// Advisories maps a security update to its advisory, and Issued an
+	// advisory to its issue date, where the package manager publishes them
+	Advisories       map[string]string
+	Issued           map[string]time.Time
+	RebootRequired   bool
+	RebootReason     string
+	RebootMarker     time.Time
+	RunningKernel    string
+	InstalledKernels []string
+}
+
+// ParsePendingUpdates parses the output of pendingUpdatesScript
+func ParsePendingUpdates(output string) PendingUpdates {
+	state := PendingUpdates{Advisories: map[string]string{}, Issued: map[string]time.Time{}}
+	section := ""
+	advisory := ""
+	security := map[string]bool{}
+	installed := map[string]time.Time{}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "==>") {
+			key, value, _ := strings.Cut(strings.TrimPrefix(line, "==>"), " ")
+			switch key {
+			case "now":
+				state.Now = unixTime(value)
+			case "boot":
+				state.Boot = unixTime(value)
+			case "refreshed":
+				state.MetadataRefresh = unixTime(value)
+			case "manager":
+				state.Manager = value
+			}
+			section = key
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch section {
+		case "updates":
+			switch state.Manager {
+			case "apt":
+				// Inst openssl [3.0.2-0ubuntu1.14] (3.0.2-0ubuntu1.15 Ubuntu:22.04/jammy-security [amd64])
+				if len(fields) < 2 {
+					continue
+				}
+				state.Updates = append(state.Updates, fields[1])
+				if strings.Contains(line, "-security") {
+					security[fields[1]] = true
+				}
+			case "dnf", "yum":
+				// openssl.x86_64  1:3.0.7-25.el9  baseos
+				// The packages replaced by an update are listed last, under
+				// "Obsoleting Packages", and are not updates themselves
+				if strings.HasPrefix(line, "Obsoleting Packages") {
+					section = "obsoleting"
+					continue
+				}
+				if len(fields) == 3 && strings.Contains(fields[0], ".") {
+					state.Updates = append(state.Updates, fields[0])
+				}
+			case "zypper":
+				// v | repo | name | current | available | arch
+				columns := strings.Split(line, "|")
+				if len(columns) >= 3 {
+					state.Updates = append(state.Updates, strings.TrimSpace(columns[2]))
+				}
+			}
+		case "security":
+			switch state.Manager {
+			case "dnf", "yum":
+				// RHSA-2024:1234 Important/Sec. openssl-1:3.0.7-27.el9.x86_64
+				if len(fields) >= 3 {
+					security[fields[len(fields)-1]] = true
+					state.Advisories[fields[len(fields)-1]] = fields[0]
+				}
+			case "zypper":
+				columns := strings.Split(line, "|")
+				if len(columns) >= 2 {
+					security[strings.TrimSpace(columns[1])] = true
+				}
+			}
+		case "advisories":
+			// Update ID: RHSA-2024:1234
+			//    Issued: 2024-07-09 00:00:00
+			key, value, ok := strings.Cut(line, ":")
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			if !ok {
+				continue
+			}
+			switch key {
+			case "Update ID":
+				advisory = value
+			case "Issued", "Updated":
+				// Issued is preferred where both are given
+				if _, seen := state.Issued[advisory]; advisory != "" && (key == "Issued" || !seen) {
+					if issued, ok := advisoryTime(value); ok {
+						state.Issued[advisory] = issued
+					}
+				}
+			}
+		case "reboot":
+			switch fields[0] {
+			case "marker":
+				state.RebootRequired = true
+				state.RebootReason = "/var/run/reboot-required exists"
+				if len(fields) > 1 {
+					state.RebootMarker = unixTime(fields[1])
+				}
+			case "needs-restarting":
+				if len(fields) > 1 && fields[1] == "1" {
+					state.RebootRequired = true
+					state.RebootReason = "needs-restarting -r reports a reboot is required"
+				}
+			case "running":
+				if len(fields) > 1 {
+					state.RunningKernel = fields[1]
+				}
+			case "installed":
+				if len(fields) > 1 {
+					state.InstalledKernels = append(state.InstalledKernels, fields[1])
+				}
+				if len(fields) > 2 {
+					installed[fields[1]] = unixTime(fields[2])
+				}
+			}
+		}
+	}
+	for update := range security {
+		state.SecurityUpdates = append(state.SecurityUpdates, update)
+	}
+	sort.Strings(state.SecurityUpdates)
+
+	// A newer installed kernel than the running one needs a reboot to apply
+	if newest := state.NewestKernel(); !state.RebootRequired && newest != "" && state.RunningKernel != "" && CompareVersions(newest, state.RunningKernel) > 0 {
+		state.RebootRequired = true
+		state.RebootReason = fmt.Sprintf("kernel %s is installed but %s is running", newest, state.RunningKernel)
+		state.RebootMarker = installed[newest]
+	}
+	return state
+}
+
+// advisoryTime parses the issue date of an advisory, e.g. "2024-07-09" or
+// "2024-07-09 10:00:00"
+func advisoryTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.DateTime, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// SecurityUpdateAge returns how long ago the advisory of a security update
+// was issued, or false when its issue date is unknown
+func (s PendingUpdates) SecurityUpdateAge(update string) (time.Duration, bool) {
+	issued, ok := s.Issued[s.Advisories[update]]
+	if !ok || s.Now.IsZero() {
+		return 0, false
+	}
+	return s.Now.Sub(issued), true
+}
+
+// OldestSecurityUpdate returns the oldest security update with a known
+// issue date and its age
+func (s PendingUpdates) OldestSecurityUpdate() (string, time.Duration, bool) {
+	oldest, age, found := "", time.Duration(0), false
+	for _, update := range s.SecurityUpdates {
+		if a, ok := s.SecurityUpdateAge(update); ok && (!found || a > age) {
+			oldest, age, found = update, a, true
+		}
+	}
+	return oldest, age, found
+}
+
+// NewestKernel returns the highest installed kernel version
+func (s PendingUpdates) NewestKernel() string {
+	newest := ""
+	for _, kernel := range s.InstalledKernels {
+		if newest == "" || CompareVersions(kernel, newest) > 0 {
+			newest = kernel
+		}
+	}
+	return newest
+}
+
+// RebootPendingFor returns how long a reboot has been pending, measured
+// from the reboot marker or newer kernel or, failing that, the last boot
+func (s PendingUpdates) RebootPendingFor() time.Duration {
+	if !s.RebootRequired || s.Now.IsZero() {
+		return 0
+	}
+	since := s.RebootMarker
+	if since.IsZero() {
+		since = s.Boot
+	}
+	if since.IsZero() {
+		return 0
+	}
+	return s.Now.Sub(since)
+}
+
+func unixTime(value string) time.Time {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// formatAge formats the age of a remote timestamp, or "unknown"
+func formatAge(now time.Time, then time.Time) string {
+	if now.IsZero() || then.IsZero() {
+		return "unknown"
+	}
+	return now.Sub(then).Round(time.Second).String()
+}
+
+func runPendingUpdatesCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	settings := PendingUpdatesCheck{}
+	if check.PendingUpdates != nil {
+		settings = *check.PendingUpdates
+	}
+	maxSecurityUpdateAge, err := optionalDuration("max_security_update_age", settings.MaxSecurityUpdateAge)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxRebootPending, err := optionalDuration("max_reboot_pending", settings.MaxRebootPending)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxMetadataAge, err := optionalDuration("max_metadata_age", settings.MaxMetadataAge)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output, _, err := RunSessionCommand(client, pendingUpdatesScript)
+	if err != nil {
+		return nil, nil, err
+	}
+	state := ParsePendingUpdates(output)
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	props := append([]*Property{
+		{Name: "PackageManager", Value: state.Manager},
+		{Name: "PendingUpdates", Value: strconv.Itoa(len(state.Updates))},
+		{Name: "PendingSecurityUpdates", Value: strconv.Itoa(len(state.SecurityUpdates))},
+		{Name: "MetadataAge", Value: formatAge(state.Now, state.MetadataRefresh)},
+		{Name: "RebootRequired", Value: strconv.FormatBool(state.RebootRequired)},
+		{Name: "RunningKernel", Value: state.RunningKernel},
+		{Name: "NewestKernel", Value: state.NewestKernel()},
+		{Name: "Uptime", Value: formatAge(state.Now, state.Boot)},
+	}, checkProps(check)...)
+	oldest, oldestAge, dated := state.OldestSecurityUpdate()
+	if dated {
+		props = append(props, &Property{Name: "OldestSecurityUpdateAge", Value: oldestAge.Round(time.Second).String()})
+	}
+	if state.RebootRequired {
+		props = append(props, &Property{Name: "RebootPendingFor", Value: state.RebootPendingFor().Round(time.Second).String()})
+	}
+
+	evidence := []*Evidence{}
+	if len(state.SecurityUpdates) > 0 {
+		updates := []string{}
+		for _, update := range state.SecurityUpdates {
+			if age, ok := state.SecurityUpdateAge(update); ok {
+				update = fmt.Sprintf("%s (%s, issued %s ago)", update, state.Advisories[update], age.Round(time.Second))
+			}
+			updates = append(updates, update)
+		}
+		evidence = append(evidence, &Evidence{
+			Title:       "Pending security updates",
+			Description: strings.Join(updates, ", "),
+		})
+	}
+	if state.RebootRequired {
+		evidence = append(evidence, &Evidence{
+			Title:       "Reboot required",
+			Description: state.RebootReason,
+		})
+	}
+
+	remarks := "All OK."
+	if state.Manager == "" {
+		remarks = "No supported package manager was found."
+	}
+	obs := newObservation(
+		checkTitle(check, "Pending Updates"),
+		fmt.Sprintf("%s has %d pending updates, %d of them security updates, from package metadata refreshed %s ago. Reboot required: %t.",
+			target, len(state.Updates), len(state.SecurityUpdates), formatAge(state.Now, state.MetadataRefresh), state.RebootRequired),
+		props,
+		evidence,
+		remarks,
+	)
+
+	findings := []*Finding{}
+	addFinding := func(title string, description string, remarks string) {
+		findings = append(findings, newFinding(obs, title, description, remarks, props))
+	}
+	if settings.MaxSecurityUpdates != nil && len(state.SecurityUpdates) > *settings.MaxSecurityUpdates {
+		addFinding("Security Updates Pending",
+			fmt.Sprintf("%s has %d pending security updates, more than the %d allowed.", target, len(state.SecurityUpdates), *settings.MaxSecurityUpdates),
+			"Install the outstanding security updates.")
+	}
+	if settings.MaxUpdates != nil && len(state.Updates) > *settings.MaxUpdates {
+		addFinding("Updates Pending",
+			fmt.Sprintf("%s has %d pending updates, more than the %d allowed.", target, len(state.Updates), *settings.MaxUpdates),
+			"Install the outstanding updates.")
+	}
+	if maxSecurityUpdateAge != nil && dated && oldestAge > *maxSecurityUpdateAge {
+		addFinding("Security Updates Overdue",
+			fmt.Sprintf("%s has had the security update %s (%s) pending for %s, longer than the %s allowed.", target, oldest, state.Advisories[oldest], oldestAge.Round(time.Second), *maxSecurityUpdateAge),
+			"Install the outstanding security updates.")
+	}
+	if maxRebootPending != nil && state.RebootRequired && state.RebootPendingFor() > *maxRebootPending {
+		addFinding("Reboot Pending",
+			fmt.Sprintf("%s has required a reboot for %s (%s).", target, state.RebootPendingFor().Round(time.Second), state.RebootReason),
+			"Reboot the host to apply the installed updates.")
+	}
+	if maxMetadataAge != nil && state.Manager != "" {
+		if state.MetadataRefresh.IsZero() || state.Now.Sub(state.MetadataRefresh) > *maxMetadataAge {
+			addFinding("Package Metadata Out Of Date",
+				fmt.Sprintf("The package metadata on %s was last refreshed %s ago, so pending updates may be under-reported.", target, formatAge(state.Now, state.MetadataRefresh)),
+				"Refresh the package metadata regularly, e.g. with unattended upgrades or dnf-automatic.")
+		}
+	}
+	return []*Observation{obs}, findings, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePendingUpdates(t *testing.T) {
+	tests := []struct {
+		seed     string
+		manager  string
+		updates  []string
+		security []string
+		reboot   string
+		age      time.Duration
+		dated    bool
+	}{
+		{
+			seed:     "pending_updates_apt.txt",
+			manager:  "apt",
+			updates:  []string{"openssl", "libssl3", "tzdata"},
+			security: []string{"libssl3", "openssl"},
+			reboot:   "/var/run/reboot-required exists",
+		},
+		{
+			seed:     "pending_updates_dnf.txt",
+			manager:  "dnf",
+			updates:  []string{"openssl-libs.x86_64", "kernel.x86_64"},
+			security: []string{"openssl-libs-1:3.0.7-27.el9.x86_64"},
+			reboot:   "needs-restarting -r reports a reboot is required",
+			age:      time.Unix(1720627200, 0).Sub(time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)),
+			dated:    true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.seed, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", "seeds", test.seed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := ParsePendingUpdates(string(content))
+			if state.Manager != test.manager {
+				t.Errorf("expected manager %s, got %s", test.manager, state.Manager)
+			}
+			if !slices.Equal(state.Updates, test.updates) {
+				t.Errorf("expected updates %v, got %v", test.updates, state.Updates)
+			}
+			if !slices.Equal(state.SecurityUpdates, test.security) {
+				t.Errorf("expected security updates %v, got %v", test.security, state.SecurityUpdates)
+			}
+			if !state.RebootRequired || state.RebootReason != test.reboot {
+				t.Errorf("expected a reboot because %q, got %t %q", test.reboot, state.RebootRequired, state.RebootReason)
+			}
+			_, age, dated := state.OldestSecurityUpdate()
+			if dated != test.dated || age != test.age {
+				t.Errorf("expected the oldest security update age %s %t, got %s %t", test.age, test.dated, age, dated)
+			}
+		})
+	}
+}
+
+func TestParsePendingUpdatesAdvisoryDates(t *testing.T) {
+	tests := []struct {
+		advisories string
+		issued     time.Time
+		dated      bool
+	}{
+		{"Update ID: RHSA-1\n   Issued : 2024-07-01\n", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), true},
+		{"Update ID: RHSA-1\n  Updated: 2024-07-05 10:00:00\n", time.Date(2024, 7, 5, 10, 0, 0, 0, time.UTC), true},
+		{"Update ID: RHSA-1\n   Issued: 2024-07-01 00:00:00\n  Updated: 2024-07-05 10:00:00\n", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), true},
+		{"Update ID: RHSA-1\n   Issued: yesterday\n", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, test := range tests {
+		output := "==>now 1720627200\n==>manager dnf\n==>security\nRHSA-1 Important/Sec. openssl-3.0.7.x86_64\n==>advisories\n" + test.advisories
+		state := ParsePendingUpdates(output)
+		age, dated := state.SecurityUpdateAge("openssl-3.0.7.x86_64")
+		if dated != test.dated || (dated && age != time.Unix(1720627200, 0).Sub(test.issued)) {
+			t.Errorf("%q: expected issued %s %t, got age %s %t", test.advisories, test.issued, test.dated, age, dated)
+		}
+	}
+}
+
+func TestRebootPendingFor(t *testing.T) {
+	now := time.Unix(1720627200, 0)
+	tests := []struct {
+		state PendingUpdates
+		want  time.Duration
+	}{
+		{PendingUpdates{Now: now, RebootRequired: true, RebootMarker: now.Add(-time.Hour), Boot: now.Add(-48 * time.Hour)}, time.Hour},
+		{PendingUpdates{Now: now, RebootRequired: true, Boot: now.Add(-48 * time.Hour)}, 48 * time.Hour},
+		{PendingUpdates{Now: now, Boot: now.Add(-48 * time.Hour)}, 0},
+		{PendingUpdates{RebootRequired: true, Boot: now}, 0},
+	}
+	for _, test := range tests {
+		if got := test.state.RebootPendingFor(); got != test.want {
+			t.Errorf("%+v: expected %s, got %s", test.state, test.want, got)
+		}
+	}
+}
+
+func TestPendingUpdatesOverdueSecurityUpdates(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "pending_updates_dnf.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := func(command string) (string, int) { return string(content), 0 }
+	tests := []struct {
+		limit   string
+		overdue bool
+	}{
+		{"300h", false},
+		{"168h", true},
+	}
+	for _, test := range tests {
+		check := Check{Id: "updates", Type: "pending_updates", PendingUpdates: &PendingUpdatesCheck{MaxSecurityUpdateAge: test.limit}}
+		observations, findings, err := runCheckAgainst(t, handler, check)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if overdue := len(findings) == 1 && findings[0].Title == "Security Updates Overdue"; overdue != test.overdue || len(findings) > 1 {
+			t.Errorf("%s: expected overdue %t, got %v", test.limit, test.overdue, findings)
+		}
+		if evidence := observations[0].RelevantEvidence[0].Description; !strings.Contains(evidence, "RHSA-2024:4312, issued 256h0m0s ago") {
+			t.Errorf("expected the advisory age as evidence, got %q", evidence)
+		}
+	}
+}
+
+func TestPendingUpdatesInvalidLimits(t *testing.T) {
+	handler := func(command string) (string, int) {
+		t.Errorf("expected the configuration to be rejected before running %q", command)
+		return "", 0
+	}
+	tests := []struct {
+		settings PendingUpdatesCheck
+		name     string
+	}{
+		{PendingUpdatesCheck{MaxSecurityUpdateAge: "7 days"}, "max_security_update_age"},
+		{PendingUpdatesCheck{MaxRebootPending: "1w"}, "max_reboot_pending"},
+		{PendingUpdatesCheck{MaxMetadataAge: "24"}, "max_metadata_age"},
+	}
+	for _, test := range tests {
+		settings := test.settings
+		_, _, err := runCheckAgainst(t, handler, Check{Id: "updates", Type: "pending_updates", PendingUpdates: &settings})
+		if err == nil || !strings.Contains(err.Error(), "invalid "+test.name) {
+			t.Errorf("%+v: expected an invalid %s error, got %v", test.settings, test.name, err)
+		}
+	}
+}
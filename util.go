@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// contains reports whether the list contains the value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// union returns the values of both lists without duplicates, in order
+func union(a []string, b []string) []string {
+	result := []string{}
+	for _, item := range append(append([]string{}, a...), b...) {
+		if !contains(result, item) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// optionalDuration parses a configured limit, returning nil when it is not set
+func optionalDuration(name string, value string) (*time.Duration, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", name, value, err)
+	}
+	return &parsed, nil
+}
+
+// truncate shortens a string to a number of characters
+func truncate(value string, max int) string {
+	runes := []rune(value)
+	if len(runes) <= max {
+		return value
+	}
+	return string(runes[:max-3]) + "..."
+}
+
+// truncateLines limits text such as a diff or query rows to a number of
+// lines, noting how many were left out
+func truncateLines(text string, max int) string {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if len(lines) <= max {
+		return text
+	}
+	return strings.Join(lines[:max], "\n") + fmt.Sprintf("\n... %d more lines\n", len(lines)-max)
+}
+
+// boolPtr returns a pointer to the value, for optional settings
+func boolPtr(value bool) *bool {
+	return &value
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed vulnerabilities.yaml
+var defaultVulnerabilityTable []byte
+
+// ServerVersionCheck configures the server version vulnerability check
+type ServerVersionCheck struct {
+	// Table is the path to a local vulnerability table which replaces the
+	// built-in one, so that it can be updated without rebuilding the plugin.
+	Table string `json:"table,omitempty" yaml:"table,omitempty"`
+}
+
+// VulnerabilityTable lists known vulnerabilities by product and version
+type VulnerabilityTable struct {
+	Vulnerabilities []Vulnerability `json:"vulnerabilities" yaml:"vulnerabilities"`
+}
+
+// Vulnerability describes the upstream versions affected by a CVE and the
+// distribution package revisions known to carry a backported fix
+type Vulnerability struct {
+	Id        string          `json:"id" yaml:"id"`
+	Title     string          `json:"title" yaml:"title"`
+	Product   string          `json:"product" yaml:"product"`
+	Severity  string          `json:"severity,omitempty" yaml:"severity,omitempty"`
+	Affected  []VersionRange  `json:"affected" yaml:"affected"`
+	Backports []BackportedFix `json:"backports,omitempty" yaml:"backports,omitempty"`
+}
+
+// VersionRange is affected from Introduced (inclusive, empty for all earlier
+// versions) up to Fixed (exclusive, empty if unfixed)
+type VersionRange struct {
+	Introduced string `json:"introduced,omitempty" yaml:"introduced,omitempty"`
+	Fixed      string `json:"fixed,omitempty" yaml:"fixed,omitempty"`
+}
+
+// BackportedFix is a distribution revision of an upstream version which
+// includes the fix
+type BackportedFix struct {
+	Distribution string `json:"distribution" yaml:"distribution"`
+	Version      string `json:"version" yaml:"version"`
+	Fixed        string `json:"fixed" yaml:"fixed"`
+}
+
+// ServerVersion is the parsed SSH identification string of a server
+type ServerVersion struct {
+	Banner       string
+	Software     string
+	Product      string
+	Version      string
+	Distribution string
+	Revision     string
+}
+
+var (
+	openSSHSoftwareRe  = regexp.MustCompile(`^OpenSSH_([0-9][0-9A-Za-z.]*)`)
+	dropbearSoftwareRe = regexp.MustCompile(`^dropbear_([0-9][0-9A-Za-z.]*)`)
+	distributionRe     = regexp.MustCompile(`^([A-Za-z]+)-(\S+)`)
+)
+
+// ParseServerVersion parses a banner such as
+// "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6"
+func ParseServerVersion(banner string) (*ServerVersion, error) {
+	banner = strings.TrimRight(banner, "\r\n")
+	if !strings.HasPrefix(banner, "SSH-") {
+		return nil, fmt.Errorf("invalid SSH banner %q", banner)
+	}
+	_, rest, ok := strings.Cut(banner[len("SSH-"):], "-")
+	if !ok || rest == "" {
+		return nil, fmt.Errorf("invalid SSH banner %q", banner)
+	}
+	software, comments, _ := strings.Cut(rest, " ")
+
+	version := &ServerVersion{
+		Banner:   banner,
+		Software: software,
+	}
+	if m := openSSHSoftwareRe.FindStringSubmatch(software); m != nil {
+		version.Product = "openssh"
+		version.Version = m[1]
+	} else if m := dropbearSoftwareRe.FindStringSubmatch(software); m != nil {
+		version.Product = "dropbear"
+		version.Version = m[1]
+	}
+
+	// Distributions append their package revision as a comment, e.g.
+	// OpenSSH_9.2p1 Debian-2+deb12u3
+	if m := distributionRe.FindStringSubmatch(strings.TrimSpace(comments)); m != nil {
+		version.Distribution = m[1]
+		version.Revision = m[2]
+	}
+	return version, nil
+}
+
+// LoadVulnerabilityTable reads a vulnerability table from a local file, or
+// the built-in table if no path is given
+func LoadVulnerabilityTable(path string) (*VulnerabilityTable, error) {
+	data := defaultVulnerabilityTable
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vulnerability table: %v", err)
+		}
+	}
+	var table VulnerabilityTable
+	if err := yaml.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse vulnerability table: %v", err)
+	}
+	return &table, nil
+}
+
+// Match returns the vulnerabilities affecting the server version, and those
+// which would affect it were it not for a distribution backport
+func (t *VulnerabilityTable) Match(version *ServerVersion) ([]Vulnerability, []Vulnerability) {
+	affected := []Vulnerability{}
+	backported := []Vulnerability{}
+	if version.Product == "" {
+		return affected, backported
+	}
+	for _, vuln := range t.Vulnerabilities {
+		if !strings.EqualFold(vuln.Product, version.Product) || !vuln.affects(version.Version) {
+			continue
+		}
+		if vuln.backported(version) {
+			backported = append(backported, vuln)
+		} else {
+			affected = append(affected, vuln)
+		}
+	}
+	return affected, backported
+}
+
+func (v Vulnerability) affects(version string) bool {
+	for _, r := range v.Affected {
+		if r.Introduced != "" && CompareVersions(version, r.Introduced) < 0 {
+			continue
+		}
+		if r.Fixed != "" && CompareVersions(version, r.Fixed) >= 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (v Vulnerability) backported(version *ServerVersion) bool {
+	if version.Distribution == "" {
+		return false
+	}
+	for _, b := range v.Backports {
+		if strings.EqualFold(b.Distribution, version.Distribution) &&
+			CompareVersions(b.Version, version.Version) == 0 &&
+			CompareVersions(version.Revision, b.Fixed) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareVersions compares version strings such as "8.9p1" or "3ubuntu0.10"
+// by splitting them into numeric and non-numeric runs. Numeric runs compare
+// numerically and other runs lexically. It returns -1, 0 or 1.
+func CompareVersions(a string, b string) int {
+	as := splitVersion(a)
+	bs := splitVersion(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.ParseUint(as[i], 10, 64)
+		bn, berr := strconv.ParseUint(bs[i], 10, 64)
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+func splitVersion(version string) []string {
+	parts := []string{}
+	start := 0
+	for i := 1; i <= len(version); i++ {
+		if i == len(version) || isDigit(version[i]) != isDigit(version[i-1]) {
+			parts = append(parts, version[start:i])
+			start = i
+		}
+	}
+	return parts
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func runServerVersionCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	settings := ServerVersionCheck{}
+	if check.ServerVersion != nil {
+		settings = *check.ServerVersion
+	}
+	table, err := LoadVulnerabilityTable(settings.Table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version, err := ParseServerVersion(string(client.ServerVersion()))
+	if err != nil {
+		return nil, nil, err
+	}
+	affected, backported := table.Match(version)
+
+	props := append([]*Property{
+		{Name: "Banner", Value: version.Banner},
+		{Name: "Product", Value: version.Product},
+		{Name: "Version", Value: version.Version},
+	}, checkProps(check)...)
+	if version.Distribution != "" {
+		props = append(props,
+			&Property{Name: "Distribution", Value: version.Distribution},
+			&Property{Name: "Revision", Value: version.Revision},
+		)
+	}
+
+	evidence := []*Evidence{
+		{
+			Title:       "Server version banner",
+			Description: fmt.Sprintf("The server at %s:%s identified itself as %s.", config.Host, config.Port, version.Banner),
+		},
+	}
+	for _, vuln := range backported {
+		evidence = append(evidence, &Evidence{
+			Title:       vuln.Id,
+			Description: fmt.Sprintf("%s %s is affected by %s but %s revision %s includes a backported fix.", version.Product, version.Version, vuln.Id, version.Distribution, version.Revision),
+		})
+	}
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	remarks := "All OK."
+	if version.Product == "" {
+		remarks = fmt.Sprintf("The server software %s is not in the vulnerability table.", version.Software)
+	} else if len(affected) > 0 {
+		remarks = fmt.Sprintf("The server version is affected by %d known vulnerabilities.", len(affected))
+	}
+	obs := newObservation(
+		checkTitle(check, "SSH Server Version"),
+		fmt.Sprintf("The SSH server version of %s was matched against %d known vulnerabilities.", target, len(table.Vulnerabilities)),
+		props,
+		evidence,
+		remarks,
+	)
+
+	findings := []*Finding{}
+	for _, vuln := range affected {
+		findingProps := append([]*Property{
+			{Name: "CVE", Value: vuln.Id},
+			{Name: "Severity", Value: vuln.Severity},
+		}, props...)
+		findings = append(findings, newFinding(
+			obs,
+			fmt.Sprintf("%s: %s", vuln.Id, vuln.Title),
+			fmt.Sprintf("The SSH server %s reports version %s, which is affected by %s (%s).", target, version.Banner, vuln.Id, vuln.Title),
+			fmt.Sprintf("Upgrade %s to a version which fixes %s.", version.Product, vuln.Id),
+			findingProps,
+		))
+	}
+
+	return []*Observation{obs}, findings, nil
+}
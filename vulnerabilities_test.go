@@ -0,0 +1,103 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	tests := []struct {
+		banner string
+		want   ServerVersion
+	}{
+		{"SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.10\r\n", ServerVersion{Software: "OpenSSH_8.9p1", Product: "openssh", Version: "8.9p1", Distribution: "Ubuntu", Revision: "3ubuntu0.10"}},
+		{"SSH-2.0-OpenSSH_9.2p1 Debian-2+deb12u3", ServerVersion{Software: "OpenSSH_9.2p1", Product: "openssh", Version: "9.2p1", Distribution: "Debian", Revision: "2+deb12u3"}},
+		{"SSH-2.0-OpenSSH_7.4", ServerVersion{Software: "OpenSSH_7.4", Product: "openssh", Version: "7.4"}},
+		{"SSH-2.0-dropbear_2022.83", ServerVersion{Software: "dropbear_2022.83", Product: "dropbear", Version: "2022.83"}},
+		{"SSH-1.99-Cisco-1.25", ServerVersion{Software: "Cisco-1.25"}},
+	}
+	for _, test := range tests {
+		t.Run(test.banner, func(t *testing.T) {
+			version, err := ParseServerVersion(test.banner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			version.Banner = ""
+			if *version != test.want {
+				t.Errorf("expected %+v, got %+v", test.want, *version)
+			}
+		})
+	}
+
+	for _, banner := range []string{"", "OpenSSH_8.9", "SSH-2.0", "SSH-2.0-"} {
+		if _, err := ParseServerVersion(banner); err == nil {
+			t.Errorf("expected %q to be rejected", banner)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"8.9p1", "8.9p1", 0},
+		{"8.9p1", "9.8p1", -1},
+		{"9.10p1", "9.8p1", 1},
+		{"8.9p1", "8.9", 1},
+		{"3ubuntu0.10", "3ubuntu0.9", 1},
+		{"2+deb12u2", "2+deb12u3", -1},
+		{"2022.83", "2020.81", 1},
+	}
+	for _, test := range tests {
+		if got := CompareVersions(test.a, test.b); got != test.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, expected %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestVulnerabilityTableMatch(t *testing.T) {
+	table, err := LoadVulnerabilityTable("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		banner     string
+		affected   []string
+		backported []string
+	}{
+		{"SSH-2.0-OpenSSH_9.9p2", []string{}, nil},
+		{"SSH-2.0-OpenSSH_9.8p1", []string{"CVE-2025-26466"}, []string{}},
+		{"SSH-2.0-OpenSSH_8.9p1", []string{"CVE-2024-6387", "CVE-2023-48795"}, []string{}},
+		{"SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.10", []string{"CVE-2023-38408"}, []string{"CVE-2024-6387", "CVE-2023-48795"}},
+		{"SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6", []string{"CVE-2024-6387"}, []string{"CVE-2023-48795"}},
+		{"SSH-2.0-dropbear_2022.83", []string{"CVE-2023-48795"}, nil},
+		{"SSH-2.0-Cisco-1.25", []string{}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.banner, func(t *testing.T) {
+			version, err := ParseServerVersion(test.banner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			affected, backported := table.Match(version)
+			// An empty list of affected vulnerabilities expects none
+			for _, want := range test.affected {
+				if !slices.ContainsFunc(affected, func(v Vulnerability) bool { return v.Id == want }) {
+					t.Errorf("expected %s to be affected, got %v", want, affected)
+				}
+			}
+			for _, want := range test.backported {
+				if !slices.ContainsFunc(backported, func(v Vulnerability) bool { return v.Id == want }) {
+					t.Errorf("expected %s to be backported, got %v", want, backported)
+				}
+				if slices.ContainsFunc(affected, func(v Vulnerability) bool { return v.Id == want }) {
+					t.Errorf("expected backported %s not to be affected", want)
+				}
+			}
+			if len(test.affected) == 0 && len(affected) > 0 {
+				t.Errorf("expected affected %v, got %v", test.affected, affected)
+			}
+		})
+	}
+}
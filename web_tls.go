@@ -0,0 +1,814 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/compliance-framework/assessment-runtime/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// TLS policy profiles, after the Mozilla server side TLS guidelines
+var tlsProfiles = map[string]WebTLSCheck{
+	"modern": {
+		Protocols:        []string{"TLSv1.3"},
+		ForbiddenCiphers: []string{"RC4", "3DES", "DES", "NULL", "EXPORT", "MD5", "aNULL", "eNULL", "CBC"},
+		RequireHSTS:      boolPtr(true),
+		MinHSTSMaxAge:    63072000,
+	},
+	"intermediate": {
+		Protocols:        []string{"TLSv1.2", "TLSv1.3"},
+		ForbiddenCiphers: []string{"RC4", "3DES", "DES", "NULL", "EXPORT", "MD5", "aNULL", "eNULL"},
+		RequireHSTS:      boolPtr(true),
+		MinHSTSMaxAge:    31536000,
+	},
+}
+
+// WebTLSCheck holds the TLS policy for nginx and Apache. Profile selects
+// "modern" or "intermediate" defaults, which the other fields override.
+type WebTLSCheck struct {
+	Profile string `json:"profile,omitempty" yaml:"profile,omitempty"`
+
+	// Protocols lists the allowed protocol versions, e.g. TLSv1.2
+	Protocols []string `json:"protocols,omitempty" yaml:"protocols,omitempty"`
+
+	// ForbiddenCiphers are substrings of cipher names that must not be
+	// enabled, e.g. RC4 or 3DES
+	ForbiddenCiphers []string `json:"forbidden_ciphers,omitempty" yaml:"forbidden_ciphers,omitempty"`
+
+	// RequireHSTS overrides the profile when set, so require_hsts: false
+	// relaxes a profile that requires HSTS
+	RequireHSTS   *bool `json:"require_hsts,omitempty" yaml:"require_hsts,omitempty"`
+	MinHSTSMaxAge int   `json:"min_hsts_max_age,omitempty" yaml:"min_hsts_max_age,omitempty"`
+
+	// CertificateInventory links certificates to an inventory, e.g.
+	// "https://inventory.example.com/certificates/${fingerprint}"
+	CertificateInventory string `json:"certificate_inventory,omitempty" yaml:"certificate_inventory,omitempty"`
+}
+
+// Policy returns the check with the profile defaults applied
+func (c WebTLSCheck) Policy() (WebTLSCheck, error) {
+	if c.Profile == "" {
+		return c, nil
+	}
+	profile, ok := tlsProfiles[c.Profile]
+	if !ok {
+		return c, fmt.Errorf("unknown TLS profile %q", c.Profile)
+	}
+	if len(c.Protocols) > 0 {
+		profile.Protocols = c.Protocols
+	}
+	if len(c.ForbiddenCiphers) > 0 {
+		profile.ForbiddenCiphers = c.ForbiddenCiphers
+	}
+	if c.RequireHSTS != nil {
+		profile.RequireHSTS = c.RequireHSTS
+		if !*c.RequireHSTS {
+			profile.MinHSTSMaxAge = 0
+		}
+	}
+	if c.MinHSTSMaxAge > 0 {
+		profile.MinHSTSMaxAge = c.MinHSTSMaxAge
+	}
+	profile.CertificateInventory = c.CertificateInventory
+	profile.Profile = c.Profile
+	return profile, nil
+}
+
+// TLSEndpoint is the effective TLS configuration of an nginx server block or
+// an Apache virtual host. Protocols is nil when no directive sets it.
+type TLSEndpoint struct {
+	Server       string
+	Name         string
+	Listen       string
+	File         string
+	Line         int
+	Protocols    []string
+	Ciphers      string
+	HSTS         string
+	Certificates []string
+}
+
+// Location returns the file and line defining the endpoint
+func (e TLSEndpoint) Location() string {
+	return fmt.Sprintf("%s:%d", e.File, e.Line)
+}
+
+// Label names the endpoint in findings
+func (e TLSEndpoint) Label() string {
+	name := e.Name
+	if name == "" {
+		name = "default"
+	}
+	return fmt.Sprintf("%s %s (%s)", e.Server, name, e.Listen)
+}
+
+// Evaluate returns the policy violations of the endpoint
+func (p WebTLSCheck) Evaluate(endpoint TLSEndpoint) []string {
+	problems := []string{}
+	if len(p.Protocols) > 0 {
+		if endpoint.Protocols == nil {
+			problems = append(problems, "the protocols are not set, so a version dependent default applies")
+		}
+		for _, protocol := range endpoint.Protocols {
+			if !contains(p.Protocols, protocol) {
+				problems = append(problems, fmt.Sprintf("%s is enabled", protocol))
+			}
+		}
+	}
+	if len(p.ForbiddenCiphers) > 0 {
+		if endpoint.Ciphers == "" {
+			problems = append(problems, "the ciphers are not set, so a version dependent default applies")
+		}
+		for _, cipher := range enabledCiphers(endpoint.Ciphers) {
+			for _, forbidden := range p.ForbiddenCiphers {
+				if strings.Contains(strings.ToUpper(cipher), strings.ToUpper(forbidden)) {
+					problems = append(problems, fmt.Sprintf("cipher %s is enabled", cipher))
+					break
+				}
+			}
+		}
+	}
+	// A max-age implies HSTS unless it is explicitly not required
+	required := p.MinHSTSMaxAge > 0
+	if p.RequireHSTS != nil {
+		required = *p.RequireHSTS
+	}
+	if endpoint.HSTS == "" {
+		if required {
+			problems = append(problems, "HSTS is not enabled")
+		}
+	} else if maxAge := hstsMaxAge(endpoint.HSTS); maxAge < p.MinHSTSMaxAge {
+		problems = append(problems, fmt.Sprintf("HSTS max-age %d is below %d", maxAge, p.MinHSTSMaxAge))
+	}
+	return problems
+}
+
+// enabledCiphers returns the entries of an OpenSSL cipher string that
+// enable ciphers, skipping exclusions and keywords such as @SECLEVEL
+func enabledCiphers(ciphers string) []string {
+	enabled := []string{}
+	for _, cipher := range strings.FieldsFunc(ciphers, func(r rune) bool { return r == ':' || r == ' ' || r == ',' }) {
+		if strings.HasPrefix(cipher, "!") || strings.HasPrefix(cipher, "-") || strings.HasPrefix(cipher, "@") {
+			continue
+		}
+		enabled = append(enabled, strings.TrimPrefix(cipher, "+"))
+	}
+	return enabled
+}
+
+var hstsMaxAgeRe = regexp.MustCompile(`(?i)max-age\s*=\s*"?(\d+)`)
+
+// hstsMaxAge returns the max-age of a Strict-Transport-Security value
+func hstsMaxAge(value string) int {
+	match := hstsMaxAgeRe.FindStringSubmatch(value)
+	if match == nil {
+		return 0
+	}
+	maxAge, _ := strconv.Atoi(match[1])
+	return maxAge
+}
+
+// WebDirective is a directive of an nginx or Apache configuration. Block
+// holds the directives of an nginx block or Apache section.
+type WebDirective struct {
+	Name  string
+	Args  []string
+	Block []WebDirective
+	File  string
+	Line  int
+}
+
+type webToken struct {
+	Text   string
+	Quoted bool
+	Line   int
+}
+
+// tokenizeNginx splits an nginx configuration into words, quoted strings
+// and the ; { } punctuation
+func tokenizeNginx(content string) []webToken {
+	tokens := []webToken{}
+	line := 1
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+		case c == ';' || c == '{' || c == '}':
+			tokens = append(tokens, webToken{Text: string(c), Line: line})
+			i++
+		case c == '"' || c == '\'':
+			start := line
+			j := i + 1
+			value := strings.Builder{}
+			for j < len(content) && content[j] != c {
+				if content[j] == '\\' && j+1 < len(content) {
+					j++
+				}
+				if content[j] == '\n' {
+					line++
+				}
+				value.WriteByte(content[j])
+				j++
+			}
+			tokens = append(tokens, webToken{Text: value.String(), Quoted: true, Line: start})
+			i = j + 1
+		default:
+			j := i
+			for j < len(content) && !strings.ContainsRune(" \t\r\n;{}", rune(content[j])) {
+				j++
+			}
+			tokens = append(tokens, webToken{Text: content[i:j], Line: line})
+			i = j
+		}
+	}
+	return tokens
+}
+
+type webConfigParser struct {
+	load FileLoader
+	base string
+}
+
+// ParseNginx parses an nginx configuration, following include directives
+// relative to the directory of the main file
+func ParseNginx(file string, content string, load FileLoader) ([]WebDirective, error) {
+	parser := &webConfigParser{load: load, base: path.Dir(file)}
+	return parser.nginx(file, content, 0)
+}
+
+func (p *webConfigParser) nginx(file string, content string, depth int) ([]WebDirective, error) {
+	tokens := tokenizeNginx(content)
+	position := 0
+	directives, closed, err := p.nginxBlock(file, tokens, &position, depth)
+	if err != nil {
+		return nil, err
+	}
+	if closed {
+		return nil, fmt.Errorf("%s:%d: unexpected \"}\"", file, tokens[position-1].Line)
+	}
+	return directives, nil
+}
+
+// nginxBlock parses directives up to the end of the enclosing block,
+// reporting whether it was closed by "}"
+func (p *webConfigParser) nginxBlock(file string, tokens []webToken, position *int, depth int) ([]WebDirective, bool, error) {
+	directives := []WebDirective{}
+	current := []webToken{}
+	for *position < len(tokens) {
+		token := tokens[*position]
+		*position++
+		if token.Quoted {
+			current = append(current, token)
+			continue
+		}
+		switch token.Text {
+		case ";", "{":
+			if len(current) == 0 {
+				return nil, false, fmt.Errorf("%s:%d: unexpected %q", file, token.Line, token.Text)
+			}
+			directive := WebDirective{Name: current[0].Text, File: file, Line: current[0].Line}
+			for _, arg := range current[1:] {
+				directive.Args = append(directive.Args, arg.Text)
+			}
+			current = []webToken{}
+			if token.Text == "{" {
+				block, closed, err := p.nginxBlock(file, tokens, position, depth)
+				if err != nil {
+					return nil, false, err
+				}
+				if !closed {
+					return nil, false, fmt.Errorf("%s:%d: unterminated block %s", file, directive.Line, directive.Name)
+				}
+				directive.Block = block
+				directives = append(directives, directive)
+				continue
+			}
+			if directive.Name == "include" && len(directive.Args) > 0 {
+				included, err := p.include(directive.Args[0], depth, p.nginx)
+				if err != nil {
+					return nil, false, fmt.Errorf("%s:%d: %v", file, directive.Line, err)
+				}
+				directives = append(directives, included...)
+				continue
+			}
+			directives = append(directives, directive)
+		case "}":
+			return directives, true, nil
+		default:
+			current = append(current, token)
+		}
+	}
+	return directives, false, nil
+}
+
+// include loads and parses the files matching an include pattern
+func (p *webConfigParser) include(pattern string, depth int, parse func(string, string, int) ([]WebDirective, error)) ([]WebDirective, error) {
+	if p.load == nil {
+		return nil, nil
+	}
+	if depth >= maxIncludeDepth {
+		return nil, fmt.Errorf("includes nested too deeply")
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = path.Join(p.base, pattern)
+	}
+	files, err := p.load(pattern)
+	if err != nil {
+		return nil, err
+	}
+	// nginx and Apache include glob matches in lexical order
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	directives := []WebDirective{}
+	for _, included := range files {
+		parsed, err := parse(included.Path, included.Content, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, parsed...)
+	}
+	return directives, nil
+}
+
+// findDirectives returns the directives with the name, case insensitively
+func findDirectives(directives []WebDirective, name string) []WebDirective {
+	found := []WebDirective{}
+	for _, directive := range directives {
+		if strings.EqualFold(directive.Name, name) {
+			found = append(found, directive)
+		}
+	}
+	return found
+}
+
+// lastArgs returns the arguments of the last directive with the name
+func lastArgs(directives []WebDirective, name string) ([]string, bool) {
+	found := findDirectives(directives, name)
+	if len(found) == 0 {
+		return nil, false
+	}
+	return found[len(found)-1].Args, true
+}
+
+// nginxHSTS returns the Strict-Transport-Security value set by add_header
+func nginxHSTS(directives []WebDirective) (string, bool) {
+	headers := findDirectives(directives, "add_header")
+	for _, header := range headers {
+		if len(header.Args) >= 2 && strings.EqualFold(header.Args[0], "Strict-Transport-Security") {
+			return header.Args[1], true
+		}
+	}
+	// add_header is only inherited when the level sets none of its own
+	return "", len(headers) > 0
+}
+
+// NginxEndpoints returns the TLS server blocks of a parsed nginx
+// configuration, with the settings they inherit from the http block
+func NginxEndpoints(directives []WebDirective) []TLSEndpoint {
+	endpoints := []TLSEndpoint{}
+	for _, http := range findDirectives(directives, "http") {
+		inherited := TLSEndpoint{Server: "nginx"}
+		if protocols, ok := lastArgs(http.Block, "ssl_protocols"); ok {
+			inherited.Protocols = protocols
+		}
+		if ciphers, ok := lastArgs(http.Block, "ssl_ciphers"); ok {
+			inherited.Ciphers = strings.Join(ciphers, " ")
+		}
+		inherited.HSTS, _ = nginxHSTS(http.Block)
+		for _, certificate := range findDirectives(http.Block, "ssl_certificate") {
+			inherited.Certificates = append(inherited.Certificates, certificate.Args...)
+		}
+
+		for _, server := range findDirectives(http.Block, "server") {
+			tls := false
+			listen := []string{}
+			for _, directive := range findDirectives(server.Block, "listen") {
+				if len(directive.Args) > 0 {
+					listen = append(listen, directive.Args[0])
+				}
+				if contains(directive.Args, "ssl") || contains(directive.Args, "quic") {
+					tls = true
+				}
+			}
+			if args, ok := lastArgs(server.Block, "ssl"); ok && contains(args, "on") {
+				tls = true
+			}
+			if !tls {
+				continue
+			}
+
+			endpoint := inherited
+			endpoint.File, endpoint.Line = server.File, server.Line
+			endpoint.Listen = strings.Join(listen, ",")
+			if names, ok := lastArgs(server.Block, "server_name"); ok && len(names) > 0 {
+				endpoint.Name = names[0]
+			}
+			if protocols, ok := lastArgs(server.Block, "ssl_protocols"); ok {
+				endpoint.Protocols = protocols
+			}
+			if ciphers, ok := lastArgs(server.Block, "ssl_ciphers"); ok {
+				endpoint.Ciphers = strings.Join(ciphers, " ")
+			}
+			if hsts, set := nginxHSTS(server.Block); set {
+				endpoint.HSTS = hsts
+			}
+			if certificates := findDirectives(server.Block, "ssl_certificate"); len(certificates) > 0 {
+				endpoint.Certificates = []string{}
+				for _, certificate := range certificates {
+					endpoint.Certificates = append(endpoint.Certificates, certificate.Args...)
+				}
+			}
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// splitApacheArgs splits directive arguments, keeping quoted strings whole
+func splitApacheArgs(value string) []string {
+	args := []string{}
+	for _, token := range tokenizeNginx(value) {
+		args = append(args, token.Text)
+	}
+	return args
+}
+
+// ParseApache parses an Apache configuration into directives, with
+// <Section> blocks as directives named after the section. Include and
+// IncludeOptional are followed relative to the server root.
+func ParseApache(file string, content string, serverRoot string, load FileLoader) ([]WebDirective, error) {
+	parser := &webConfigParser{load: load, base: serverRoot}
+	return parser.apache(file, content, 0)
+}
+
+func (p *webConfigParser) apache(file string, content string, depth int) ([]WebDirective, error) {
+	root := []WebDirective{}
+	stack := []*WebDirective{}
+	appendDirective := func(directive WebDirective) {
+		if len(stack) == 0 {
+			root = append(root, directive)
+			return
+		}
+		parent := stack[len(stack)-1]
+		parent.Block = append(parent.Block, directive)
+	}
+
+	for index, line := range joinContinuations(content) {
+		line_number := index + 1
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "</") {
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("%s:%d: unexpected %s", file, line_number, line)
+			}
+			section := *stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			appendDirective(section)
+			continue
+		}
+		if strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">") {
+			fields := splitApacheArgs(line[1 : len(line)-1])
+			if len(fields) == 0 {
+				continue
+			}
+			stack = append(stack, &WebDirective{Name: fields[0], Args: fields[1:], File: file, Line: line_number})
+			continue
+		}
+
+		fields := splitApacheArgs(line)
+		if len(fields) == 0 {
+			continue
+		}
+		directive := WebDirective{Name: fields[0], Args: fields[1:], File: file, Line: line_number}
+		if strings.EqualFold(directive.Name, "ServerRoot") && len(directive.Args) > 0 && depth == 0 {
+			p.base = directive.Args[0]
+		}
+		if (strings.EqualFold(directive.Name, "Include") || strings.EqualFold(directive.Name, "IncludeOptional")) && len(directive.Args) > 0 {
+			included, err := p.include(directive.Args[0], depth, p.apache)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", file, line_number, err)
+			}
+			for _, item := range included {
+				appendDirective(item)
+			}
+			continue
+		}
+		appendDirective(directive)
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("%s:%d: unterminated section %s", file, stack[0].Line, stack[0].Name)
+	}
+	return root, nil
+}
+
+// flattenApache lifts directives out of conditional sections such as
+// <IfModule>, which are assumed to apply, keeping <VirtualHost> sections
+func flattenApache(directives []WebDirective) []WebDirective {
+	flat := []WebDirective{}
+	for _, directive := range directives {
+		if directive.Block != nil && !strings.EqualFold(directive.Name, "VirtualHost") && strings.HasPrefix(strings.ToLower(directive.Name), "if") {
+			flat = append(flat, flattenApache(directive.Block)...)
+			continue
+		}
+		flat = append(flat, directive)
+	}
+	return flat
+}
+
+// ApacheProtocols evaluates an SSLProtocol argument list such as
+// "all -SSLv3 -TLSv1 -TLSv1.1"
+func ApacheProtocols(args []string) []string {
+	all := []string{"TLSv1", "TLSv1.1", "TLSv1.2", "TLSv1.3"}
+	names := map[string]string{"sslv3": "SSLv3", "tlsv1": "TLSv1", "tlsv1.1": "TLSv1.1", "tlsv1.2": "TLSv1.2", "tlsv1.3": "TLSv1.3"}
+	enabled := []string{}
+	for _, arg := range args {
+		op := byte(0)
+		if strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-") {
+			op = arg[0]
+			arg = arg[1:]
+		}
+		selected := []string{}
+		if strings.EqualFold(arg, "all") {
+			selected = all
+		} else if name, ok := names[strings.ToLower(arg)]; ok {
+			selected = []string{name}
+		}
+		for _, protocol := range selected {
+			if op == '-' {
+				remaining := []string{}
+				for _, item := range enabled {
+					if item != protocol {
+						remaining = append(remaining, item)
+					}
+				}
+				enabled = remaining
+			} else if !contains(enabled, protocol) {
+				enabled = append(enabled, protocol)
+			}
+		}
+	}
+	return enabled
+}
+
+// apacheHSTS returns the Strict-Transport-Security value of a Header
+// directive
+func apacheHSTS(directives []WebDirective) (string, bool) {
+	for _, header := range findDirectives(directives, "Header") {
+		args := header.Args
+		if len(args) > 0 && (strings.EqualFold(args[0], "always") || strings.EqualFold(args[0], "onsuccess")) {
+			args = args[1:]
+		}
+		if len(args) >= 3 && strings.EqualFold(args[1], "Strict-Transport-Security") {
+			return args[2], true
+		}
+	}
+	return "", false
+}
+
+// ApacheEndpoints returns the virtual hosts with SSLEngine on, with the
+// settings they inherit from the server configuration
+func ApacheEndpoints(directives []WebDirective) []TLSEndpoint {
+	directives = flattenApache(directives)
+	inherited := TLSEndpoint{Server: "apache"}
+	if protocols, ok := lastArgs(directives, "SSLProtocol"); ok {
+		inherited.Protocols = ApacheProtocols(protocols)
+	}
+	if ciphers, ok := lastArgs(directives, "SSLCipherSuite"); ok {
+		inherited.Ciphers = strings.Join(ciphers, " ")
+	}
+	inherited.HSTS, _ = apacheHSTS(directives)
+
+	endpoints := []TLSEndpoint{}
+	for _, vhost := range findDirectives(directives, "VirtualHost") {
+		block := flattenApache(vhost.Block)
+		if engine, ok := lastArgs(block, "SSLEngine"); !ok || len(engine) == 0 || !strings.EqualFold(engine[0], "on") {
+			continue
+		}
+		endpoint := inherited
+		endpoint.File, endpoint.Line = vhost.File, vhost.Line
+		endpoint.Listen = strings.Join(vhost.Args, ",")
+		if names, ok := lastArgs(block, "ServerName"); ok && len(names) > 0 {
+			endpoint.Name = names[0]
+		}
+		if protocols, ok := lastArgs(block, "SSLProtocol"); ok {
+			endpoint.Protocols = ApacheProtocols(protocols)
+		}
+		if ciphers, ok := lastArgs(block, "SSLCipherSuite"); ok {
+			endpoint.Ciphers = strings.Join(ciphers, " ")
+		}
+		if hsts, ok := apacheHSTS(block); ok {
+			endpoint.HSTS = hsts
+		}
+		if certificate, ok := lastArgs(block, "SSLCertificateFile"); ok && len(certificate) > 0 {
+			endpoint.Certificates = []string{certificate[0]}
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+// CertificateInfo is the summary of a certificate file on the host
+type CertificateInfo struct {
+	Path        string
+	Fingerprint string
+	Subject     string
+	NotAfter    time.Time
+	Error       string
+}
+
+// readCertificates runs openssl on the host for each certificate path
+func readCertificates(client *ssh.Client, paths []string) (map[string]CertificateInfo, error) {
+	commands := []string{}
+	for _, p := range paths {
+		commands = append(commands, fmt.Sprintf("printf '==>cert %%s\\n' %s; openssl x509 -in %s -noout -fingerprint -sha256 -subject -enddate 2>&1", shellQuote(p), shellQuote(p)))
+	}
+	if len(commands) == 0 {
+		return map[string]CertificateInfo{}, nil
+	}
+	output, _, err := RunSessionCommand(client, strings.Join(commands, "\n"))
+	if err != nil {
+		return nil, err
+	}
+	return ParseCertificates(output), nil
+}
+
+// ParseCertificates parses openssl x509 output delimited by "==>cert"
+// lines. Only the first certificate of a chain file is read.
+func ParseCertificates(output string) map[string]CertificateInfo {
+	certificates := map[string]CertificateInfo{}
+	current := ""
+	for _, line := range strings.Split(output, "\n") {
+		if p, ok := strings.CutPrefix(line, "==>cert "); ok {
+			current = p
+			certificates[current] = CertificateInfo{Path: current}
+			continue
+		}
+		if current == "" || strings.TrimSpace(line) == "" {
+			continue
+		}
+		info := certificates[current]
+		key, value, ok := strings.Cut(line, "=")
+		switch {
+		case ok && strings.EqualFold(key, "sha256 Fingerprint"):
+			info.Fingerprint = "sha256:" + strings.ToLower(strings.ReplaceAll(value, ":", ""))
+		case ok && key == "subject":
+			info.Subject = strings.TrimSpace(value)
+		case ok && key == "notAfter":
+			notAfter, err := time.Parse("Jan _2 15:04:05 2006 MST", strings.TrimSpace(value))
+			if err != nil {
+				info.Error = fmt.Sprintf("the expiry date %q is not understood", strings.TrimSpace(value))
+			}
+			info.NotAfter = notAfter
+		default:
+			if info.Error == "" {
+				info.Error = strings.TrimSpace(line)
+			}
+		}
+		certificates[current] = info
+	}
+	return certificates
+}
+
+// webServerConfigs are the main configuration files and server roots
+var webServerConfigs = []struct {
+	Server string
+	File   string
+	Root   string
+}{
+	{"nginx", "/etc/nginx/nginx.conf", "/etc/nginx"},
+	{"apache", "/etc/apache2/apache2.conf", "/etc/apache2"},
+	{"apache", "/etc/httpd/conf/httpd.conf", "/etc/httpd"},
+}
+
+func runWebTLSCheck(client *ssh.Client, config SSHConfig, check Check) ([]*Observation, []*Finding, error) {
+	settings := WebTLSCheck{Profile: "intermediate"}
+	if check.WebTLS != nil {
+		settings = *check.WebTLS
+	}
+	policy, err := settings.Policy()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	endpoints := []TLSEndpoint{}
+	read := []string{}
+	for _, server := range webServerConfigs {
+		content, found, err := ReadRemoteFile(client, server.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !found {
+			continue
+		}
+		read = append(read, server.File)
+		if server.Server == "nginx" {
+			directives, err := ParseNginx(server.File, content, RemoteFileLoader(client))
+			if err != nil {
+				return nil, nil, err
+			}
+			endpoints = append(endpoints, NginxEndpoints(directives)...)
+		} else {
+			directives, err := ParseApache(server.File, content, server.Root, RemoteFileLoader(client))
+			if err != nil {
+				return nil, nil, err
+			}
+			endpoints = append(endpoints, ApacheEndpoints(directives)...)
+		}
+	}
+
+	paths := []string{}
+	for _, endpoint := range endpoints {
+		paths = union(paths, endpoint.Certificates)
+	}
+	certificates, err := readCertificates(client, paths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	target := fmt.Sprintf("%s@%s:%s", config.Username, config.Host, config.Port)
+	description := fmt.Sprintf("No nginx or Apache configuration was found on %s.", target)
+	if len(read) > 0 {
+		description = fmt.Sprintf("Found %d TLS endpoints in %s on %s.", len(endpoints), strings.Join(read, ", "), target)
+	}
+	obs := newObservation(
+		checkTitle(check, "Web Server TLS Configuration"),
+		description,
+		append([]*Property{{Name: "Profile", Value: policy.Profile}}, checkProps(check)...),
+		[]*Evidence{},
+		"All OK.",
+	)
+
+	findings := []*Finding{}
+	now := time.Now()
+	for _, endpoint := range endpoints {
+		protocols := "default"
+		if endpoint.Protocols != nil {
+			protocols = strings.Join(endpoint.Protocols, " ")
+		}
+		evidence := &Evidence{
+			Title:       endpoint.Label(),
+			Description: fmt.Sprintf("Defined at %s. Protocols %s, ciphers %q, HSTS %q.", endpoint.Location(), protocols, endpoint.Ciphers, endpoint.HSTS),
+			Props:       []*Property{},
+			Links:       []*Link{},
+		}
+		obs.RelevantEvidence = append(obs.RelevantEvidence, evidence)
+		props := append([]*Property{
+			{Name: "Server", Value: endpoint.Server},
+			{Name: "Endpoint", Value: endpoint.Label()},
+			{Name: "Path", Value: endpoint.File},
+		}, checkProps(check)...)
+
+		for _, p := range endpoint.Certificates {
+			info := certificates[p]
+			evidence.Props = append(evidence.Props, &Property{Name: "Certificate", Value: p})
+			if info.Fingerprint != "" {
+				evidence.Props = append(evidence.Props, &Property{Name: "CertificateFingerprint", Value: info.Fingerprint})
+				if policy.CertificateInventory != "" {
+					evidence.Links = append(evidence.Links, &Link{
+						Href: RenderTemplate(policy.CertificateInventory, map[string]string{
+							"fingerprint": info.Fingerprint,
+							"path":        p,
+							"host":        config.Host,
+						}),
+						Rel: "certificate",
+					})
+				}
+			}
+			if info.Error != "" || info.Fingerprint == "" {
+				findings = append(findings, newFinding(obs, "TLS Certificate Unreadable",
+					fmt.Sprintf("The certificate %s of %s on %s could not be read: %s.", p, endpoint.Label(), target, info.Error),
+					"Check that the certificate file exists and is a PEM encoded certificate.", props))
+			} else if !info.NotAfter.IsZero() && info.NotAfter.Before(now) {
+				findings = append(findings, newFinding(obs, "TLS Certificate Expired",
+					fmt.Sprintf("The certificate %s of %s on %s expired on %s.", p, endpoint.Label(), target, info.NotAfter.Format(time.RFC3339)),
+					"Renew the certificate.", props))
+			}
+		}
+
+		if problems := policy.Evaluate(endpoint); len(problems) > 0 {
+			findings = append(findings, newFinding(obs, "Web Server TLS Configuration Not Compliant",
+				fmt.Sprintf("%s at %s on %s does not meet the TLS policy: %s.", endpoint.Label(), endpoint.Location(), target, strings.Join(problems, "; ")),
+				"Update the TLS directives of the server block or virtual host to match the TLS policy profile.", props))
+		}
+	}
+
+	if len(findings) > 0 {
+		obs.Remarks = fmt.Sprintf("%d TLS configuration problems were found.", len(findings))
+	}
+	return []*Observation{obs}, findings, nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNginxEndpoints(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "nginx.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"/etc/nginx/modules-enabled/50-b.conf": "load_module b.so;\n",
+		"/etc/nginx/modules-enabled/10-a.conf": "load_module a.so;\n",
+	}
+	directives, err := ParseNginx("/etc/nginx/nginx.conf", string(content), mapLoader(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules := []string{}
+	for _, directive := range findDirectives(directives, "load_module") {
+		modules = append(modules, directive.Args[0])
+	}
+	if !slices.Equal(modules, []string{"a.so", "b.so"}) {
+		t.Errorf("expected the includes in lexical order, got %v", modules)
+	}
+
+	endpoints := NginxEndpoints(directives)
+	if len(endpoints) != 1 {
+		t.Fatalf("expected one endpoint, got %+v", endpoints)
+	}
+	endpoint := endpoints[0]
+	if endpoint.Label() != "nginx www.example.com (443)" || endpoint.Location() != "/etc/nginx/nginx.conf:6" {
+		t.Errorf("unexpected endpoint %s at %s", endpoint.Label(), endpoint.Location())
+	}
+	if !slices.Equal(endpoint.Protocols, []string{"TLSv1.2", "TLSv1.3"}) || !slices.Equal(endpoint.Certificates, []string{"/etc/ssl/certs/site.pem"}) {
+		t.Errorf("expected the inherited protocols and the server certificate, got %+v", endpoint)
+	}
+}
+
+func TestNginxEndpointsInheritance(t *testing.T) {
+	content := `http {
+	ssl_protocols TLSv1 TLSv1.2;
+	add_header Strict-Transport-Security "max-age=63072000" always;
+	server {
+		listen 443 ssl;
+		ssl_protocols TLSv1.3;
+		add_header X-Frame-Options DENY;
+	}
+	server {
+		listen 8443 quic;
+		server_name api.example.com;
+	}
+	server {
+		listen 80;
+	}
+}
+`
+	directives, err := ParseNginx("/etc/nginx/nginx.conf", content, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints := NginxEndpoints(directives)
+	if len(endpoints) != 2 {
+		t.Fatalf("expected two TLS endpoints, got %+v", endpoints)
+	}
+	// add_header in the server block replaces the inherited headers
+	if !slices.Equal(endpoints[0].Protocols, []string{"TLSv1.3"}) || endpoints[0].HSTS != "" {
+		t.Errorf("unexpected first endpoint %+v", endpoints[0])
+	}
+	if !slices.Equal(endpoints[1].Protocols, []string{"TLSv1", "TLSv1.2"}) || endpoints[1].HSTS != "max-age=63072000" {
+		t.Errorf("unexpected second endpoint %+v", endpoints[1])
+	}
+}
+
+func TestParseNginxErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		error   string
+	}{
+		{"http {\n", "unterminated block http"},
+		{"}\n", "unexpected \"}\""},
+		{";\n", "unexpected \";\""},
+		{"include /etc/nginx/loop.conf;\n", "nested too deeply"},
+	}
+	loader := mapLoader(map[string]string{"/etc/nginx/loop.conf": "include /etc/nginx/loop.conf;\n"})
+	for _, test := range tests {
+		_, err := ParseNginx("/etc/nginx/nginx.conf", test.content, loader)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%q: expected %q, got %v", test.content, test.error, err)
+		}
+	}
+}
+
+func TestApacheEndpoints(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "apache.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"/etc/httpd/conf.modules.d/20-ssl.conf":  "SSLCipherSuite HIGH\n",
+		"/etc/httpd/conf.modules.d/00-base.conf": "SSLCipherSuite RC4\nHeader always set Strict-Transport-Security \"max-age=31536000\"\n",
+	}
+	directives, err := ParseApache("/etc/httpd/conf/httpd.conf", string(content), "/etc/apache2", mapLoader(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints := ApacheEndpoints(directives)
+	if len(endpoints) != 1 {
+		t.Fatalf("expected one endpoint, got %+v", endpoints)
+	}
+	endpoint := endpoints[0]
+	want := TLSEndpoint{
+		Server:       "apache",
+		Name:         "www.example.com",
+		Listen:       "*:443",
+		File:         "/etc/httpd/conf/httpd.conf",
+		Line:         6,
+		Protocols:    []string{"TLSv1.2", "TLSv1.3"},
+		Ciphers:      "HIGH:!aNULL:!MD5",
+		HSTS:         "max-age=31536000",
+		Certificates: []string{"/etc/pki/tls/certs/site.crt"},
+	}
+	if endpoint.Label() != "apache www.example.com (*:443)" || !slices.Equal(endpoint.Protocols, want.Protocols) || !slices.Equal(endpoint.Certificates, want.Certificates) ||
+		endpoint.Ciphers != want.Ciphers || endpoint.HSTS != want.HSTS || endpoint.Location() != want.Location() {
+		t.Errorf("unexpected endpoint\n%+v\nexpected\n%+v", endpoint, want)
+	}
+
+	// The includes are read in lexical order, so the last cipher suite wins
+	inherited, _ := lastArgs(flattenApache(directives), "SSLCipherSuite")
+	if !slices.Equal(inherited, []string{"HIGH"}) {
+		t.Errorf("expected the includes in lexical order, got %v", inherited)
+	}
+}
+
+func TestParseApacheErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		error   string
+	}{
+		{"<VirtualHost *:443>\nSSLEngine on\n", "unterminated section VirtualHost"},
+		{"</VirtualHost>\n", "unexpected </VirtualHost>"},
+	}
+	for _, test := range tests {
+		_, err := ParseApache("/etc/httpd/conf/httpd.conf", test.content, "/etc/httpd", nil)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%q: expected %q, got %v", test.content, test.error, err)
+		}
+	}
+}
+
+func TestApacheProtocols(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"all", "-SSLv3", "-TLSv1", "-TLSv1.1"}, []string{"TLSv1.2", "TLSv1.3"}},
+		{[]string{"TLSv1.2"}, []string{"TLSv1.2"}},
+		{[]string{"-all", "+TLSv1.3", "+tlsv1.2"}, []string{"TLSv1.3", "TLSv1.2"}},
+		{[]string{"SSLv3", "TLSv1"}, []string{"SSLv3", "TLSv1"}},
+		{[]string{"all", "-TLSv1.3", "+TLSv1.3"}, []string{"TLSv1", "TLSv1.1", "TLSv1.2", "TLSv1.3"}},
+		{[]string{"TLSv9"}, []string{}},
+	}
+	for _, test := range tests {
+		if protocols := ApacheProtocols(test.args); !slices.Equal(protocols, test.want) {
+			t.Errorf("%v: expected %v, got %v", test.args, test.want, protocols)
+		}
+	}
+}
+
+func TestWebTLSPolicy(t *testing.T) {
+	noHSTS := TLSEndpoint{Protocols: []string{"TLSv1.2"}, Ciphers: "ECDHE-RSA-AES128-GCM-SHA256"}
+	shortHSTS := noHSTS
+	shortHSTS.HSTS = "max-age=600"
+	tests := []struct {
+		name     string
+		check    WebTLSCheck
+		endpoint TLSEndpoint
+		want     []string
+	}{
+		{"profile requires HSTS", WebTLSCheck{Profile: "intermediate"}, noHSTS, []string{"HSTS is not enabled"}},
+		{"profile max-age", WebTLSCheck{Profile: "intermediate"}, shortHSTS, []string{"HSTS max-age 600 is below 31536000"}},
+		{"HSTS relaxed", WebTLSCheck{Profile: "intermediate", RequireHSTS: boolPtr(false)}, noHSTS, []string{}},
+		{"HSTS relaxed with max-age", WebTLSCheck{Profile: "intermediate", RequireHSTS: boolPtr(false), MinHSTSMaxAge: 3600}, shortHSTS, []string{"HSTS max-age 600 is below 3600"}},
+		{"no profile", WebTLSCheck{}, noHSTS, []string{}},
+		{"no profile with HSTS", WebTLSCheck{RequireHSTS: boolPtr(true)}, noHSTS, []string{"HSTS is not enabled"}},
+		{"modern", WebTLSCheck{Profile: "modern", RequireHSTS: boolPtr(false)}, TLSEndpoint{Ciphers: "DES-CBC3-SHA:!RC4"}, []string{
+			"the protocols are not set, so a version dependent default applies",
+			"cipher DES-CBC3-SHA is enabled",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := test.check.Policy()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if problems := policy.Evaluate(test.endpoint); !slices.Equal(problems, test.want) {
+				t.Errorf("expected %q, got %q", test.want, problems)
+			}
+		})
+	}
+	if _, err := (WebTLSCheck{Profile: "legacy"}).Policy(); err == nil {
+		t.Error("expected an unknown profile to be rejected")
+	}
+}
+
+func TestParseCertificates(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "seeds", "certificates.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := string(content) + "==>cert /etc/ssl/certs/odd.pem\nsha256 Fingerprint=AA:BB\nnotAfter=someday\n"
+	certificates := ParseCertificates(output)
+	want := map[string]CertificateInfo{
+		"/etc/ssl/certs/site.pem": {
+			Path:        "/etc/ssl/certs/site.pem",
+			Fingerprint: "sha256:4f2a9c110b7e3d8821aa5c90ee013476129bc4def0556a7b8c9daebfc0d1e2f3",
+			Subject:     "CN = www.example.com",
+			NotAfter:    time.Date(2025, 1, 15, 23, 59, 59, 0, time.UTC),
+		},
+		"/etc/ssl/certs/missing.pem": {
+			Path:  "/etc/ssl/certs/missing.pem",
+			Error: "Could not open file or uri for loading certificate from /etc/ssl/certs/missing.pem",
+		},
+		"/etc/ssl/certs/odd.pem": {
+			Path:        "/etc/ssl/certs/odd.pem",
+			Fingerprint: "sha256:aabb",
+			Error:       `the expiry date "someday" is not understood`,
+		},
+	}
+	if len(certificates) != len(want) {
+		t.Fatalf("expected %d certificates, got %+v", len(want), certificates)
+	}
+	for path, info := range want {
+		got := certificates[path]
+		if got.Path != info.Path || got.Fingerprint != info.Fingerprint || got.Subject != info.Subject || !got.NotAfter.Equal(info.NotAfter) || got.Error != info.Error {
+			t.Errorf("%s: expected %+v, got %+v", path, info, got)
+		}
+	}
+}